@@ -0,0 +1,218 @@
+package main
+
+import(
+  "os"
+  "io"
+  "io/ioutil"
+  "fmt"
+  "net"
+  "flag"
+  "bytes"
+  "strings"
+  "context"
+  "net/http"
+  "encoding/json"
+  "text/tabwriter"
+)
+
+// Talks to the WORLD admin api.
+//
+//   admin [--addr=127.0.0.1:9497] [--token=...] command [args]
+
+const usage string = `commands:
+  status              state and simulations
+  players             connected players
+  kick <id>           disconnect a player
+  broadcast <text>    message every player
+  chat <text>         system chat message to every player
+  whisper <id> <text> system chat message to one player
+  save                write modified map files now
+  stats               map file cache stats
+  reload-ships        reload the ships file, for players joining from now on
+  log                 log level of each subsystem
+  log <level> [sys]   set the log level of one or all subsystems, on WORLD and every SIM
+`
+
+func main() {
+  addr := flag.String("addr", envOr("SPACE_ADMIN_ADDR", "127.0.0.1:9497"), "admin api address, host:port or unix:/path")
+  token := flag.String("token", os.Getenv("SPACE_ADMIN_TOKEN"), "admin token")
+  flag.Usage = func() {
+    fmt.Fprintf(flag.CommandLine.Output(), "usage: admin [flags] command [args]\n")
+    flag.PrintDefaults()
+    fmt.Fprint(flag.CommandLine.Output(), usage)
+  }
+  flag.Parse()
+
+  if flag.NArg() == 0 {
+    flag.Usage()
+    os.Exit(2)
+  }
+
+  c := newClient(*addr, *token)
+  args := flag.Args()
+
+  var err error
+  switch args[0] {
+    case "status":
+      err = c.printJSON("GET", "/status", nil)
+    case "players":
+      err = c.printPlayers()
+    case "kick":
+      if len(args) != 2 {
+        err = fmt.Errorf("kick needs a player id")
+        break
+      }
+      err = c.printJSON("POST", "/players/kick", map[string]string{"id": args[1]})
+    case "broadcast":
+      if len(args) < 2 {
+        err = fmt.Errorf("broadcast needs text")
+        break
+      }
+      err = c.printJSON("POST", "/broadcast", map[string]string{"text": strings.Join(args[1:], " ")})
+    case "chat":
+      if len(args) < 2 {
+        err = fmt.Errorf("chat needs text")
+        break
+      }
+      err = c.printJSON("POST", "/chat", map[string]string{"text": strings.Join(args[1:], " ")})
+    case "whisper":
+      if len(args) < 3 {
+        err = fmt.Errorf("whisper needs a player id and text")
+        break
+      }
+      err = c.printJSON("POST", "/chat", map[string]string{"to": args[1], "text": strings.Join(args[2:], " ")})
+    case "save":
+      err = c.printJSON("POST", "/map/save", nil)
+    case "stats":
+      err = c.printJSON("GET", "/map/stats", nil)
+    case "reload-ships":
+      err = c.printJSON("POST", "/ships/reload", nil)
+    case "log":
+      if len(args) < 2 {
+        err = c.printJSON("GET", "/log", nil)
+        break
+      }
+      sys := ""
+      if len(args) > 2 {
+        sys = args[2]
+      }
+      err = c.printJSON("POST", "/log/level", map[string]string{"subsystem": sys, "level": args[1]})
+    default:
+      err = fmt.Errorf("unknown command %q", args[0])
+  }
+
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+}
+
+func envOr(key, def string) string {
+  if v, ok := os.LookupEnv(key); ok {
+    return v
+  }
+  return def
+}
+
+type client struct {
+  http  *http.Client
+  base  string
+  token string
+}
+
+func newClient(addr, token string) *client {
+  c := &client{http: &http.Client{}, base: "http://" + addr, token: token}
+
+  if strings.HasPrefix(addr, "unix:") {
+    path := strings.TrimPrefix(addr, "unix:")
+    c.base = "http://world"
+    c.http.Transport = &http.Transport{
+      DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+        var d net.Dialer
+        return d.DialContext(ctx, "unix", path)
+      },
+    }
+  }
+
+  return c
+}
+
+func (c *client) do(method, path string, body interface{}) ([]byte, error) {
+  var reader io.Reader
+  if body != nil {
+    b, err := json.Marshal(body)
+    if err != nil {
+      return nil, err
+    }
+    reader = bytes.NewReader(b)
+  }
+
+  req, err := http.NewRequest(method, c.base + path, reader)
+  if err != nil {
+    return nil, err
+  }
+  req.Header.Set("Authorization", "Bearer " + c.token)
+  if body != nil {
+    req.Header.Set("Content-Type", "application/json")
+  }
+
+  resp, err := c.http.Do(req)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+
+  data, err := ioutil.ReadAll(resp.Body)
+  if err != nil {
+    return nil, err
+  }
+
+  if resp.StatusCode != http.StatusOK {
+    var e struct {
+      Error string `json:"error"`
+    }
+    if json.Unmarshal(data, &e) == nil && e.Error != "" {
+      return nil, fmt.Errorf("%s: %s", resp.Status, e.Error)
+    }
+    return nil, fmt.Errorf("%s", resp.Status)
+  }
+
+  return data, nil
+}
+
+func (c *client) printJSON(method, path string, body interface{}) error {
+  data, err := c.do(method, path, body)
+  if err != nil {
+    return err
+  }
+  os.Stdout.Write(data)
+  return nil
+}
+
+func (c *client) printPlayers() error {
+  data, err := c.do("GET", "/players", nil)
+  if err != nil {
+    return err
+  }
+
+  var plrs []struct {
+    Id    string `json:"id"`
+    Name  string `json:"name"`
+    Ip    string `json:"ip"`
+    State string `json:"state"`
+    X     uint16 `json:"x"`
+    Y     uint16 `json:"y"`
+    Sim   string `json:"sim"`
+    Rtt   int64  `json:"rtt"`
+  }
+  if err = json.Unmarshal(data, &plrs); err != nil {
+    return err
+  }
+
+  tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+  fmt.Fprintln(tw, "ID\tNAME\tIP\tSTATE\tX\tY\tSIM\tRTT")
+  for _, p := range plrs {
+    fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%dms\n", p.Id, p.Name, p.Ip, p.State, p.X, p.Y, p.Sim, p.Rtt)
+  }
+  return tw.Flush()
+}
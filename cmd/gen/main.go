@@ -6,9 +6,11 @@ import(
   "compress/zlib"
   "fmt"
   "flag"
+  "sync"
+  "runtime"
 
-  "github.com/ojrac/opensimplex-go"
   "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/gen"
 )
 
 // 512 x 512 means chunk id can be uint16
@@ -21,6 +23,10 @@ func main() {
   flagSeed := flag.Uint64("seed", 209323094, "Seed for noise generation")
   flagThreshold := flag.Float64("threshold", 0.36, "Threshold for empty blocks")
   flagClean := flag.Bool("clean", false, "Clean but do not generate map.")
+  flagProfile := flag.String("profile", "", "Generator profile file (json). Overrides threshold.")
+  flagImage := flag.String("image", "", "Build the map from a PNG instead of noise. Overrides size, seed and threshold.")
+  flagPalette := flag.String("palette", "", "Palette file (json) mapping image colours to blocks.")
+  flagWorkers := flag.Int("workers", runtime.NumCPU(), "Number of files to generate at once.")
 
   flag.Parse()
 
@@ -49,68 +55,87 @@ func main() {
 
   cleanOnly := *flagClean
 
-  fmt.Printf("%v", info)
-
-  fmt.Printf("\nCleaning out %s...", dir)
-  cleanFiles(dir)
-
-  if (cleanOnly) {
-    return
+  workers := *flagWorkers
+  if workers < 1 {
+    workers = 1
   }
 
-  fmt.Printf("\nGenerating noise...")
-  noise := opensimplex.New(int64(info.Seed))
-
-  fmt.Printf("\nGenerating map...\r\n")
-  var fileId uint32
-
-  // chunk coordinate in world space
-  var chunkX uint32
-  var chunkY uint32
-  var chunkId uint32
-  var fileChunkId uint32
+  profile := gen.DefaultGenProfile(info.Threshold)
+  if *flagProfile != "" {
+    var errProfile error
+    profile, errProfile = gen.LoadGenProfile(*flagProfile)
+    if errProfile != nil {
+      fmt.Println(errProfile)
+      return
+    }
+    info.Threshold = profile.Biomes[0].Threshold
+  }
 
-  // block coordinate in chunk space
-  var x uint32
-  var y uint32
+  var source gen.BlockSource
+  if *flagImage != "" {
+    palette := gen.DefaultPalette()
+    if *flagPalette != "" {
+      var errPalette error
+      palette, errPalette = gen.LoadPalette(*flagPalette)
+      if errPalette != nil {
+        fmt.Println(errPalette)
+        return
+      }
+    }
 
-  // block coordinate in world space
-  var xCoord uint32
-  var yCoord uint32
+    fmt.Printf("\nLoading %s...", *flagImage)
+    imageSource, errImage := gen.LoadImageSource(*flagImage, palette)
+    if errImage != nil {
+      fmt.Println(errImage)
+      return
+    }
 
-  var fileIdx uint32
+    // pad the map out to whole chunks and files.
+    size, errSize := imageSource.MapSize(info.ChunkSize, info.ChunksPerFile)
+    if errSize != nil {
+      fmt.Println(errSize)
+      return
+    }
+    info.Size = size
+    info.NumFiles = (info.Size * info.Size) / info.ChunksPerFile
+    info.Seed = 0
+    info.Threshold = 0
+
+    width, height := imageSource.Bounds()
+    fmt.Printf("\n%dx%d image padded to %dx%d blocks\n", width, height, info.Size * info.ChunkSize, info.Size * info.ChunkSize)
+    source = imageSource
+  }
 
-  chunkId = 0
+  fmt.Printf("%v", info)
 
-  fileBytes := make([]byte, info.BlocksPerFile)
+  fmt.Printf("\nCleaning out %s...", dir)
+  cleanFiles(dir)
 
-  for fileId = 0; fileId < info.NumFiles; fileId++ {
-    fileIdx = 0
-    for fileChunkId = 0; fileChunkId < info.ChunksPerFile; fileChunkId++ {
-      chunkX = chunkId % info.Size
-      chunkY = chunkId / info.Size
+  if (cleanOnly) {
+    return
+  }
 
-      for y = 0; y < info.ChunkSize; y++ {
-        for x = 0; x < info.ChunkSize; x++ {
-          xCoord = (chunkX * info.ChunkSize) + x
-          yCoord = (chunkY * info.ChunkSize) + y
-          noiseVal := noise.Eval2(float64(xCoord) * 0.05, float64(yCoord) * 0.05)
+  if source == nil {
+    fmt.Printf("\nGenerating noise...")
+    source = gen.NewGenerator(info, profile)
+  }
 
-          if noiseVal > info.Threshold {
-            fileBytes[fileIdx] = 1
-          } else {
-            fileBytes[fileIdx] = 0
-          }
-          fileIdx++
-        }
-      }
-      chunkId++
-    }
+  spawnZones := profile.SpawnZones
+  if len(spawnZones) == 0 {
+    spawnZones = gen.DefaultSpawnZones(info)
+  }
 
-    fileBytesCopy := fileBytes
-    writeChunksToFile(fileBytesCopy, fmt.Sprintf("%s/%03d.chunks", dir, fileId))
-    fmt.Printf("\r%d/%d", fileId, info.NumFiles)
+  var errSpawn error
+  fmt.Printf("\nFinding spawn points...")
+  info.SpawnPoints, errSpawn = gen.FindSpawnPoints(info, source, spawnZones)
+  if errSpawn != nil {
+    fmt.Println(errSpawn)
+    return
   }
+  fmt.Printf(" %d found", len(info.SpawnPoints))
+
+  fmt.Printf("\nGenerating map with %d workers...\r\n", workers)
+  generateFiles(source, info, dir, workers)
 
   metaFile, err := os.Create(fmt.Sprintf("%s/meta.chunks", dir))
   if err != nil {
@@ -130,6 +155,43 @@ func main() {
   fmt.Printf("\nDone.\n")
 }
 
+// Each worker generates and writes whole files.
+// Files only depend on their id and the seed,
+// so output is identical to generating them one at a time.
+func generateFiles(source gen.BlockSource, info world.WorldInfo, dir string, workers int) {
+  fileIds := make(chan uint32, workers)
+  done := make(chan uint32, workers)
+
+  var wg sync.WaitGroup
+  for i := 0; i < workers; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      fileBytes := make([]byte, info.BlocksPerFile)
+      for fileId := range fileIds {
+        gen.FillFile(info, source, fileId, fileBytes)
+        writeChunksToFile(fileBytes, fmt.Sprintf("%s/%03d.chunks", dir, fileId))
+        done <- fileId
+      }
+    }()
+  }
+
+  go func() {
+    for fileId := uint32(0); fileId < info.NumFiles; fileId++ {
+      fileIds <- fileId
+    }
+    close(fileIds)
+    wg.Wait()
+    close(done)
+  }()
+
+  finished := 0
+  for range done {
+    finished++
+    fmt.Printf("\r%d/%d", finished, info.NumFiles)
+  }
+}
+
 func cleanFiles(dir string) {
   files, err := filepath.Glob(filepath.Join(dir, "*.chunks"))
   if err != nil {
@@ -0,0 +1,55 @@
+package main
+
+import(
+  "fmt"
+  "bytes"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/gen"
+)
+
+// Files written by several workers are byte for byte
+// the ones written by one.
+func TestParallelMatchesSerial(t *testing.T) {
+  var info world.WorldInfo
+  info.ChunksPerFile = 4
+  info.ChunkSize = 16
+  info.Size = 8
+  info.BlocksPerChunk = info.ChunkSize * info.ChunkSize
+  info.BlocksPerFile = info.BlocksPerChunk * info.ChunksPerFile
+  info.NumFiles = (info.Size * info.Size) / info.ChunksPerFile
+  info.Seed = 209323094
+  info.Threshold = 0.36
+
+  source := gen.NewGenerator(info, gen.DefaultGenProfile(info.Threshold))
+
+  serial := t.TempDir()
+  parallel := t.TempDir()
+  generateFiles(source, info, serial, 1)
+  generateFiles(source, info, parallel, 5)
+
+  var first []byte
+  for fileId := uint32(0); fileId < info.NumFiles; fileId++ {
+    name := fmt.Sprintf("%03d.chunks", fileId)
+    want, err := ioutil.ReadFile(filepath.Join(serial, name))
+    if err != nil {
+      t.Fatal(err)
+    }
+    got, err := ioutil.ReadFile(filepath.Join(parallel, name))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if !bytes.Equal(got, want) {
+      t.Fatalf("%s differs between 1 and 5 workers", name)
+    }
+
+    if fileId == 0 {
+      first = want
+    } else if bytes.Equal(want, first) {
+      t.Fatalf("%s is the same as file 0", name)
+    }
+  }
+}
@@ -0,0 +1,115 @@
+package main
+
+import(
+  "time"
+
+  "go-space-serv/pkg/client"
+)
+
+// One headless player. Enters as soon as the SIM welcomes it,
+// then sends input every timestep and a SYNC every syncRate,
+// timing how long the SIM takes to answer it.
+type bot struct {
+  world     string
+  opts      client.Options
+  timestep  time.Duration
+  syncRate  time.Duration
+  input     pattern
+  results   *results
+
+  finished  chan struct{}
+}
+
+func (b *bot) wait() {
+  <-b.finished
+}
+
+func (b *bot) run(stop chan struct{}) {
+  defer close(b.finished)
+
+  began := time.Now()
+  c, err := client.Dial(b.world, b.opts)
+  if err != nil {
+    b.results.failed(err)
+    return
+  }
+
+  welcomed := false
+  entered := false
+  var syncSent time.Time
+  var simTick uint16
+  var simTickAt time.Time
+  var rtt time.Duration
+  var chunkBytes uint64
+
+  timeout := time.NewTimer(b.opts.HandshakeTimeout + 5 * time.Second)
+  defer timeout.Stop()
+  inputs := time.NewTicker(b.timestep)
+  defer inputs.Stop()
+  syncs := time.NewTicker(b.syncRate)
+  defer syncs.Stop()
+
+  stopping := stop
+  events := c.Events()
+  for events != nil {
+    select {
+      case <-stopping:
+        stopping = nil
+        c.Close()
+      case <-timeout.C:
+        if !welcomed {
+          b.results.failed(errNoWelcome)
+          c.Close()
+        }
+      case <-inputs.C:
+        if entered {
+          // the frame the SIM is on when this arrives
+          ticks := (time.Since(simTickAt) + rtt / 2) / b.timestep
+          c.MoveShoot(simTick + uint16(ticks), b.input.next(b.timestep))
+        }
+      case <-syncs.C:
+        if welcomed && syncSent.IsZero() && c.Sync() == nil {
+          syncSent = time.Now()
+        }
+      case e, ok := <-events:
+        if !ok {
+          events = nil
+          break
+        }
+
+        switch t := e.(type) {
+          case client.WelcomeEvent:
+            if !welcomed {
+              welcomed = true
+              b.results.connected(time.Since(began))
+            }
+            c.Enter()
+            if c.Sync() == nil {
+              syncSent = time.Now()
+            }
+          case client.EnterEvent:
+            if t.PlayerId == c.Id() {
+              entered = true
+            }
+          case client.SyncEvent:
+            simTick = t.Seq
+            simTickAt = time.Now()
+            if !syncSent.IsZero() {
+              rtt = time.Since(syncSent)
+              b.results.rtt(rtt)
+              syncSent = time.Time{}
+            }
+          case client.BlocksEvent:
+            chunkBytes += uint64(len(t.Data))
+          case client.DisconnectEvent, client.SimLostEvent:
+            entered = false
+          case client.ClosedEvent:
+            if t.Err != nil && welcomed && stopping != nil {
+              b.results.dropped(t.Err)
+            }
+        }
+    }
+  }
+
+  b.results.finished(c.Stats(), chunkBytes)
+}
@@ -0,0 +1,139 @@
+package main
+
+import(
+  "os"
+  "fmt"
+  "flag"
+  "time"
+  "sync"
+  "math/rand"
+  "os/signal"
+  "syscall"
+
+  "go-space-serv/pkg/client"
+)
+
+// Runs headless bots against a local WORLD and SIM and reports
+// how the servers hold up.
+//
+//   loadtest --bots=200 --rampUp=20s --duration=2m --pattern=random --simMetrics=127.0.0.1:9499
+
+func main() {
+  world := flag.String("world", "127.0.0.1:9494", "WORLD address")
+  bots := flag.Int("bots", 10, "number of bots")
+  rampUp := flag.Duration("rampUp", 10 * time.Second, "time over which bots are started")
+  duration := flag.Duration("duration", time.Minute, "how long to run after the last bot started")
+  pattern := flag.String("pattern", "random", "input pattern, random, circle or script")
+  script := flag.String("script", "", "input script for --pattern=script, lines of <millis> <controls>")
+  syncRate := flag.Duration("syncRate", time.Second, "how often each bot measures rtt with SYNC")
+  timestep := flag.Duration("timestep", 33 * time.Millisecond, "SIM timestep, for the tick bots send input for")
+  simMetrics := flag.String("simMetrics", "", "SIM metrics address to read tick lag from, empty to skip")
+  report := flag.Duration("report", 5 * time.Second, "how often to print progress")
+  seed := flag.Int64("seed", 0, "random seed, 0 picks one")
+  protocolId := flag.Uint("protocolId", 3551548956, "must match the servers")
+  maxMsgSize := flag.Int("maxMsgSize", 1024, "must match the servers")
+  flag.Parse()
+
+  if *bots < 1 {
+    fmt.Fprintln(os.Stderr, "need at least one bot")
+    os.Exit(2)
+  }
+
+  if *seed == 0 {
+    *seed = time.Now().UnixNano()
+  }
+  rng := rand.New(rand.NewSource(*seed))
+
+  var steps []step
+  if *pattern == "script" {
+    var err error
+    if steps, err = loadScript(*script); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(2)
+    }
+  } else if *pattern != "random" && *pattern != "circle" {
+    fmt.Fprintf(os.Stderr, "unknown pattern %q, want random, circle or script\n", *pattern)
+    os.Exit(2)
+  }
+
+  opts := client.DefaultOptions()
+  opts.ProtocolId = uint32(*protocolId)
+  opts.MaxMsgSize = *maxMsgSize
+
+  var r results
+  var lag *tickLag
+  if *simMetrics != "" {
+    lag = newTickLag(*simMetrics)
+  }
+
+  fmt.Printf("%d bots against %s, %s ramp-up, %s run, pattern %s, seed %d\n",
+    *bots, *world, *rampUp, *duration, *pattern, *seed)
+
+  stop := make(chan struct{})
+  var stopOnce sync.Once
+  go func() {
+    interrupt := make(chan os.Signal, 1)
+    signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+    <-interrupt
+    fmt.Println("interrupted, stopping bots")
+    stopOnce.Do(func() { close(stop) })
+  }()
+
+  all := make([]*bot, 0, *bots)
+  start := time.Now()
+  spacing := *rampUp / time.Duration(*bots)
+  ticker := time.NewTicker(*report)
+  defer ticker.Stop()
+
+  end := start.Add(*rampUp + *duration)
+  next := start
+  running := true
+  for running {
+    if len(all) < *bots && !time.Now().Before(next) {
+      var b bot
+      b.world = *world
+      b.opts = opts
+      b.opts.Name = fmt.Sprintf("bot-%d", len(all))
+      b.timestep = *timestep
+      b.syncRate = *syncRate
+      b.input = newPattern(*pattern, steps, rng.Int63())
+      b.results = &r
+      b.finished = make(chan struct{})
+      all = append(all, &b)
+      go b.run(stop)
+      next = next.Add(spacing)
+    }
+
+    wait := time.Until(next)
+    if len(all) == *bots {
+      wait = time.Until(end)
+    }
+    if wait < 0 {
+      wait = 0
+    }
+
+    select {
+      case <-stop:
+        running = false
+      case <-ticker.C:
+        if lag != nil {
+          lag.sample()
+        }
+        r.progress(time.Since(start), len(all), lag)
+      case <-time.After(wait):
+        if len(all) == *bots && !time.Now().Before(end) {
+          running = false
+        }
+    }
+  }
+
+  stopOnce.Do(func() { close(stop) })
+
+  if lag != nil {
+    lag.sample()
+  }
+  for _, b := range all {
+    b.wait()
+  }
+  r.summary(time.Since(start), len(all), lag)
+}
@@ -0,0 +1,156 @@
+package main
+
+import(
+  "os"
+  "fmt"
+  "time"
+  "bufio"
+  "strconv"
+  "strings"
+  "math/rand"
+
+  "go-space-serv/pkg/client"
+)
+
+// Controls a bot holds down, asked for once per timestep.
+type pattern interface {
+  next(dt time.Duration) byte
+}
+
+// Holds random controls for a random 0.2 to 2 seconds.
+type randomPattern struct {
+  rng   *rand.Rand
+  bits  byte
+  left  time.Duration
+}
+
+func (p *randomPattern) next(dt time.Duration) byte {
+  p.left -= dt
+  if p.left <= 0 {
+    p.bits = byte(p.rng.Intn(16))
+    p.left = time.Duration(200 + p.rng.Intn(1800)) * time.Millisecond
+  }
+  return p.bits
+}
+
+// Thrust while turning, so the ship flies in circles.
+type circlePattern struct {
+  bits  byte
+}
+
+func (p *circlePattern) next(dt time.Duration) byte {
+  return p.bits
+}
+
+type step struct {
+  length  time.Duration
+  bits    byte
+}
+
+// Steps from a script, over and over.
+type scriptPattern struct {
+  steps []step
+  at    int
+  left  time.Duration
+}
+
+func (p *scriptPattern) next(dt time.Duration) byte {
+  p.left -= dt
+  for p.left <= 0 {
+    p.at = (p.at + 1) % len(p.steps)
+    p.left += p.steps[p.at].length
+  }
+  return p.steps[p.at].bits
+}
+
+func newPattern(name string, steps []step, seed int64) pattern {
+  rng := rand.New(rand.NewSource(seed))
+  switch name {
+    case "circle":
+      // not all turning the same way
+      turn := client.LEFT
+      if rng.Intn(2) == 0 {
+        turn = client.RIGHT
+      }
+      return &circlePattern{bits: client.FORWARD | turn}
+    case "script":
+      // start somewhere in the script so bots aren't in lockstep
+      at := rng.Intn(len(steps))
+      return &scriptPattern{steps: steps, at: at, left: steps[at].length}
+    default:
+      return &randomPattern{rng: rng}
+  }
+}
+
+// A script has one step per line, how long in millis and which controls:
+//
+//   # forward, then turn
+//   1000 forward
+//   500 forward+left
+//   250 none
+func loadScript(path string) ([]step, error) {
+  if path == "" {
+    return nil, fmt.Errorf("--pattern=script needs --script")
+  }
+
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  var steps []step
+  scanner := bufio.NewScanner(f)
+  line := 0
+  for scanner.Scan() {
+    line++
+    text := strings.TrimSpace(scanner.Text())
+    if text == "" || strings.HasPrefix(text, "#") {
+      continue
+    }
+
+    fields := strings.Fields(text)
+    if len(fields) != 2 {
+      return nil, fmt.Errorf("%s:%d: want <millis> <controls>", path, line)
+    }
+
+    millis, err := strconv.Atoi(fields[0])
+    if err != nil || millis <= 0 {
+      return nil, fmt.Errorf("%s:%d: bad millis %q", path, line, fields[0])
+    }
+
+    bits, err := parseControls(fields[1])
+    if err != nil {
+      return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+    }
+    steps = append(steps, step{time.Duration(millis) * time.Millisecond, bits})
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+
+  if len(steps) == 0 {
+    return nil, fmt.Errorf("%s: no steps", path)
+  }
+  return steps, nil
+}
+
+func parseControls(s string) (byte, error) {
+  var bits byte
+  for _, name := range strings.Split(s, "+") {
+    switch name {
+      case "none":
+      case "left":
+        bits |= client.LEFT
+      case "right":
+        bits |= client.RIGHT
+      case "forward":
+        bits |= client.FORWARD
+      case "backward":
+        bits |= client.BACKWARD
+      default:
+        return 0, fmt.Errorf("unknown control %q, want none, left, right, forward or backward", name)
+    }
+  }
+  return bits, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import(
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+  "bufio"
+  "errors"
+  "strconv"
+  "strings"
+  "net/http"
+
+  "go-space-serv/pkg/client"
+)
+
+var errNoWelcome = errors.New("no welcome from the simulation")
+
+// What the bots saw, shared by all of them.
+type results struct {
+  lock        sync.Mutex
+  connects    []time.Duration
+  failures    map[string]int
+  drops       map[string]int
+  rtts        []time.Duration
+  recentRtts  []time.Duration
+  done        int
+  stats       client.Stats
+  chunkBytes  uint64
+}
+
+func (r *results) connected(d time.Duration) {
+  r.lock.Lock()
+  r.connects = append(r.connects, d)
+  r.lock.Unlock()
+}
+
+func (r *results) failed(err error) {
+  r.lock.Lock()
+  if r.failures == nil {
+    r.failures = map[string]int{}
+  }
+  r.failures[err.Error()]++
+  r.lock.Unlock()
+}
+
+func (r *results) dropped(err error) {
+  r.lock.Lock()
+  if r.drops == nil {
+    r.drops = map[string]int{}
+  }
+  r.drops[err.Error()]++
+  r.lock.Unlock()
+}
+
+func (r *results) rtt(d time.Duration) {
+  r.lock.Lock()
+  r.rtts = append(r.rtts, d)
+  r.recentRtts = append(r.recentRtts, d)
+  r.lock.Unlock()
+}
+
+func (r *results) finished(s client.Stats, chunkBytes uint64) {
+  r.lock.Lock()
+  r.done++
+  r.stats.WorldBytesIn += s.WorldBytesIn
+  r.stats.UDPPacketsIn += s.UDPPacketsIn
+  r.stats.UDPBytesIn += s.UDPBytesIn
+  r.stats.UDPPacketsOut += s.UDPPacketsOut
+  r.stats.UDPBytesOut += s.UDPBytesOut
+  r.stats.SimMsgsIn += s.SimMsgsIn
+  r.stats.SimMsgsLost += s.SimMsgsLost
+  r.chunkBytes += chunkBytes
+  r.lock.Unlock()
+}
+
+func (r *results) progress(elapsed time.Duration, started int, lag *tickLag) {
+  r.lock.Lock()
+  recent := r.recentRtts
+  r.recentRtts = nil
+  line := fmt.Sprintf("%6s  bots %d  connected %d  failed %d  rtt p50 %s p99 %s",
+    elapsed.Round(time.Second), started, len(r.connects), count(r.failures),
+    percentile(recent, 50), percentile(recent, 99))
+  r.lock.Unlock()
+
+  if lag != nil {
+    line += fmt.Sprintf("  frames behind %.0f", lag.last)
+  }
+  fmt.Println(line)
+}
+
+func (r *results) summary(elapsed time.Duration, started int, lag *tickLag) {
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  fmt.Printf("\nran %s with %d bots\n", elapsed.Round(time.Second), started)
+
+  fmt.Printf("connect   %d ok, %d failed, %d dropped later\n", len(r.connects), count(r.failures), count(r.drops))
+  for reason, n := range r.failures {
+    fmt.Printf("          %d failed: %s\n", n, reason)
+  }
+  for reason, n := range r.drops {
+    fmt.Printf("          %d dropped: %s\n", n, reason)
+  }
+  if len(r.connects) > 0 {
+    fmt.Printf("          handshake p50 %s p99 %s max %s\n",
+      percentile(r.connects, 50), percentile(r.connects, 99), percentile(r.connects, 100))
+  }
+
+  if len(r.rtts) > 0 {
+    fmt.Printf("rtt       p50 %s p90 %s p99 %s max %s over %d syncs\n",
+      percentile(r.rtts, 50), percentile(r.rtts, 90), percentile(r.rtts, 99), percentile(r.rtts, 100), len(r.rtts))
+  } else {
+    fmt.Printf("rtt       no syncs answered\n")
+  }
+
+  s := r.stats
+  loss := 0.0
+  if s.SimMsgsIn + s.SimMsgsLost > 0 {
+    loss = 100 * float64(s.SimMsgsLost) / float64(s.SimMsgsIn + s.SimMsgsLost)
+  }
+  fmt.Printf("loss      %.2f%% of SIM messages, %d of %d\n", loss, s.SimMsgsLost, s.SimMsgsIn + s.SimMsgsLost)
+  fmt.Printf("udp       %d packets %s in, %d packets %s out\n",
+    s.UDPPacketsIn, bytes(s.UDPBytesIn), s.UDPPacketsOut, bytes(s.UDPBytesOut))
+  fmt.Printf("world     %s in, %s of it chunks\n", bytes(s.WorldBytesIn), bytes(r.chunkBytes))
+
+  if lag != nil {
+    lag.summary()
+  }
+}
+
+// Tick lag as SIM reports it on its metrics endpoint.
+type tickLag struct {
+  url         string
+  samples     int
+  behindSum   float64
+  behindMax   float64
+  last        float64
+  firstSum    float64
+  firstCount  float64
+  lastSum     float64
+  lastCount   float64
+  err         error
+}
+
+func newTickLag(addr string) *tickLag {
+  var l tickLag
+  l.url = "http://" + addr + "/metrics"
+  return &l
+}
+
+func (l *tickLag) sample() {
+  values, err := scrape(l.url, "space_sim_frames_behind", "space_sim_frame_seconds_sum", "space_sim_frame_seconds_count")
+  if err != nil {
+    l.err = err
+    return
+  }
+
+  behind := values["space_sim_frames_behind"]
+  l.last = behind
+  l.behindSum += behind
+  if behind > l.behindMax {
+    l.behindMax = behind
+  }
+  if l.samples == 0 {
+    l.firstSum = values["space_sim_frame_seconds_sum"]
+    l.firstCount = values["space_sim_frame_seconds_count"]
+  }
+  l.lastSum = values["space_sim_frame_seconds_sum"]
+  l.lastCount = values["space_sim_frame_seconds_count"]
+  l.samples++
+}
+
+func (l *tickLag) summary() {
+  if l.samples == 0 {
+    fmt.Printf("tick lag  couldn't read SIM metrics: %v\n", l.err)
+    return
+  }
+
+  fmt.Printf("tick lag  frames behind mean %.2f max %.0f over %d samples\n", l.behindSum / float64(l.samples), l.behindMax, l.samples)
+  if frames := l.lastCount - l.firstCount; frames > 0 {
+    frame := time.Duration((l.lastSum - l.firstSum) / frames * float64(time.Second))
+    fmt.Printf("          %s per frame over %.0f frames\n", frame, frames)
+  }
+}
+
+// Values of the named samples from a prometheus text page.
+func scrape(url string, names ...string) (map[string]float64, error) {
+  resp, err := http.Get(url)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("%s: %s", url, resp.Status)
+  }
+
+  values := map[string]float64{}
+  scanner := bufio.NewScanner(resp.Body)
+  for scanner.Scan() {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) != 2 {
+      continue
+    }
+    for _, name := range names {
+      if fields[0] == name {
+        if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+          values[name] = v
+        }
+      }
+    }
+  }
+  return values, scanner.Err()
+}
+
+// p of 0 to 100, sorting ds.
+func percentile(ds []time.Duration, p int) time.Duration {
+  if len(ds) == 0 {
+    return 0
+  }
+  sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+  i := (len(ds) - 1) * p / 100
+  return ds[i].Round(10 * time.Microsecond)
+}
+
+func count(m map[string]int) int {
+  n := 0
+  for _, v := range m {
+    n += v
+  }
+  return n
+}
+
+func bytes(n uint64) string {
+  switch {
+    case n >= 1 << 30:
+      return fmt.Sprintf("%.1fGiB", float64(n) / (1 << 30))
+    case n >= 1 << 20:
+      return fmt.Sprintf("%.1fMiB", float64(n) / (1 << 20))
+    case n >= 1 << 10:
+      return fmt.Sprintf("%.1fKiB", float64(n) / (1 << 10))
+  }
+  return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,271 @@
+package main
+
+import(
+  "os"
+  "fmt"
+  "flag"
+  "image"
+  "image/color"
+  "image/png"
+  "path/filepath"
+
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/gen"
+)
+
+var gridColor = color.RGBA{40, 40, 40, 255}
+var fileColor = color.RGBA{0, 160, 255, 255}
+var spawnColor = color.RGBA{0, 255, 0, 255}
+
+type mapView struct {
+  info    world.WorldInfo
+  dir     string
+  scale   uint32
+  palette *gen.Palette
+
+  // chunk range, inclusive min, exclusive max
+  minX    uint32
+  minY    uint32
+  maxX    uint32
+  maxY    uint32
+
+  img     *image.RGBA
+}
+
+func main() {
+  flagOut := flag.String("out", "map.png", "PNG file to write")
+  flagScale := flag.Uint("scale", 16, "Blocks per pixel. Must divide chunk size.")
+  flagMinX := flag.Uint("minx", 0, "First chunk column to draw")
+  flagMinY := flag.Uint("miny", 0, "First chunk row to draw")
+  flagMaxX := flag.Uint("maxx", 0, "Chunk column to stop before. 0 means map size.")
+  flagMaxY := flag.Uint("maxy", 0, "Chunk row to stop before. 0 means map size.")
+  flagSpawn := flag.Bool("spawn", false, "Mark the spawn point")
+  flagGrid := flag.Bool("grid", false, "Draw chunk boundaries")
+  flagFiles := flag.Bool("files", false, "Draw file boundaries")
+  flagPalette := flag.String("palette", "", "Palette file (json) mapping blocks to colours")
+
+  flag.Parse()
+
+  dir := flag.Arg(0)
+
+  if dir == "" {
+    flag.PrintDefaults()
+    return
+  }
+
+  info, err := world.ReadWorldInfo(filepath.Join(dir, "meta.chunks"))
+  if err != nil {
+    fmt.Println(err)
+    return
+  }
+  fmt.Printf("%v", info)
+
+  var mv mapView
+  mv.info = info
+  mv.dir = dir
+  mv.scale = uint32(*flagScale)
+  mv.palette = gen.DefaultPalette()
+  if *flagPalette != "" {
+    mv.palette, err = gen.LoadPalette(*flagPalette)
+    if err != nil {
+      fmt.Println(err)
+      return
+    }
+  }
+  mv.minX = uint32(*flagMinX)
+  mv.minY = uint32(*flagMinY)
+  mv.maxX = uint32(*flagMaxX)
+  mv.maxY = uint32(*flagMaxY)
+  if mv.maxX == 0 || mv.maxX > info.Size { mv.maxX = info.Size }
+  if mv.maxY == 0 || mv.maxY > info.Size { mv.maxY = info.Size }
+
+  if mv.scale == 0 || info.ChunkSize % mv.scale != 0 {
+    fmt.Printf("\nscale %d does not divide chunk size %d\n", mv.scale, info.ChunkSize)
+    return
+  }
+
+  if mv.minX >= mv.maxX || mv.minY >= mv.maxY {
+    fmt.Printf("\nempty chunk range %d/%d - %d/%d\n", mv.minX, mv.minY, mv.maxX, mv.maxY)
+    return
+  }
+
+  pxPerChunk := int(info.ChunkSize / mv.scale)
+  width := int(mv.maxX - mv.minX) * pxPerChunk
+  height := int(mv.maxY - mv.minY) * pxPerChunk
+  mv.img = image.NewRGBA(image.Rect(0, 0, width, height))
+
+  fmt.Printf("\nDrawing %dx%d...\r\n", width, height)
+  if err = mv.drawBlocks(); err != nil {
+    fmt.Println(err)
+    return
+  }
+
+  if *flagGrid {
+    mv.drawGrid()
+  }
+
+  if *flagFiles {
+    mv.drawFiles()
+  }
+
+  if *flagSpawn {
+    mv.drawSpawn()
+  }
+
+  f, err := os.Create(*flagOut)
+  if err != nil {
+    fmt.Println(err)
+    return
+  }
+  defer f.Close()
+
+  if err = png.Encode(f, mv.img); err != nil {
+    fmt.Println(err)
+    return
+  }
+
+  fmt.Printf("\nWrote %s\n", *flagOut)
+}
+
+// Only files containing chunks in range are loaded,
+// one at a time to keep memory down.
+func (mv *mapView) drawBlocks() error {
+  info := mv.info
+  firstFile := (mv.minY * info.Size + mv.minX) / info.ChunksPerFile
+  lastFile := ((mv.maxY - 1) * info.Size + (mv.maxX - 1)) / info.ChunksPerFile
+
+  for fileId := firstFile; fileId <= lastFile; fileId++ {
+    fileBytes, err := world.ReadChunkFile(filepath.Join(mv.dir, fmt.Sprintf("%03d.chunks", fileId)))
+    if err != nil {
+      return err
+    }
+
+    for fileChunkId := uint32(0); fileChunkId < info.ChunksPerFile; fileChunkId++ {
+      chunkId := fileId * info.ChunksPerFile + fileChunkId
+      chunkX := chunkId % info.Size
+      chunkY := chunkId / info.Size
+      if chunkX < mv.minX || chunkX >= mv.maxX || chunkY < mv.minY || chunkY >= mv.maxY {
+        continue
+      }
+
+      chunkStart := fileChunkId * info.BlocksPerChunk
+      mv.drawChunk(chunkX, chunkY, fileBytes[chunkStart:chunkStart + info.BlocksPerChunk])
+    }
+
+    fmt.Printf("\r%d/%d", fileId - firstFile + 1, lastFile - firstFile + 1)
+  }
+
+  return nil
+}
+
+// Each pixel takes the most common block type
+// in the scale x scale square it covers.
+func (mv *mapView) drawChunk(chunkX, chunkY uint32, blocks []byte) {
+  chunkSize := mv.info.ChunkSize
+  pxPerChunk := chunkSize / mv.scale
+  originX := int((chunkX - mv.minX) * pxPerChunk)
+  originY := int((chunkY - mv.minY) * pxPerChunk)
+  var counts [256]int
+
+  for py := uint32(0); py < pxPerChunk; py++ {
+    for px := uint32(0); px < pxPerChunk; px++ {
+      for i := range counts {
+        counts[i] = 0
+      }
+
+      for y := py * mv.scale; y < (py + 1) * mv.scale; y++ {
+        for x := px * mv.scale; x < (px + 1) * mv.scale; x++ {
+          counts[blocks[y * chunkSize + x]]++
+        }
+      }
+
+      best := 0
+      for i := range counts {
+        if counts[i] > counts[best] {
+          best = i
+        }
+      }
+
+      mv.img.SetRGBA(originX + int(px), originY + int(py), mv.palette.ColorOf(world.BlockType(best)))
+    }
+  }
+}
+
+func (mv *mapView) drawGrid() {
+  pxPerChunk := int(mv.info.ChunkSize / mv.scale)
+  bounds := mv.img.Bounds()
+
+  for x := 0; x < bounds.Max.X; x += pxPerChunk {
+    for y := 0; y < bounds.Max.Y; y++ {
+      mv.img.SetRGBA(x, y, gridColor)
+    }
+  }
+
+  for y := 0; y < bounds.Max.Y; y += pxPerChunk {
+    for x := 0; x < bounds.Max.X; x++ {
+      mv.img.SetRGBA(x, y, gridColor)
+    }
+  }
+}
+
+// Files are runs of chunk ids, so a boundary can start mid row.
+// Outline every chunk edge where the neighbour is in another file.
+func (mv *mapView) drawFiles() {
+  info := mv.info
+  pxPerChunk := int(info.ChunkSize / mv.scale)
+  fileOf := func(chunkX, chunkY uint32) uint32 {
+    return (chunkY * info.Size + chunkX) / info.ChunksPerFile
+  }
+
+  for chunkY := mv.minY; chunkY < mv.maxY; chunkY++ {
+    for chunkX := mv.minX; chunkX < mv.maxX; chunkX++ {
+      fileId := fileOf(chunkX, chunkY)
+      originX := int(chunkX - mv.minX) * pxPerChunk
+      originY := int(chunkY - mv.minY) * pxPerChunk
+
+      if chunkX > 0 && fileOf(chunkX - 1, chunkY) != fileId {
+        for i := 0; i < pxPerChunk; i++ {
+          mv.img.SetRGBA(originX, originY + i, fileColor)
+        }
+      }
+
+      if chunkY > 0 && fileOf(chunkX, chunkY - 1) != fileId {
+        for i := 0; i < pxPerChunk; i++ {
+          mv.img.SetRGBA(originX + i, originY, fileColor)
+        }
+      }
+    }
+  }
+}
+
+// Marks every spawn point stored in the map,
+// or the hardcoded one for maps that have none.
+func (mv *mapView) drawSpawn() {
+  spawnPoints := mv.info.SpawnPoints
+  if len(spawnPoints) == 0 {
+    spawnPoints = []world.SpawnPoint{{Team: 0, X: world.SPAWNX, Y: world.SPAWNY}}
+  }
+
+  minBlockX := int(mv.minX * mv.info.ChunkSize)
+  minBlockY := int(mv.minY * mv.info.ChunkSize)
+  drawn := 0
+
+  for _, sp := range spawnPoints {
+    x := (int(sp.X) - minBlockX) / int(mv.scale)
+    y := (int(sp.Y) - minBlockY) / int(mv.scale)
+
+    if !(image.Point{x, y}.In(mv.img.Bounds())) {
+      continue
+    }
+
+    for i := -4; i <= 4; i++ {
+      mv.img.SetRGBA(x + i, y, spawnColor)
+      mv.img.SetRGBA(x, y + i, spawnColor)
+    }
+    drawn++
+  }
+
+  if drawn == 0 {
+    fmt.Printf("\nNo spawn points in the drawn range.")
+  }
+}
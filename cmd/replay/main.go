@@ -0,0 +1,109 @@
+package main
+
+import(
+  "os"
+  "fmt"
+  "flag"
+  "bufio"
+
+  "go-space-serv/internal/space/sim"
+  "go-space-serv/internal/space/util"
+  "go-space-serv/internal/space/world"
+)
+
+// Runs a match SIM recorded with --record again and checks every
+// body ends up where it did in the match.
+//
+//   replay [--map=dir] [--frames=n] [--trajectory=file] recording
+//
+// Exits 1 if the replay went somewhere the match didn't.
+
+func main() {
+  mapDir := flag.String("map", "", "map the match was played on, defaults to the map dir in the recording")
+  frames := flag.Uint("frames", 0, "stop after this many frames, 0 for the whole recording")
+  trajectory := flag.String("trajectory", "", "write every body's state each frame to this csv file, - for stdout")
+  force := flag.Bool("force", false, "replay even if the map isn't the one recorded")
+  flag.Usage = func() {
+    fmt.Fprintf(flag.CommandLine.Output(), "usage: replay [flags] recording\n")
+    flag.PrintDefaults()
+  }
+  flag.Parse()
+
+  if flag.NArg() != 1 {
+    flag.Usage()
+    os.Exit(2)
+  }
+
+  rr, err := sim.OpenRecording(flag.Arg(0))
+  if err != nil {
+    fail(err)
+  }
+  defer rr.Close()
+  h := rr.Header
+
+  // InputToState reads the timestep from the config
+  config := helpers.DefaultConfig()
+  config.TIMESTEP = h.Timestep
+  config.TIMESTEP_NANO = h.TimestepNano
+  helpers.SetConfig(&config)
+
+  if *mapDir == "" {
+    *mapDir = h.Map.Dir
+  }
+  wm, err := world.NewWorldMap(*mapDir)
+  if err != nil {
+    fail(err)
+  }
+  if id := wm.Identity(); id.Fingerprint != h.Map.Fingerprint {
+    fmt.Fprintf(os.Stderr, "map %s (seed %d, size %d) isn't the recorded %s (seed %d, size %d)\n",
+      id.Name, id.Seed, id.Size, h.Map.Name, h.Map.Seed, h.Map.Size)
+    if !*force {
+      os.Exit(2)
+    }
+  }
+
+  fmt.Printf("recorded %s on %s, region %s, timestep %dms\n",
+    h.Started.Format("2006-01-02 15:04:05"), h.Map.Name, h.Region, h.Timestep)
+
+  replay := sim.NewReplay(rr, wm)
+  if *trajectory != "" {
+    out := os.Stdout
+    if *trajectory != "-" {
+      if out, err = os.Create(*trajectory); err != nil {
+        fail(err)
+      }
+      defer out.Close()
+    }
+    w := bufio.NewWriter(out)
+    defer w.Flush()
+
+    fmt.Fprintln(w, "frame,player,body,x,y,angle,vx,vy")
+    replay.OnFrame = func(frame uint32, bodies []sim.ReplayBody) {
+      for _, b := range bodies {
+        fmt.Fprintf(w, "%d,%s,%d,%g,%g,%g,%g,%g\n", frame, b.PlayerId, b.BodyId,
+          b.Position.X(), b.Position.Y(), b.Angle, b.Velocity.X(), b.Velocity.Y())
+      }
+    }
+  }
+
+  result, err := replay.Run(uint32(*frames))
+  if err != nil {
+    fail(err)
+  }
+
+  fmt.Printf("%d frames, %d enters, %d exits, %d inputs, %d checks\n",
+    result.Frames, result.Enters, result.Exits, result.Inputs, result.Checks)
+  if !result.Ended && *frames == 0 {
+    fmt.Println("recording has no end, SIM didn't shut down cleanly")
+  }
+  if result.Desync != 0 {
+    fmt.Printf("DESYNC: bodies differ from the match at frame %d\n", result.Desync)
+    os.Exit(1)
+  }
+  fmt.Println("ok: every check matched")
+}
+
+func fail(err error) {
+  fmt.Fprintln(os.Stderr, err)
+  os.Exit(2)
+}
@@ -0,0 +1,125 @@
+package main
+
+import(
+  "net"
+
+  "github.com/google/uuid"
+  "github.com/panjf2000/gnet"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/util"
+)
+
+// Which udp address belongs to which player.
+// WORLD only knows a player's ip, so the first HELLO from that ip binds
+// its port. A HELLO may name the player after the salt, which lets
+// several players share an ip, e.g. bots on one machine:
+//
+//   protocolId(4) HELLO clientSalt(8) playerId(16) padding
+//
+// Without it the HELLO goes to any player from that ip still waiting.
+
+type simClient struct {
+  ip    string
+  addr  string      // ip:port once bound
+  team  byte
+  stats player.PlayerStats
+  udp   *udp.UDPPlayer
+}
+
+// A player WORLD sent, replacing one with the same id from elsewhere.
+func (ps *physicsServer) expectPlayer(ip net.IP, id uuid.UUID, team byte, stats player.PlayerStats) {
+  plr := udp.NewPlayer(ps.simulation.GetPlayerChan(), id, &ps.msgFactory, ps.udpMetrics)
+
+  ps.bindLock.Lock()
+  if sc, ok := ps.clients.Load(id); ok && sc.(*simClient).addr != "" {
+    ps.addrsToClients.Delete(sc.(*simClient).addr)
+  }
+  ps.clients.Store(id, &simClient{ip: ip.String(), team: team, stats: stats, udp: plr})
+  ps.bindLock.Unlock()
+}
+
+func (ps *physicsServer) hasPlayer(ip net.IP, id uuid.UUID) bool {
+  sc, ok := ps.clients.Load(id)
+  return ok && sc.(*simClient).ip == ip.String()
+}
+
+// Team and ship WORLD sent with the player,
+// team 0 and the built in ship if it didn't.
+func (ps *physicsServer) shipOf(id uuid.UUID) (byte, player.PlayerStats) {
+  if sc, ok := ps.clients.Load(id); ok {
+    return sc.(*simClient).team, sc.(*simClient).stats
+  }
+  return 0, player.DefaultPlayerStats()
+}
+
+func (ps *physicsServer) removePlayer(id uuid.UUID) {
+  ps.bindLock.Lock()
+  if sc, ok := ps.clients.Load(id); ok {
+    if addr := sc.(*simClient).addr; addr != "" {
+      ps.addrsToClients.Delete(addr)
+    }
+    ps.clients.Delete(id)
+  }
+  ps.bindLock.Unlock()
+
+  ps.players.Remove(id)
+  ps.simulation.RemoveControlledBody(id)
+  ps.simulation.ForgetHandoff(id)
+}
+
+// Where packets to a client go, through the simulated network if there is one.
+func (ps *physicsServer) outbound(c gnet.Conn) transport.Transport {
+  t := transport.GnetUDP{Conn: c}
+  if ps.network == nil {
+    return t
+  }
+  return ps.network.Wrap(t)
+}
+
+// Player a packet from addr is for, binding addr on HELLO.
+func (ps *physicsServer) clientFor(addr *net.UDPAddr, packet []byte) *udp.UDPPlayer {
+  key := addr.String()
+  if sc, ok := ps.addrsToClients.Load(key); ok {
+    return sc.(*simClient).udp
+  }
+
+  if len(packet) < 13 || snet.Read_uint32(packet[0:4]) != helpers.GetProtocolId() || udp.UDPCmd(packet[4]) != udp.HELLO {
+    return nil
+  }
+
+  var id uuid.UUID
+  if len(packet) >= 29 {
+    copy(id[:], packet[13:29])
+  }
+  ip := addr.IP.String()
+
+  ps.bindLock.Lock()
+  defer ps.bindLock.Unlock()
+
+  var found *simClient
+  if id != uuid.Nil {
+    if sc, ok := ps.clients.Load(id); ok && sc.(*simClient).ip == ip && sc.(*simClient).addr == "" {
+      found = sc.(*simClient)
+    }
+  } else {
+    ps.clients.Range(func(key, value interface{}) bool {
+      sc := value.(*simClient)
+      if sc.ip == ip && sc.addr == "" {
+        found = sc
+        return false
+      }
+      return true
+    })
+  }
+
+  if found == nil {
+    return nil
+  }
+  found.addr = key
+  ps.addrsToClients.Store(key, found)
+  return found.udp
+}
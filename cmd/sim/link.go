@@ -0,0 +1,277 @@
+package main
+
+import(
+  "io"
+  "fmt"
+  "net"
+  "time"
+  "bufio"
+  "errors"
+  "crypto/rand"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+)
+
+// world server <-> physics server interaction
+// SIM keeps dialing WORLD until it gets through, and again
+// whenever the link drops. Players connected over udp are
+// kept and keep playing while the link is down.
+// Bodies leaving simRegion are handed to WORLD, which passes
+// them to the SIM owning the region they entered.
+
+const linkRetryMin time.Duration = 250 * time.Millisecond
+const linkRetryMax time.Duration = 10 * time.Second
+
+var linkLog = helpers.Logger("link")
+
+func (ps *physicsServer) worldTx() {
+  for m := range ps.toWorld {
+    frame, err := link.Encode(m)
+    if err != nil {
+      linkLog.Error("dropped msg for world", "cmd", m.GetCmd(), "err", err)
+      continue
+    }
+
+    ps.worldLock.Lock()
+    if ps.worldConnOpen {
+      ps.worldConn.Write(frame)
+    }
+    // otherwise dropped, WORLD catches up from the SyncMsg on reconnect.
+    ps.worldLock.Unlock()
+  }
+}
+
+func (ps *physicsServer) worldRx(raddr *net.TCPAddr) {
+  retry := linkRetryMin
+  for ps.state < snet.SHUTDOWN {
+    c, reader, err := ps.connectToWorld(raddr)
+    if err != nil {
+      linkLog.Warn("connecting to world failed", "err", err, "retry", retry)
+      time.Sleep(retry)
+      retry *= 2
+      if retry > linkRetryMax {
+        retry = linkRetryMax
+      }
+      continue
+    }
+    retry = linkRetryMin
+
+    ps.readWorld(c, reader)
+    ps.closeWorldConn()
+
+    if ps.state < snet.SHUTDOWN {
+      linkLog.Warn("lost world, reconnecting")
+      ps.state = snet.WAIT_WORLD
+    }
+  }
+}
+
+// Dial, authenticate and bring WORLD up to date.
+func (ps *physicsServer) connectToWorld(raddr *net.TCPAddr) (*net.TCPConn, *bufio.Reader, error) {
+  c, err := net.DialTCP("tcp", nil, raddr)
+  if err != nil {
+    return nil, nil, fmt.Errorf("couldnt find world server: %s", err)
+  }
+
+  c.SetNoDelay(true)
+  reader := bufio.NewReader(c)
+
+  if err = handshakeWithWorld(c, reader); err != nil {
+    c.Close()
+    return nil, nil, err
+  }
+
+  ps.state = snet.SETUP
+
+  if !ps.simulationStarted {
+    ps.simulation.Start(ps.worldMap, &ps.players, ps.toWorld, ps.region)
+    ps.simulationStarted = true
+  }
+
+  // Tell world our port and region, then what we have.
+  // Written before the link is opened to worldTx so nothing
+  // can slip in ahead of the sync.
+  var readyMsg link.ReadyMsg
+  readyMsg.Port = uint32(helpers.GetConfig().SIM_PORT)
+  readyMsg.Region = ps.region
+  syncMsg := ps.buildSyncMsg()
+  frames, err := link.Encode(&readyMsg)
+  if err != nil {
+    c.Close()
+    return nil, nil, err
+  }
+  for _, part := range syncMsg.Split() {
+    syncFrame, err := link.Encode(part)
+    if err != nil {
+      c.Close()
+      return nil, nil, err
+    }
+    frames = append(frames, syncFrame...)
+  }
+
+  ps.worldLock.Lock()
+  _, err = c.Write(frames)
+  if err == nil {
+    ps.worldConn = c
+    ps.worldConnOpen = true
+  }
+  ps.worldLock.Unlock()
+
+  if err != nil {
+    c.Close()
+    return nil, nil, fmt.Errorf("world sync: %s", err)
+  }
+
+  linkLog.Info("synced with world", "players", len(syncMsg.Players), "bodies", len(syncMsg.Bodies))
+  ps.simulation.SetLinked(true)
+  ps.state = snet.ALIVE
+  return c, reader, nil
+}
+
+func (ps *physicsServer) buildSyncMsg() link.SyncMsg {
+  var syncMsg link.SyncMsg
+  ps.clients.Range(func(key, value interface{}) bool {
+    syncMsg.Players = append(syncMsg.Players, key.(uuid.UUID))
+    return true
+  })
+  syncMsg.Bodies = ps.simulation.ControlledBodies()
+  return syncMsg
+}
+
+// Returns when the link is lost or SIM is shutting down.
+func (ps *physicsServer) readWorld(c *net.TCPConn, reader *bufio.Reader) {
+  decoder := link.NewLinkDecoder()
+  buf := make([]byte, helpers.GetConfig().MAX_MSG_SIZE)
+  for ps.state <= snet.ALIVE {
+    n, err := reader.Read(buf)
+    if err == io.EOF {
+      return
+    } else if err != nil && ps.state == snet.SHUTDOWN {
+      return
+    } else if err != nil {
+      linkLog.Error("read failed", "err", err)
+      return
+    }
+
+    decoder.Feed(buf[:n])
+    for {
+      m, err := decoder.Next()
+      if err == link.ErrBadFrame {
+        linkLog.Error("world link corrupt")
+        return
+      } else if err != nil {
+        linkLog.Warn("skipped frame", "err", err)
+        continue
+      } else if m == nil {
+        break
+      }
+
+      ps.handleWorldMsg(m)
+    }
+  }
+}
+
+func (ps *physicsServer) closeWorldConn() {
+  ps.simulation.SetLinked(false)
+  ps.worldLock.Lock()
+  if ps.worldConnOpen {
+    ps.worldConn.Close()
+    ps.worldConnOpen = false
+  }
+  ps.worldLock.Unlock()
+}
+
+func (ps *physicsServer) handleWorldMsg(m link.LinkMsg) {
+  linkLog.Debug("received from world", "cmd", m.GetCmd())
+
+  switch t := m.(type) {
+    case *link.JoinMsg:
+      if ps.hasPlayer(t.Ip, t.PlayerId) {
+        // already playing, keep the session
+        return
+      }
+      ps.expectPlayer(t.Ip, t.PlayerId, t.Team, t.Stats)
+      linkLog.Info("expecting player", "player", t.PlayerId, "ip", t.Ip.String())
+    case *link.LeaveMsg:
+      ps.removePlayer(t.PlayerId)
+    case *link.HandoffMsg:
+      ps.simulation.AcceptHandoff(t)
+    case *link.ShutdownMsg:
+      linkLog.Info("world is shutting down")
+      ps.beginShutdown()
+    case *link.LogLevelMsg:
+      if err := helpers.SetLogLevel(t.Subsystem, t.Level); err != nil {
+        linkLog.Warn("bad log level from world", "err", err)
+      } else {
+        linkLog.Info("set log level", "subsystem", t.Subsystem, "level", t.Level)
+      }
+    default:
+      linkLog.Warn("unexpected msg from world", "type", fmt.Sprintf("%T", m))
+  }
+}
+
+// Answer WORLD's challenge and check WORLD's answer to ours, see snet/Link.go.
+func handshakeWithWorld(c *net.TCPConn, reader *bufio.Reader) error {
+  c.SetDeadline(time.Now().Add(5 * time.Second))
+  defer c.SetDeadline(time.Time{})
+
+  challenge := make([]byte, snet.LINK_CHALLENGE_SIZE)
+  if _, err := io.ReadFull(reader, challenge); err != nil {
+    return fmt.Errorf("world handshake: %s", err)
+  }
+
+  if challenge[0] != byte(snet.IChallenge) {
+    return fmt.Errorf("world handshake: expected challenge, got %d", challenge[0])
+  }
+
+  version := snet.Read_uint16(challenge[1:3])
+  if version != snet.LINK_VERSION {
+    return fmt.Errorf("world handshake: world speaks protocol version %d, we speak %d", version, snet.LINK_VERSION)
+  }
+
+  secret := helpers.GetConfig().LINK_SECRET
+  worldNonce := challenge[3:]
+  simNonce := make([]byte, snet.LINK_NONCE_SIZE)
+  if _, err := rand.Read(simNonce); err != nil {
+    return fmt.Errorf("world handshake: %s", err)
+  }
+
+  hello := make([]byte, 3, snet.LINK_HELLO_SIZE)
+  hello[0] = byte(snet.IHello)
+  binary.LittleEndian.PutUint16(hello[1:3], snet.LINK_VERSION)
+  hello = append(hello, simNonce...)
+  hello = append(hello, snet.LinkMAC(secret, snet.LINK_SIM, worldNonce, simNonce)...)
+  if _, err := c.Write(hello); err != nil {
+    return fmt.Errorf("world handshake: %s", err)
+  }
+
+  reply, err := reader.ReadByte()
+  if err != nil {
+    return fmt.Errorf("world handshake: %s", err)
+  }
+
+  if reply == byte(snet.IReject) {
+    reason, _ := reader.ReadByte()
+    return fmt.Errorf("world handshake: rejected, %s", snet.LinkRejectReason(reason))
+  }
+
+  if reply != byte(snet.IWelcome) {
+    return fmt.Errorf("world handshake: expected welcome, got %d", reply)
+  }
+
+  mac := make([]byte, snet.LINK_MAC_SIZE)
+  if _, err := io.ReadFull(reader, mac); err != nil {
+    return fmt.Errorf("world handshake: %s", err)
+  }
+  if !snet.CheckLinkMAC(secret, snet.LINK_WORLD, worldNonce, simNonce, mac) {
+    return errors.New("world handshake: world doesn't know the secret")
+  }
+
+  linkLog.Info("authenticated with world")
+  return nil
+}
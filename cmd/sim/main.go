@@ -1,30 +1,32 @@
 package main
 
 import (
+  "fmt"
   "flag"
+  "strconv"
   "log"
   "time"
   "net"
-  "bufio"
-  "math/rand"
   "sync"
   "os"
   "runtime/pprof"
-  "encoding/binary"
 
   "github.com/panjf2000/gnet"
   "github.com/panjf2000/gnet/pool/goroutine"
-  "github.com/google/uuid"
 
   "go-space-serv/internal/space/snet"
   "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/snet/netsim"
   "go-space-serv/internal/space/util"
   "go-space-serv/internal/space/world"
   "go-space-serv/internal/space/sim"
+  "go-space-serv/internal/space/metrics"
 )
 
 const cmdLen            int     = 1
-const udpPort           int     = 9495
+
+var simLog = helpers.Logger("sim")
 
 func SDBMHash(str string) uint32 {
   var hash uint32 = 0;
@@ -45,11 +47,14 @@ type physicsServer struct {
   life          chan  struct{}
   shutdown      chan  struct{}
   state               snet.ServerState
+  stopping            int32
 
   players             sim.SimPlayers
   simulation          sim.Simulation
   msgFactory          sim.SimMsgFactory
-  ipsToPlayers        sync.Map
+  clients             sync.Map    // player id -> *simClient
+  addrsToClients      sync.Map    // ip:port -> *simClient
+  bindLock            sync.Mutex
 
   launchTime          int64
   tick                time.Duration   // loop speed
@@ -57,28 +62,48 @@ type physicsServer struct {
 
   // World map data
   worldConn           *net.TCPConn
-  worldLaddr          *net.TCPAddr
   worldRaddr          *net.TCPAddr
   worldConnOpen       bool
-  worldMap            world.WorldMap
+  worldLock           sync.Mutex
+  region              snet.Region
+  simulationStarted   bool
+  worldMap            *world.WorldMap
   worldMapBytes       []byte
   worldMapLen         int
-  toWorld       chan  []byte
+  toWorld       chan  link.LinkMsg
+
+  udpMetrics          *udp.UDPMetrics
+  network             *netsim.Network   // nil unless simulating a bad network
 }
 
 
 
 func main() {
   cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
-  flagTimestep := flag.Int64("timestep", 33, "physics timestep in milliseconds")
-  flagTimestepNano := flag.Int64("timestepNano", 33000000, "physics timestep in nanoseconds")
-  flagProtocolId := flag.Uint("protocolId", 3551548956, "value must match client")
-  flagWorldRate := flag.Int("worldRate", 12, "physics frames passing before sending state update to world.")
+
+  // for testing clients against a bad network, applies to packets SIM sends
+  var conditions netsim.Conditions
+  flag.DurationVar(&conditions.Latency, "netLatency", 0, "delay every udp packet to clients by this much")
+  flag.DurationVar(&conditions.Jitter, "netJitter", 0, "delay udp packets up to this much more at random")
+  flag.Float64Var(&conditions.Loss, "netLoss", 0, "chance a udp packet is dropped, 0 to 1")
+  flag.Float64Var(&conditions.Duplicate, "netDuplicate", 0, "chance a udp packet is sent twice, 0 to 1")
+  flag.Float64Var(&conditions.Reorder, "netReorder", 0, "chance a udp packet is held back so later ones overtake it, 0 to 1")
+  flag.DurationVar(&conditions.ReorderDelay, "netReorderDelay", 0, "how long reordered packets are held back, 0 for latency+jitter+10ms")
+  netSeed := flag.Int64("netSeed", 1, "seed for what happens to each packet")
+  record := flag.String("record", "", "record the match to this new file, for replay")
 
   p := goroutine.Default()
   defer p.Release()
 
-  flag.Parse()
+  config, err := helpers.LoadConfig("SPACE-PHYS", flag.CommandLine, os.Args[1:])
+  if err != nil {
+    log.Fatal(err)
+  }
+  helpers.SetConfig(config)
+  if err := helpers.InitLogging(config); err != nil {
+    log.Fatal(err)
+  }
+
   if *cpuprofile != "" {
     f, err := os.Create(*cpuprofile)
     if err != nil {
@@ -91,19 +116,7 @@ func main() {
     defer pprof.StopCPUProfile()
   }
 
-  // Populate config
-  // TODO: take this from flags
-  var config helpers.Config
-  config.TIMESTEP = *flagTimestep
-  config.TIMESTEP_NANO = *flagTimestepNano
-  config.NAME = "SPACE-PHYS"
-  config.VERSION = "0.0.1"
-  config.PROTOCOL_ID = uint32(*flagProtocolId)
-  config.MAX_MSG_SIZE = 1024
-  config.WORLD_RATE = *flagWorldRate
-  helpers.SetConfig(&config)
-
-  log.Printf("PROTOCOL_ID: %d", config.PROTOCOL_ID)
+  simLog.Info("starting", "protocolId", config.PROTOCOL_ID)
 
   // Initialize UDP server
   ps := &physicsServer{
@@ -112,19 +125,55 @@ func main() {
     launchTime: time.Now().UnixNano(),
     state: snet.DEAD,
     worldConnOpen: false,
-    toWorld: make(chan []byte, 32),
+    toWorld: make(chan link.LinkMsg, 32),
+  }
+
+  if !conditions.Clean() {
+    ps.network = netsim.New(conditions, *netSeed)
+    simLog.Warn("simulating a bad network", "conditions", ps.network.Conditions().String(), "seed", *netSeed)
   }
 
-  ps.worldLaddr = &net.TCPAddr{
-    IP: net.ParseIP("127.0.0.1"),
-    Port: 9499,
+  ps.worldRaddr, err = net.ResolveTCPAddr("tcp", net.JoinHostPort(config.WORLD_HOST, strconv.Itoa(config.LINK_PORT)))
+  if err != nil {
+    log.Fatal(err)
+  }
+
+  ps.region, err = snet.ParseRegion(config.SIM_REGION)
+  if err != nil {
+    log.Fatal(err)
   }
-  ps.worldRaddr = &net.TCPAddr{
-    IP: net.ParseIP("127.0.0.1"),
-    Port: 9494,
+  simLog.Info("simulating", "region", ps.region)
+
+  // Spawn points come from the map metadata.
+  wm, err := world.NewWorldMap(config.MAP_PATH)
+  if err != nil {
+    log.Fatal(err)
+  }
+  ps.worldMap = wm
+
+  if *record != "" {
+    var header sim.RecordingHeader
+    header.Timestep = config.TIMESTEP
+    header.TimestepNano = config.TIMESTEP_NANO
+    header.Region = ps.region
+    header.Map = wm.Identity()
+    header.Started = time.Now()
+    recorder, err := sim.CreateRecording(*record, header)
+    if err != nil {
+      log.Fatal(err)
+    }
+    ps.simulation.SetRecorder(recorder)
+    simLog.Info("recording", "file", *record)
   }
 
-  rand.Seed(time.Now().UnixNano())
+  if config.SIM_METRICS_ADDR != "" {
+    reg := metrics.NewRegistry()
+    ps.udpMetrics = udp.NewUDPMetrics(reg)
+    ps.simulation.RegisterMetrics(reg)
+    reg.GaugeFunc("space_sim_players", "Players in this simulation.", func() float64 { return float64(ps.players.Count) })
+    reg.GaugeFunc("space_udp_outgoing_queue", "UDP messages queued for all players.", func() float64 { return float64(ps.players.Pending()) })
+    go reg.Serve(config.SIM_METRICS_ADDR)
+  }
 
   ps.life = make(chan struct{})
   ps.shutdown = make(chan struct{})
@@ -132,7 +181,12 @@ func main() {
   go ps.live()
   <-ps.life
 
-  log.Printf("end")
+  if ps.network != nil {
+    s := ps.network.Stats()
+    simLog.Info("bad network", "sent", s.Sent, "dropped", s.Dropped, "duplicated", s.Duplicated, "reordered", s.Reordered)
+  }
+
+  simLog.Info("end")
 }
 
 func (ps *physicsServer) live() {
@@ -140,127 +194,27 @@ func (ps *physicsServer) live() {
 
   ps.state = snet.WAIT_WORLD
 
-  go ps.serve("udp://:9495")
-  go ps.worldRx(ps.worldLaddr, ps.worldRaddr)
+  go ps.serve(fmt.Sprintf("udp://:%d", helpers.GetConfig().SIM_PORT))
+  go ps.worldRx(ps.worldRaddr)
   go ps.worldTx()
+  go ps.handleSignals()
 
   <-ps.shutdown
 }
 
 func (ps *physicsServer) serve(udpAddr string) {
-  log.Printf("Listening to %s", udpAddr)
+  simLog.Info("listening", "addr", udpAddr)
   err := gnet.Serve(ps, udpAddr, gnet.WithMulticore(true), gnet.WithTicker(true), gnet.WithReusePort(true))
   if err != nil {
     log.Fatal(err)
   }
 }
 
-func (ps *physicsServer) worldTx() {
-  for packet := range ps.toWorld {
-    ps.worldConn.Write(packet)
-  }
-}
-
-// world server <-> physics server interaction
-func (ps *physicsServer) worldRx(laddr, raddr *net.TCPAddr) {
-  c, err := net.DialTCP("tcp", laddr, raddr)
-  if err != nil {
-    log.Printf("%s", err)
-    panic("couldnt find world server")
-  }
-
-  c.SetNoDelay(true)
-
-  ps.worldConn = c
-  ps.worldConnOpen = true
-  ps.state = snet.SETUP
-
-  reader := bufio.NewReader(c)
-
-  // Tell world about our port and that we're ready.
-  portMsg := make([]byte, 5)
-  portMsg[0] = byte(snet.IReady)
-  binary.LittleEndian.PutUint32(portMsg[1:5], uint32(udpPort))
-  c.Write(portMsg)
-
-  ps.simulation.Start(&ps.worldMap, &ps.players, ps.toWorld)
-
-  ps.state = snet.ALIVE
-
-  for ps.state <= snet.ALIVE {
-    event, err := reader.Peek(1)
-    if err == nil {
-      log.Printf("Received event from world %d", event)
-      reader.Discard(1)
-
-      if event[0] == byte(snet.IJoin) {
-        var ipLen []byte
-        var ipBytes []byte
-        var idBytes []byte
-        idBytes, err = reader.Peek(16)
-        if err == nil {
-          playerId, _ := uuid.FromBytes(idBytes)
-          reader.Discard(16)
-          ipLen, err = reader.Peek(1)
-          if err == nil {
-            reader.Discard(1)
-            ipBytes, err = reader.Peek(int(ipLen[0]))
-            if err == nil {
-              ip := net.IP(ipBytes)
-              reader.Discard(int(ipLen[0]))
-
-              plr := udp.NewPlayer(ps.simulation.GetPlayerChan(), playerId, &ps.msgFactory)
-              if plr != nil {
-                ps.ipsToPlayers.Store(ip.String(), plr)
-                log.Printf("Storing %s <-> %v", ip.String(), playerId)
-              }
-            }
-          }
-        }
-      } else if event[0] == byte(snet.ILeave) {
-        var idBytes []byte
-        idBytes, err = reader.Peek(16)
-        if err == nil {
-          reader.Discard(16)
-          playerId, _ := uuid.FromBytes(idBytes)
-          ps.players.Remove(playerId)
-          ps.simulation.RemoveControlledBody(playerId)
-        }
-      } else if event[0] == byte(snet.IShutdown) {
-        ps.state = snet.SHUTDOWN
-      }
-    }
-
-    if err != nil && err.Error() == "EOF" {
-      ps.state = snet.SHUTDOWN // TODO: retry connecting to world
-      return
-    } else if err != nil && ps.state == snet.SHUTDOWN {
-      return
-    } else if err != nil {
-      log.Printf("worldConn err: " + err.Error())
-    }
-  }
-}
-
-func (ps *physicsServer) ipIsValid(ip string) bool {
-  found := false
-  ps.ipsToPlayers.Range(func(key, value interface{}) bool {
-    if key.(string) == ip {
-      found = true
-      return false
-    }
-    return true
-  })
-
-  return found
-}
-
 // Event Handler
 
 func (ps *physicsServer) OnShutdown(srv gnet.Server) {
   ps.state = snet.DEAD
-  ps.worldConn.Close()
-  close(ps.toWorld)
+  ps.closeWorldConn()
   close(ps.shutdown)
 }
 
@@ -273,35 +227,30 @@ func (ps *physicsServer) Tick() (delay time.Duration, action gnet.Action) {
 }
 
 func (ps *physicsServer) React(data []byte, connection gnet.Conn) (out []byte, action gnet.Action) {
-  valid := true
-  ipString := connection.RemoteAddr().(*net.UDPAddr).IP.String()
-  valid = valid && ps.ipIsValid(ipString)
+  addr := connection.RemoteAddr().(*net.UDPAddr)
+  plr := ps.clientFor(addr, data)
 
-  if valid {
+  if plr != nil {
+    ps.udpMetrics.Received(len(data))
     bytes := data
     _ = ps.pool.Submit(func() {
-      tmp, ok := ps.ipsToPlayers.Load(ipString)
-      if ok {
-        plr := tmp.(*udp.UDPPlayer)
-        if valid && snet.Read_uint32(bytes[0:4]) == helpers.GetProtocolId() {
-          if plr.GetState() >= udp.CONNECTED {
-            plr.Unpack(bytes[4:])
-          } else if plr.AuthenticateConnection(bytes, connection) {
-            ps.players.Add(plr)
-          }
+      if snet.Read_uint32(bytes[0:4]) == helpers.GetProtocolId() {
+        if plr.GetState() >= udp.CONNECTED {
+          plr.Unpack(bytes[4:])
+        } else if plr.AuthenticateConnection(bytes, ps.outbound(connection)) {
+          team, stats := ps.shipOf(plr.Id)
+          ps.players.Add(plr, team, stats)
         }
       }
-
     })
   } else {
-    log.Printf("Invalid IP %s", ipString)
+    simLog.Debug("packet from unknown address", "addr", addr.String())
   }
 
   return
 }
 
 func (ps *physicsServer) OnInitComplete(srv gnet.Server) (action gnet.Action) {
-  log.Printf("UDP server is listening on %s (multi-cores: %t, loops: %d)\n",
-    srv.Addr.String(), srv.Multicore, srv.NumEventLoop)
+  simLog.Info("udp server is listening", "addr", srv.Addr.String(), "multicore", srv.Multicore, "loops", srv.NumEventLoop)
   return
 }
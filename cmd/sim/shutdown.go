@@ -0,0 +1,47 @@
+package main
+
+import(
+  "os"
+  "time"
+  "syscall"
+  "os/signal"
+  "sync/atomic"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/util"
+)
+
+// SIGINT/SIGTERM or a ShutdownMsg from WORLD:
+// send DISCONNECT to every udp client, then stop gnet.
+// Exits anyway after shutdownTimeout. A second signal exits at once.
+
+func (ps *physicsServer) handleSignals() {
+  signals := make(chan os.Signal, 2)
+  signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+  sig := <-signals
+  simLog.Info("shutting down", "signal", sig)
+  ps.beginShutdown()
+
+  sig = <-signals
+  simLog.Warn("exiting now", "signal", sig)
+  os.Exit(1)
+}
+
+func (ps *physicsServer) beginShutdown() {
+  if !atomic.CompareAndSwapInt32(&ps.stopping, 0, 1) {
+    return
+  }
+
+  timeout := time.Duration(helpers.GetConfig().SHUTDOWN_TIMEOUT) * time.Second
+  time.AfterFunc(timeout, func() {
+    simLog.Error("shutdown took too long, exiting", "timeout", timeout)
+    os.Exit(1)
+  })
+
+  ps.players.DisconnectAll()
+  if err := ps.simulation.StopRecording(); err != nil {
+    simLog.Error("recording failed", "err", err)
+  }
+  ps.state = snet.SHUTDOWN
+}
@@ -0,0 +1,304 @@
+package main
+
+import(
+  "os"
+  "net"
+  "strconv"
+  "strings"
+  "net/http"
+  "unicode/utf8"
+  "encoding/json"
+  "crypto/subtle"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+)
+
+var adminLog = helpers.Logger("admin")
+
+// Admin api for operators, used by cmd/admin.
+// Every request needs "Authorization: Bearer <adminToken>".
+// Listens on localhost by default, see README.
+//
+//   GET  /status          state and simulations
+//   GET  /players         connected players
+//   POST /players/kick    {"id": "..."}
+//   POST /broadcast       {"text": "..."}
+//   POST /chat            {"text": "...", "to": "..."}, to is optional
+//   POST /ships/reload
+//   POST /map/save
+//   GET  /map/stats       Chunker stats
+//   GET  /log             log level of each subsystem
+//   POST /log/level       {"subsystem": "udp", "level": "debug"}, also sent to every SIM
+
+type adminPlayer struct {
+  Id      uuid.UUID `json:"id"`
+  Name    string    `json:"name"`
+  Ip      string    `json:"ip"`
+  State   string    `json:"state"`
+  X       uint16    `json:"x"`
+  Y       uint16    `json:"y"`
+  Sim     string    `json:"sim"`
+  Rtt     int64     `json:"rtt"`
+}
+
+type adminSim struct {
+  Region  string    `json:"region"`
+  Address string    `json:"address"`
+  Live    bool      `json:"live"`
+  Players int       `json:"players"`
+}
+
+type adminStatus struct {
+  State   string      `json:"state"`
+  Players int         `json:"players"`
+  Sims    []adminSim  `json:"sims"`
+}
+
+func (ws *worldServer) serveAdmin() {
+  config := helpers.GetConfig()
+  if config.ADMIN_TOKEN == "" {
+    adminLog.Info("admin api disabled, set adminToken to enable it")
+    return
+  }
+
+  var ln net.Listener
+  var err error
+  if strings.HasPrefix(config.ADMIN_ADDR, "unix:") {
+    path := strings.TrimPrefix(config.ADMIN_ADDR, "unix:")
+    os.Remove(path)
+    ln, err = net.Listen("unix", path)
+    if err == nil {
+      os.Chmod(path, 0600)
+    }
+  } else {
+    ln, err = net.Listen("tcp", config.ADMIN_ADDR)
+  }
+  if err != nil {
+    adminLog.Error("admin api failed to listen", "err", err)
+    return
+  }
+
+  mux := http.NewServeMux()
+  mux.HandleFunc("/status", ws.adminOnly("GET", ws.adminStatus))
+  mux.HandleFunc("/players", ws.adminOnly("GET", ws.adminPlayers))
+  mux.HandleFunc("/players/kick", ws.adminOnly("POST", ws.adminKick))
+  mux.HandleFunc("/broadcast", ws.adminOnly("POST", ws.adminBroadcast))
+  mux.HandleFunc("/chat", ws.adminOnly("POST", ws.adminChat))
+  mux.HandleFunc("/ships/reload", ws.adminOnly("POST", ws.adminReloadShips))
+  mux.HandleFunc("/map/save", ws.adminOnly("POST", ws.adminSave))
+  mux.HandleFunc("/map/stats", ws.adminOnly("GET", ws.adminMapStats))
+  mux.HandleFunc("/log", ws.adminOnly("GET", ws.adminLogLevels))
+  mux.HandleFunc("/log/level", ws.adminOnly("POST", ws.adminSetLogLevel))
+
+  adminLog.Info("serving admin api", "addr", config.ADMIN_ADDR)
+  if err = http.Serve(ln, mux); err != nil {
+    adminLog.Error("admin api stopped", "err", err)
+  }
+}
+
+func (ws *worldServer) adminOnly(method string, h http.HandlerFunc) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if subtle.ConstantTimeCompare([]byte(token), []byte(helpers.GetConfig().ADMIN_TOKEN)) != 1 {
+      adminError(w, http.StatusUnauthorized, "bad token")
+      return
+    }
+    if r.Method != method {
+      adminError(w, http.StatusMethodNotAllowed, method + " only")
+      return
+    }
+    h(w, r)
+  }
+}
+
+func (ws *worldServer) adminStatus(w http.ResponseWriter, r *http.Request) {
+  status := adminStatus{
+    State: ws.state.String(),
+    Players: ws.players.Count(),
+    Sims: []adminSim{},
+  }
+
+  ws.linksLock.Lock()
+  links := append([]*simLink{}, ws.links...)
+  ws.linksLock.Unlock()
+
+  for _, sl := range links {
+    sl.lock.Lock()
+    sim := adminSim{
+      Region: sl.region.String(),
+      Address: net.JoinHostPort(sl.ip.String(), strconv.FormatUint(uint64(sl.port), 10)),
+      Live: sl.conn != nil,
+    }
+    sl.lock.Unlock()
+    sim.Players = len(ws.playersOf(sl))
+    status.Sims = append(status.Sims, sim)
+  }
+
+  adminReply(w, status)
+}
+
+func (ws *worldServer) adminPlayers(w http.ResponseWriter, r *http.Request) {
+  plrs := []adminPlayer{}
+  for _, plr := range ws.players.List() {
+    p := adminPlayer{
+      Id: plr.Tcp.Id,
+      Name: plr.GetName(),
+      State: plr.Tcp.GetState().String(),
+      Rtt: plr.GetRtt(),
+    }
+    p.X, p.Y = plr.Position()
+    if ip, ok := ws.idToAddr.Load(p.Id); ok {
+      p.Ip = ip.(net.IP).String()
+    }
+    if sl, ok := ws.playerLinks.Load(p.Id); ok {
+      p.Sim = sl.(*simLink).region.String()
+    }
+    plrs = append(plrs, p)
+  }
+
+  adminReply(w, plrs)
+}
+
+func (ws *worldServer) adminKick(w http.ResponseWriter, r *http.Request) {
+  var req struct {
+    Id uuid.UUID `json:"id"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if !ws.kick(req.Id) {
+    adminError(w, http.StatusNotFound, "no such player")
+    return
+  }
+
+  adminLog.Info("kicked", "player", req.Id)
+  adminReply(w, map[string]string{"kicked": req.Id.String()})
+}
+
+func (ws *worldServer) adminBroadcast(w http.ResponseWriter, r *http.Request) {
+  var req struct {
+    Text string `json:"text"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if req.Text == "" || !utf8.ValidString(req.Text) || len(req.Text) > msg.MAX_BROADCAST_LEN {
+    adminError(w, http.StatusBadRequest, "text must be valid utf-8, 1 to " + strconv.Itoa(msg.MAX_BROADCAST_LEN) + " bytes")
+    return
+  }
+
+  ws.wld.Broadcast(req.Text)
+  adminLog.Info("broadcast", "text", req.Text)
+  adminReply(w, map[string]int{"players": ws.players.Count()})
+}
+
+func (ws *worldServer) adminChat(w http.ResponseWriter, r *http.Request) {
+  var req struct {
+    Text string    `json:"text"`
+    To   uuid.UUID `json:"to"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if req.Text == "" || !utf8.ValidString(req.Text) || len(req.Text) > msg.MAX_CHAT_LEN {
+    adminError(w, http.StatusBadRequest, "text must be valid utf-8, 1 to " + strconv.Itoa(msg.MAX_CHAT_LEN) + " bytes")
+    return
+  }
+
+  if !ws.wld.SystemChat(req.To, req.Text) {
+    adminError(w, http.StatusNotFound, "no such player")
+    return
+  }
+  adminLog.Info("system chat", "to", req.To, "text", req.Text)
+  adminReply(w, map[string]int{"players": ws.players.Count()})
+}
+
+// Reads the ships file again. Players already flying keep
+// their ship, those joining from now on get the new one.
+func (ws *worldServer) adminReloadShips(w http.ResponseWriter, r *http.Request) {
+  fileName := helpers.GetConfig().SHIPS
+  if fileName == "" {
+    adminError(w, http.StatusConflict, "no ships file configured, ships are built in")
+    return
+  }
+
+  ships, err := player.LoadShips(fileName)
+  if err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  ws.players.SetShips(ships)
+  adminLog.Info("reloaded ships", "file", fileName, "ships", len(ships))
+  adminReply(w, ships)
+}
+
+func (ws *worldServer) adminSave(w http.ResponseWriter, r *http.Request) {
+  if err := ws.saveNow(); err != nil {
+    adminError(w, http.StatusInternalServerError, err.Error())
+    return
+  }
+  adminReply(w, ws.wld.MapStats())
+}
+
+func (ws *worldServer) adminMapStats(w http.ResponseWriter, r *http.Request) {
+  adminReply(w, ws.wld.MapStats())
+}
+
+func (ws *worldServer) adminLogLevels(w http.ResponseWriter, r *http.Request) {
+  adminReply(w, helpers.LogLevels())
+}
+
+func (ws *worldServer) adminSetLogLevel(w http.ResponseWriter, r *http.Request) {
+  var req struct {
+    Subsystem string `json:"subsystem"`
+    Level     string `json:"level"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  if err := helpers.SetLogLevel(req.Subsystem, req.Level); err != nil {
+    adminError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  var logLevelMsg link.LogLevelMsg
+  logLevelMsg.Subsystem = req.Subsystem
+  logLevelMsg.Level = req.Level
+
+  ws.linksLock.Lock()
+  for _, sl := range ws.links {
+    if sl.isLive() {
+      sl.send(&logLevelMsg)
+    }
+  }
+  ws.linksLock.Unlock()
+
+  adminLog.Info("set log level", "subsystem", req.Subsystem, "level", req.Level)
+  adminReply(w, helpers.LogLevels())
+}
+
+func adminReply(w http.ResponseWriter, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  enc := json.NewEncoder(w)
+  enc.SetIndent("", "  ")
+  enc.Encode(v)
+}
+
+func adminError(w http.ResponseWriter, code int, text string) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(code)
+  json.NewEncoder(w).Encode(map[string]string{"error": text})
+}
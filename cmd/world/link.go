@@ -0,0 +1,234 @@
+package main
+
+import(
+  "io"
+  "log"
+  "fmt"
+  "net"
+  "time"
+  "crypto/rand"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+)
+
+// world server <-> physics server interaction
+// Each SIM connects to its own port and must complete
+// the handshake described in snet/Link.go,
+// after which both sides send frames from snet/link.
+// A SIM owns the region it names in its ReadyMsg, see simLink.go.
+
+const linkHandshakeTimeout time.Duration = 5 * time.Second
+const linkKeepAlive time.Duration = 5 * time.Second
+
+var linkLog = helpers.Logger("link")
+
+func (ws *worldServer) listenForPhysics(port int) {
+  ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+  if err != nil {
+    log.Fatal(err)
+  }
+  defer ln.Close()
+
+  linkLog.Info("awaiting simulation", "port", port)
+
+  for ws.state < snet.SHUTDOWN {
+    c, err := ln.Accept()
+    if err != nil {
+      linkLog.Error("accept failed", "err", err)
+      continue
+    }
+    go ws.physicsRx(c)
+  }
+}
+
+func (ws *worldServer) physicsRx(c net.Conn) {
+  defer c.Close()
+  linkLog.Debug("opened", "addr", c.RemoteAddr().String())
+
+  if !ws.authenticatePhysics(c) {
+    return
+  }
+
+  if tcpConn, ok := c.(*net.TCPConn); ok {
+    // notice a SIM host that vanished without closing
+    tcpConn.SetKeepAlive(true)
+    tcpConn.SetKeepAlivePeriod(linkKeepAlive)
+  }
+
+  linkLog.Info("physics server connected", "addr", c.RemoteAddr().String())
+
+  // set by the ReadyMsg that starts every link
+  var sl *simLink
+  defer func() {
+    if sl != nil {
+      ws.detachLink(sl)
+    }
+  }()
+
+  decoder := link.NewLinkDecoder()
+  buf := make([]byte, helpers.GetConfig().MAX_MSG_SIZE)
+  for {
+    n, err := c.Read(buf)
+    if err != nil {
+      if err != io.EOF {
+        linkLog.Error("read failed", "addr", c.RemoteAddr().String(), "err", err)
+      }
+      linkLog.Debug("closed", "addr", c.RemoteAddr().String())
+      return
+    }
+
+    decoder.Feed(buf[:n])
+    for {
+      m, err := decoder.Next()
+      if err == link.ErrBadFrame {
+        linkLog.Error("link corrupt, closing", "addr", c.RemoteAddr().String())
+        return
+      } else if err != nil {
+        linkLog.Warn("skipped frame", "addr", c.RemoteAddr().String(), "err", err)
+        continue
+      } else if m == nil {
+        break
+      }
+
+      if ready, ok := m.(*link.ReadyMsg); ok && sl == nil {
+        sl, err = ws.attachLink(c, ready)
+        if err != nil {
+          linkLog.Error("refused", "addr", c.RemoteAddr().String(), "err", err)
+          return
+        }
+      } else if sl == nil {
+        linkLog.Error("expected ready", "addr", c.RemoteAddr().String(), "type", fmt.Sprintf("%T", m))
+        return
+      } else {
+        ws.handlePhysicsMsg(sl, m)
+      }
+    }
+  }
+}
+
+func (ws *worldServer) handlePhysicsMsg(sl *simLink, m link.LinkMsg) {
+  switch t := m.(type) {
+    case *link.SyncMsg:
+      for _, id := range ws.wld.Resync(sl.id, t) {
+        var leaveMsg link.LeaveMsg
+        leaveMsg.PlayerId = id
+        sl.send(&leaveMsg)
+      }
+      linkLog.Info("physics synced", "region", sl.region, "players", len(t.Players), "bodies", len(t.Bodies))
+      return
+    case *link.HandoffMsg:
+      // handled in order so the body's spawn on the
+      // new SIM can't overtake its removal here.
+      ws.handOff(sl, t)
+      return
+  }
+
+  _ = ws.pool.Submit(func() {
+    ws.wld.InterpretPhysics(sl.id, m)
+  })
+}
+
+// Pass a body that left from's region to the SIM owning where it went.
+// If nobody does, it goes back to from, which stops it at its edge.
+func (ws *worldServer) handOff(from *simLink, m *link.HandoffMsg) {
+  ipVal, ok := ws.idToAddr.Load(m.PlayerId)
+  if !ok {
+    return
+  }
+  ip := ipVal.(net.IP)
+
+  x, y := ws.wld.CellFromPosition(m.Position.X(), m.Position.Y())
+  to := ws.findLink(x, y)
+  if to == nil || to == from {
+    from.send(m)
+    return
+  }
+
+  ws.wld.ForgetBodies(from.id, m.PlayerId)
+
+  var leaveMsg link.LeaveMsg
+  leaveMsg.PlayerId = m.PlayerId
+  from.send(&leaveMsg)
+
+  var joinMsg link.JoinMsg
+  joinMsg.PlayerId = m.PlayerId
+  joinMsg.Ip = ip
+  joinMsg.Team = m.Team
+  joinMsg.Stats = m.Stats
+  to.send(&joinMsg)
+  to.send(m)
+
+  ws.playerLinks.Store(m.PlayerId, to)
+  ws.wld.PhysicsMoved([]uuid.UUID{m.PlayerId}, to.ip, to.port)
+  linkLog.Info("handed off", "player", m.PlayerId, "from", from.region, "to", to.region)
+}
+
+// Challenge the peer to prove it knows the shared secret
+// and speaks the same protocol version, then prove it back.
+func (ws *worldServer) authenticatePhysics(c net.Conn) bool {
+  c.SetDeadline(time.Now().Add(linkHandshakeTimeout))
+  defer c.SetDeadline(time.Time{})
+
+  challenge := make([]byte, snet.LINK_CHALLENGE_SIZE)
+  challenge[0] = byte(snet.IChallenge)
+  binary.LittleEndian.PutUint16(challenge[1:3], snet.LINK_VERSION)
+  worldNonce := challenge[3:]
+  if _, err := rand.Read(worldNonce); err != nil {
+    linkLog.Error("failed to create nonce", "err", err)
+    return false
+  }
+
+  if _, err := c.Write(challenge); err != nil {
+    linkLog.Warn("handshake failed", "addr", c.RemoteAddr().String(), "err", err)
+    return false
+  }
+
+  // the rest of an older hello may be a different size
+  hello := make([]byte, snet.LINK_HELLO_SIZE)
+  if _, err := io.ReadFull(c, hello[:3]); err != nil {
+    linkLog.Warn("handshake failed", "addr", c.RemoteAddr().String(), "err", err)
+    return false
+  }
+
+  if hello[0] != byte(snet.IHello) {
+    linkLog.Warn("handshake failed, expected hello", "addr", c.RemoteAddr().String(), "cmd", hello[0])
+    return false
+  }
+
+  version := snet.Read_uint16(hello[1:3])
+  if version != snet.LINK_VERSION {
+    linkLog.Warn("rejected protocol version", "addr", c.RemoteAddr().String(), "version", version, "want", snet.LINK_VERSION)
+    rejectPhysics(c, snet.REJECT_VERSION)
+    return false
+  }
+
+  if _, err := io.ReadFull(c, hello[3:]); err != nil {
+    linkLog.Warn("handshake failed", "addr", c.RemoteAddr().String(), "err", err)
+    return false
+  }
+
+  secret := helpers.GetConfig().LINK_SECRET
+  simNonce := hello[3:3+snet.LINK_NONCE_SIZE]
+  if !snet.CheckLinkMAC(secret, snet.LINK_SIM, worldNonce, simNonce, hello[3+snet.LINK_NONCE_SIZE:]) {
+    linkLog.Warn("rejected bad secret", "addr", c.RemoteAddr().String())
+    rejectPhysics(c, snet.REJECT_AUTH)
+    return false
+  }
+
+  welcome := append([]byte{byte(snet.IWelcome)}, snet.LinkMAC(secret, snet.LINK_WORLD, worldNonce, simNonce)...)
+  if _, err := c.Write(welcome); err != nil {
+    linkLog.Warn("handshake failed", "addr", c.RemoteAddr().String(), "err", err)
+    return false
+  }
+
+  return true
+}
+
+func rejectPhysics(c net.Conn, reason snet.LinkRejectReason) {
+  c.Write([]byte{byte(snet.IReject), byte(reason)})
+}
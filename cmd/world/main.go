@@ -7,14 +7,23 @@ import (
   "sync"
   "time"
   "net"
+  "os"
+  "strings"
+  "sync/atomic"
 
   "github.com/panjf2000/gnet"
   "github.com/panjf2000/gnet/pool/goroutine"
   "github.com/google/uuid"
 
   "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/player"
   "go-space-serv/internal/space/snet"
   "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/util"
+  "go-space-serv/internal/space/metrics"
 )
 
 type worldServer struct {
@@ -23,39 +32,65 @@ type worldServer struct {
   pool              *goroutine.Pool
   tick              time.Duration
   state             snet.ServerState
+  stopping          int32
 
-  physics           gnet.Conn
-  physicsIP         net.IP
-  physicsPort       uint32
+  // one per SIM, see simLink.go
+  links             []*simLink
+  linksLock         sync.Mutex
+  nextLinkId        uint16
+  playerLinks       sync.Map      // player id -> *simLink simulating them
 
   wld               *world.World
   players           *world.WorldPlayers
   msgFactory        world.WorldMsgFactory
   addrToId          sync.Map
+  idToAddr          sync.Map
+  idToConn          sync.Map      // player id -> gnet.Conn
+  kicked            sync.Map      // player id -> true until their connection closes
+  loggingIn         sync.Map      // player id -> *pendingPlayer until they join, see login
+  logins            sync.Map      // player id -> name from their LOGIN
+  tcpMetrics        *tcp.TCPMetrics
+  fromPlayers chan  tcp.TCPMsg    // from every client, see handlePlayers
+
+  // persistence
+  saveRate          time.Duration
+  evictAge          time.Duration
+  lastSave          time.Time
+  saving            int32
+
+  // heartbeat
+  pingRate          time.Duration
+  lastPing          time.Time
 
   // lifecycle
   life        chan  struct{}
   shutdown    chan  struct{}
 }
 
-const maxMsgSize int = 1024
+// How long a new connection has to send LOGIN.
+const loginTimeout time.Duration = 5 * time.Second
 
-var spawnX int = 1600;
-var spawnY int = 0;
-
-func main() {
-  flagPort := flag.Uint("port", 9494, "Port to listen on")
-
-  flag.Parse()
+// Connected but not joined until their LOGIN.
+type pendingPlayer struct {
+  tcp       *tcp.TCPPlayer
+  opened    time.Time
+}
 
-  mapName := flag.Arg(0)
+var worldLog = helpers.Logger("world")
 
-  if mapName == "" { mapName = "localMap" }
+func main() {
+  config, err := helpers.LoadConfig("SPACE-WORLD", flag.CommandLine, os.Args[1:])
+  if err != nil {
+    log.Fatal(err)
+  }
+  helpers.SetConfig(config)
+  if err := helpers.InitLogging(config); err != nil {
+    log.Fatal(err)
+  }
 
   var plrs world.WorldPlayers
-  plrs.Count = 0
 
-  w, err := world.NewWorld(&plrs, mapName)
+  w, err := world.NewWorld(&plrs, config.MAP_PATH)
   if err != nil {
     panic(err)
   }
@@ -68,21 +103,54 @@ func main() {
     tick: 100000000,
     state: snet.WAIT_PHYS,
     players: &plrs,
+    saveRate: time.Duration(config.SAVE_RATE) * time.Second,
+    evictAge: time.Duration(config.EVICT_AGE) * time.Second,
+    lastSave: time.Now(),
+    pingRate: time.Duration(config.PING_RATE) * time.Second,
+    lastPing: time.Now(),
+    fromPlayers: make(chan tcp.TCPMsg, 1000),
     life: make(chan struct{}),
     shutdown: make(chan struct{}),
   }
 
-  go ws.live(*flagPort)
+  if config.CHAT_WORDS != "" {
+    words, err := os.ReadFile(config.CHAT_WORDS)
+    if err != nil {
+      log.Fatal(err)
+    }
+    w.SetChatFilter(world.WordFilter(strings.Split(string(words), "\n")))
+  }
+  if config.SHIPS != "" {
+    ships, err := player.LoadShips(config.SHIPS)
+    if err != nil {
+      log.Fatal(err)
+    }
+    plrs.SetShips(ships)
+  }
+
+  if config.WORLD_METRICS_ADDR != "" {
+    reg := metrics.NewRegistry()
+    ws.tcpMetrics = tcp.NewTCPMetrics(reg)
+    w.RegisterMetrics(reg)
+    ws.registerMetrics(reg)
+    go reg.Serve(config.WORLD_METRICS_ADDR)
+  }
+
+  go ws.live(config.WORLD_PORT, config.LINK_PORT)
   <-ws.life
 
-  log.Printf("end")
+  worldLog.Info("end")
 }
 
-func (ws *worldServer) live(port uint) {
+func (ws *worldServer) live(port, linkPort int) {
   defer close(ws.life)
 
+  go ws.listenForPhysics(linkPort)
+  go ws.handleSignals()
+  go ws.serveAdmin()
+  go ws.handlePlayers()
+
   go func() {
-    log.Printf("Awaiting simulation...")
     addr := fmt.Sprintf("tcp://:%d", port);
     err := gnet.Serve(ws, addr, gnet.WithMulticore(true), gnet.WithTicker(true), gnet.WithReusePort(true))
     if err != nil {
@@ -93,24 +161,69 @@ func (ws *worldServer) live(port uint) {
   <-ws.shutdown
 }
 
-func (ws *worldServer) initPlayerConnection(c gnet.Conn) {
+// Hold a new connection until it sends LOGIN, see login.
+func (ws *worldServer) acceptPlayer(c gnet.Conn) {
   // TODO: auth
   // TODO: get this from db via auth token
   id := uuid.New()
-  tcpPlr := tcp.NewPlayer(c, id, &ws.msgFactory)
-  plr := ws.players.Add(tcpPlr)
+  tcpPlr := tcp.NewPlayer(ws.fromPlayers, transport.GnetTCP{Conn: c}, id, &ws.msgFactory, ws.tcpMetrics)
+
+  // keyed by ip:port, several players can share an ip
+  ws.addrToId.Store(c.RemoteAddr().String(), id)
+  ws.idToConn.Store(id, c)
+  ws.loggingIn.Store(id, &pendingPlayer{tcp: tcpPlr, opened: time.Now()})
+}
+
+// Runs on the event loop for a connection that hasn't joined.
+// handlePlayers wakes it once the LOGIN in data has been read.
+func (ws *worldServer) login(c gnet.Conn, pend *pendingPlayer, data []byte) gnet.Action {
+  id := pend.tcp.Id
+  if err := pend.tcp.Rx(data); err != nil {
+    worldLog.Info("closing", "player", id, "err", err)
+    return gnet.Close
+  }
+
+  name, ok := ws.logins.Load(id)
+  if !ok {
+    return gnet.None
+  }
+
+  maxPlayers := helpers.GetConfig().MAX_PLAYERS
+  team := ws.wld.PickTeam()
+  sl := ws.routePlayer(team)
+  if sl == nil || (maxPlayers > 0 && ws.players.Count() >= maxPlayers) {
+    // still logging in, so closing forgets them quietly
+    worldLog.Info("rejected at login", "player", id, "addr", c.RemoteAddr().String())
+    return gnet.Close
+  }
+
+  ws.logins.Delete(id)
+  ws.loggingIn.Delete(id)
+  ws.initPlayerConnection(c, pend.tcp, sl, team, name.(string))
+  return gnet.None
+}
+
+func (ws *worldServer) initPlayerConnection(c gnet.Conn, tcpPlr *tcp.TCPPlayer, sl *simLink, team byte, name string) {
+  id := tcpPlr.Id
+  plr, nameErr := ws.players.Add(tcpPlr, team, name)
 
   addr := c.RemoteAddr().(*net.TCPAddr).IP
-  ws.addrToId.Store(addr.String(), id)
+  ws.idToAddr.Store(id, addr)
+  ws.playerLinks.Store(id, sl)
 
-  ws.wld.PlayerJoin(plr, ws.physicsIP, ws.physicsPort)
+  ws.wld.PlayerJoin(plr, sl.ip, sl.port)
+  if nameErr != nil {
+    // joined under a default name, say why
+    ws.wld.SystemChat(id, nameErr.Error())
+  }
 
   // Tell the physics server about this client
-  packet := []byte{byte(snet.IJoin)}
-  packet = append(packet, id[0:]...)
-  packet = append(packet, byte(len(addr)))
-  packet = append(packet, addr...)
-  ws.physics.AsyncWrite(packet)
+  var joinMsg link.JoinMsg
+  joinMsg.PlayerId = id
+  joinMsg.Ip = addr
+  joinMsg.Team = team
+  joinMsg.Stats = plr.Stats
+  sl.send(&joinMsg)
 
   plr.Tcp.Connected()
 
@@ -118,45 +231,62 @@ func (ws *worldServer) initPlayerConnection(c gnet.Conn) {
 }
 
 func (ws *worldServer) closePlayerConnection(c gnet.Conn) {
-  id, ok := ws.addrToId.Load(c.RemoteAddr().(*net.TCPAddr).IP.String())
+  id, ok := ws.addrToId.Load(c.RemoteAddr().String())
   if ok {
     playerId := id.(uuid.UUID)
 
+    if _, ok := ws.loggingIn.Load(playerId); ok {
+      // never joined, no one else knows of them
+      ws.loggingIn.Delete(playerId)
+      ws.addrToId.Delete(c.RemoteAddr().String())
+      ws.idToConn.Delete(playerId)
+      ws.kicked.Delete(playerId)
+      ws.logins.Delete(playerId)
+      return
+    }
+
+    ws.addrToId.Delete(c.RemoteAddr().String())
+    ws.idToAddr.Delete(playerId)
+    ws.idToConn.Delete(playerId)
+    ws.kicked.Delete(playerId)
     ws.wld.PlayerLeave(playerId)
 
     // Tell physics about this
-    packet := []byte{byte(snet.ILeave)}
-    packet = append(packet, playerId[0:]...)
-    ws.physics.AsyncWrite(packet)
+    if sl, ok := ws.playerLinks.Load(playerId); ok {
+      var leaveMsg link.LeaveMsg
+      leaveMsg.PlayerId = playerId
+      sl.(*simLink).send(&leaveMsg)
+      ws.playerLinks.Delete(playerId)
+    }
   }
 }
 
-func (ws *worldServer) initPhysicsConnection(c gnet.Conn) (out []byte) {
-  ws.physics = c
-  ws.physicsIP = snet.GetOutboundIP()
-  ws.state = snet.SETUP
-  log.Printf("Physics server connected, sending blocks.")
-
-  return
-}
-
 func (ws *worldServer) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
-  log.Printf("[%s] o", c.RemoteAddr().String())
+  worldLog.Debug("opened", "addr", c.RemoteAddr().String())
+
+  if atomic.LoadInt32(&ws.stopping) == 1 {
+    worldLog.Info("rejected, shutting down", "addr", c.RemoteAddr().String())
+    action = gnet.Close
+    return
+  }
 
   switch ws.state {
     case snet.WAIT_PHYS:
-      // check if this is the physics server
-      if isPhysicsConnection(c) {
-        out = ws.initPhysicsConnection(c)
-      } else {
-        action = gnet.Close
-      }
+      // deny connections, physics uses the link port
+      action = gnet.Close
     case snet.SETUP:
       // deny connections
       action = gnet.Close
-    case snet.ALIVE:
-      // accept connections
-      ws.initPlayerConnection(c)
+    case snet.ALIVE, snet.DEGRADED:
+      // accept connections while a SIM can take them
+      // checked again at login, when the player joins
+      maxPlayers := helpers.GetConfig().MAX_PLAYERS
+      sl := ws.routePlayer(ws.wld.PickTeam())
+      if sl == nil || (maxPlayers > 0 && ws.players.Count() >= maxPlayers) {
+        action = gnet.Close
+      } else {
+        ws.acceptPlayer(c)
+      }
     case snet.SHUTDOWN:
       // deny connections
       action = gnet.Close
@@ -166,42 +296,91 @@ func (ws *worldServer) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
   }
 
   if action == gnet.Close {
-    log.Printf("[%s] rejected due to state=%d", c.RemoteAddr().String(), ws.state)
+    worldLog.Info("rejected", "addr", c.RemoteAddr().String(), "state", ws.state)
   }
 
   return
 }
 
 func (ws *worldServer) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
-  log.Printf("[%s] x", c.RemoteAddr().String())
+  worldLog.Debug("closed", "addr", c.RemoteAddr().String())
 
-  if !isPhysicsConnection(c) {
-    ws.closePlayerConnection(c);
-  }
+  ws.closePlayerConnection(c);
 
   return
 }
 
 func (ws *worldServer) React(data []byte, c gnet.Conn) (out []byte, action gnet.Action) {
-  bytes := append([]byte{}, data...)
+  ws.tcpMetrics.Received(len(data))
+
+  id, ok := ws.addrToId.Load(c.RemoteAddr().String())
+  if ok {
+    if _, kicked := ws.kicked.Load(id); kicked {
+      action = gnet.Close
+    } else if pend, ok := ws.loggingIn.Load(id); ok {
+      action = ws.login(c, pend.(*pendingPlayer), data)
+    } else if plr := ws.players.GetPlayer(id.(uuid.UUID)); plr != nil {
+      if err := plr.Tcp.Rx(data); err != nil {
+        worldLog.Info("closing", "player", id, "err", err)
+        action = gnet.Close
+      }
+    }
+  }
   c.ResetBuffer()
-  if isPhysicsConnection(c) {
-    if ws.state == snet.SETUP && len(bytes) >= 5 && bytes[0] == byte(snet.IReady) {
-      ws.physicsPort = snet.Read_uint32(bytes[1:])
-      log.Printf("Accepting player connections...")
-      ws.state = snet.ALIVE
-    } else {
-      _ = ws.pool.Submit(func() {
-        ws.wld.InterpretPhysics(bytes)
-      })
+  return
+}
+
+// Handles what clients send, one message at a time
+// in the order they arrived.
+func (ws *worldServer) handlePlayers() {
+  for m := range ws.fromPlayers {
+    switch t := m.(type) {
+      case *msg.ChatMsg:
+        if err := ws.wld.Chat(t.GetPlayerId(), t); err != nil {
+          worldLog.Debug("chat refused", "player", t.GetPlayerId(), "err", err)
+        }
+      case *msg.LoginMsg:
+        // joined on the event loop, see login
+        if _, ok := ws.loggingIn.Load(t.GetPlayerId()); ok {
+          ws.logins.Store(t.GetPlayerId(), t.Name)
+          if c, ok := ws.idToConn.Load(t.GetPlayerId()); ok {
+            c.(gnet.Conn).Wake()
+          }
+        }
+      case *msg.PlayerUpdateMsg:
+        if err := ws.wld.Rename(t.GetPlayerId(), t.Name); err != nil {
+          worldLog.Debug("rename refused", "player", t.GetPlayerId(), "err", err)
+        }
+      case *msg.PongMsg:
+        ws.wld.Pong(t.GetPlayerId(), t)
     }
   }
+}
 
-  return
+// Close a player's connection from outside the event loop.
+// Wake runs React on the loop, which closes it.
+func (ws *worldServer) kick(id uuid.UUID) bool {
+  c, ok := ws.idToConn.Load(id)
+  if !ok {
+    return false
+  }
+
+  ws.kicked.Store(id, true)
+  c.(gnet.Conn).Wake()
+  return true
 }
 
 func (ws *worldServer) OnShutdown(s gnet.Server) {
   ws.state = snet.DEAD
+
+  // wait for any periodic save to finish, then flush the rest.
+  for !atomic.CompareAndSwapInt32(&ws.saving, 0, 1) {
+    time.Sleep(10 * time.Millisecond)
+  }
+  if err := ws.wld.Save(); err != nil {
+    worldLog.Error("failed to save map on shutdown", "err", err)
+  }
+
   close(ws.shutdown)
 }
 
@@ -210,15 +389,70 @@ func (ws *worldServer) Tick() (delay time.Duration, action gnet.Action) {
 
   if ws.state == snet.SHUTDOWN {
     action = gnet.Shutdown
+    return
+  }
+
+  if time.Since(ws.lastSave) >= ws.saveRate {
+    ws.lastSave = time.Now()
+    ws.save()
+  }
+  ws.expireLogins()
+  if time.Since(ws.lastPing) >= ws.pingRate {
+    ws.lastPing = time.Now()
+    ws.ping()
   }
 
   return
 }
 
-// TODO: find some real way to validate this.
-func isPhysicsConnection(c gnet.Conn) bool {
-  tcpAddr := c.RemoteAddr().(*net.TCPAddr)
-  return tcpAddr.Port == 9499
+// Close connections that didn't send LOGIN in time.
+func (ws *worldServer) expireLogins() {
+  ws.loggingIn.Range(func(key, value interface{}) bool {
+    id := key.(uuid.UUID)
+    if time.Since(value.(*pendingPlayer).opened) < loginTimeout {
+      return true
+    }
+    if _, kicked := ws.kicked.Load(id); !kicked && ws.kick(id) {
+      worldLog.Info("disconnecting, no login", "player", id)
+    }
+    return true
+  })
 }
 
+// PING everyone and disconnect whoever stopped answering,
+// closePlayerConnection tells their SIM once the socket closes.
+func (ws *worldServer) ping() {
+  for _, id := range ws.wld.Ping(helpers.NowMillis()) {
+    if _, kicked := ws.kicked.Load(id); !kicked && ws.kick(id) {
+      worldLog.Info("disconnecting, no pong", "player", id)
+    }
+  }
+}
+
+// Save now, waiting for a periodic save already running.
+func (ws *worldServer) saveNow() error {
+  for !atomic.CompareAndSwapInt32(&ws.saving, 0, 1) {
+    time.Sleep(10 * time.Millisecond)
+  }
+  defer atomic.StoreInt32(&ws.saving, 0)
+  return ws.wld.Save()
+}
+
+// Periodically write modified terrain back to disk
+// and drop files that haven't been used in a while.
+func (ws *worldServer) save() {
+  if !atomic.CompareAndSwapInt32(&ws.saving, 0, 1) {
+    return
+  }
 
+  err := ws.pool.Submit(func() {
+    defer atomic.StoreInt32(&ws.saving, 0)
+    if err := ws.wld.Save(); err != nil {
+      worldLog.Error("failed to save map", "err", err)
+    }
+    ws.wld.Evict(time.Now().Add(-ws.evictAge).UnixNano() / int64(time.Millisecond))
+  })
+  if err != nil {
+    atomic.StoreInt32(&ws.saving, 0)
+  }
+}
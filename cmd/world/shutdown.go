@@ -0,0 +1,85 @@
+package main
+
+import(
+  "os"
+  "time"
+  "syscall"
+  "os/signal"
+  "sync/atomic"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+)
+
+// SIGINT/SIGTERM:
+//   1) stop accepting players,
+//   2) tell clients and every SIM,
+//   3) wait for queued messages to be written,
+//   4) stop gnet, which saves the map in OnShutdown.
+// Exits anyway after shutdownTimeout. A second signal exits at once.
+
+const flushPoll time.Duration = 50 * time.Millisecond
+
+// Time for the last queued message to leave TCPPlayer.Tx and gnet.
+const flushGrace time.Duration = 300 * time.Millisecond
+
+func (ws *worldServer) handleSignals() {
+  signals := make(chan os.Signal, 2)
+  signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+  sig := <-signals
+  worldLog.Info("shutting down", "signal", sig)
+  go ws.beginShutdown()
+
+  sig = <-signals
+  worldLog.Warn("exiting now", "signal", sig)
+  os.Exit(1)
+}
+
+func (ws *worldServer) beginShutdown() {
+  if !atomic.CompareAndSwapInt32(&ws.stopping, 0, 1) {
+    return
+  }
+
+  timeout := time.Duration(helpers.GetConfig().SHUTDOWN_TIMEOUT) * time.Second
+  deadline := time.Now().Add(timeout)
+  time.AfterFunc(timeout, func() {
+    worldLog.Error("shutdown took too long, exiting", "timeout", timeout)
+    os.Exit(1)
+  })
+
+  ws.wld.Shutdown()
+
+  ws.linksLock.Lock()
+  links := append([]*simLink{}, ws.links...)
+  ws.linksLock.Unlock()
+  for _, sl := range links {
+    var shutdownMsg link.ShutdownMsg
+    sl.send(&shutdownMsg)
+  }
+
+  // leave half the time for saving the map.
+  flushBy := time.Now().Add(time.Until(deadline) / 2)
+  for ws.pending() > 0 && time.Now().Before(flushBy) {
+    time.Sleep(flushPoll)
+  }
+  if n := ws.pending(); n > 0 {
+    worldLog.Warn("gave up on queued messages", "count", n)
+  }
+  time.Sleep(flushGrace)
+
+  ws.state = snet.SHUTDOWN
+}
+
+func (ws *worldServer) pending() int {
+  pending := ws.players.Pending()
+
+  ws.linksLock.Lock()
+  for _, sl := range ws.links {
+    pending += len(sl.out)
+  }
+  ws.linksLock.Unlock()
+
+  return pending
+}
@@ -0,0 +1,299 @@
+package main
+
+import(
+  "net"
+  "sync"
+  "errors"
+  "sync/atomic"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+  "go-space-serv/internal/space/metrics"
+)
+
+// One SIM and the region of the map it owns.
+// A simLink outlives its connection so players in its region
+// can wait for a SIM claiming the same region to come back.
+type simLink struct {
+  dropped uint64            // atomic, msgs refused by a full out
+
+  id      uint16
+  region  snet.Region
+  ip      net.IP
+  port    uint32
+
+  lock    sync.Mutex
+  conn    net.Conn          // nil while lost
+  out     chan link.LinkMsg
+}
+
+var errRegionTaken = errors.New("region overlaps another simulation")
+
+// Queues m without waiting on a stuck SIM. A full queue drops it,
+// a SIM that far behind is brought up to date by replayJoins
+// once its link comes back.
+func (sl *simLink) send(m link.LinkMsg) {
+  select {
+    case sl.out <- m:
+    default:
+      atomic.AddUint64(&sl.dropped, 1)
+      linkLog.Warn("dropped msg for full queue", "region", sl.region, "cmd", m.GetCmd())
+  }
+}
+
+func (sl *simLink) isLive() bool {
+  sl.lock.Lock()
+  defer sl.lock.Unlock()
+  return sl.conn != nil
+}
+
+// Messages sent while the link is lost are dropped,
+// the returning SIM is brought up to date by replayJoins.
+func (sl *simLink) tx() {
+  for m := range sl.out {
+    frame, err := link.Encode(m)
+    if err != nil {
+      linkLog.Error("dropped msg for physics", "region", sl.region, "cmd", m.GetCmd(), "err", err)
+      continue
+    }
+
+    sl.lock.Lock()
+    c := sl.conn
+    sl.lock.Unlock()
+    if c != nil {
+      c.Write(frame)
+    }
+  }
+}
+
+// Give the connection the link for its region, reusing a lost one
+// with the same region or making a new one. Lost links the new
+// region only overlaps are retired and their players moved over.
+func (ws *worldServer) attachLink(c net.Conn, ready *link.ReadyMsg) (*simLink, error) {
+  ws.linksLock.Lock()
+  var sl *simLink
+  retired := []*simLink{}
+  for _, l := range ws.links {
+    if !l.region.Overlaps(ready.Region) {
+      continue
+    }
+    if l.isLive() {
+      ws.linksLock.Unlock()
+      return nil, errRegionTaken
+    }
+    if l.region == ready.Region {
+      sl = l
+    } else {
+      retired = append(retired, l)
+    }
+  }
+
+  if len(retired) > 0 {
+    kept := []*simLink{}
+    for _, l := range ws.links {
+      if !containsLink(retired, l) {
+        kept = append(kept, l)
+      }
+    }
+    ws.links = kept
+  }
+
+  returning := sl != nil
+  if !returning {
+    sl = &simLink{
+      id: ws.nextLinkId,
+      region: ready.Region,
+      out: make(chan link.LinkMsg, 64),
+    }
+    ws.nextLinkId++
+    ws.links = append(ws.links, sl)
+    go sl.tx()
+  }
+
+  sl.lock.Lock()
+  sl.conn = c
+  sl.ip = simAddress(c)
+  sl.port = ready.Port
+  sl.lock.Unlock()
+  ws.linksLock.Unlock()
+
+  // their SIM sessions went with the old process, tx of
+  // a retired link keeps dropping whatever is still sent to it.
+  for _, old := range retired {
+    for _, id := range ws.playersOf(old) {
+      ws.playerLinks.Store(id, sl)
+    }
+    ws.wld.ForgetSim(old.id)
+    linkLog.Info("retired physics link", "region", old.region, "for", sl.region)
+    returning = true
+  }
+
+  if returning {
+    ws.replayJoins(sl)
+    ws.wld.PhysicsMoved(ws.playersOf(sl), sl.ip, sl.port)
+  }
+
+  linkLog.Info("physics ready", "region", sl.region, "ip", sl.ip, "port", sl.port)
+  ws.updateState()
+  return sl, nil
+}
+
+func containsLink(links []*simLink, sl *simLink) bool {
+  for _, l := range links {
+    if l == sl {
+      return true
+    }
+  }
+  return false
+}
+
+// Keep the link's players connected and wait for a SIM to take
+// over its region, it may be the same one with their sessions or a new one.
+func (ws *worldServer) detachLink(sl *simLink) {
+  sl.lock.Lock()
+  sl.conn = nil
+  sl.lock.Unlock()
+
+  if atomic.LoadInt32(&ws.stopping) == 0 {
+    ws.wld.PhysicsLost(ws.playersOf(sl))
+  }
+  linkLog.Warn("physics lost, awaiting simulation", "region", sl.region)
+  ws.updateState()
+}
+
+// WAIT_PHYS until a SIM is ready, DEGRADED while any region has lost its SIM.
+func (ws *worldServer) updateState() {
+  ws.linksLock.Lock()
+  defer ws.linksLock.Unlock()
+
+  if ws.state >= snet.SHUTDOWN {
+    return
+  }
+
+  state := snet.WAIT_PHYS
+  for _, l := range ws.links {
+    if !l.isLive() {
+      state = snet.DEGRADED
+      break
+    }
+    state = snet.ALIVE
+  }
+
+  if state != ws.state {
+    if state == snet.ALIVE {
+      worldLog.Info("accepting player connections")
+    }
+    ws.state = state
+  }
+}
+
+// Live link owning cell x/y.
+func (ws *worldServer) findLink(x, y int) *simLink {
+  ws.linksLock.Lock()
+  defer ws.linksLock.Unlock()
+
+  for _, l := range ws.links {
+    if l.region.Contains(x, y) && l.isLive() {
+      return l
+    }
+  }
+  return nil
+}
+
+// New players start on the SIM owning their team's spawn zone,
+// or any live SIM if that region is down.
+func (ws *worldServer) routePlayer(team byte) *simLink {
+  if sl := ws.findLink(ws.wld.SpawnCell(team)); sl != nil {
+    return sl
+  }
+
+  ws.linksLock.Lock()
+  defer ws.linksLock.Unlock()
+  for _, l := range ws.links {
+    if l.isLive() {
+      return l
+    }
+  }
+  return nil
+}
+
+func (ws *worldServer) playersOf(sl *simLink) []uuid.UUID {
+  ids := []uuid.UUID{}
+  ws.playerLinks.Range(func(key, value interface{}) bool {
+    if value.(*simLink) == sl {
+      ids = append(ids, key.(uuid.UUID))
+    }
+    return true
+  })
+  return ids
+}
+
+// Tell a returning SIM about every player in its region.
+// SIM ignores the ones it already has.
+func (ws *worldServer) replayJoins(sl *simLink) {
+  ids := ws.playersOf(sl)
+  for _, id := range ids {
+    ip, ok := ws.idToAddr.Load(id)
+    if !ok {
+      continue
+    }
+    var joinMsg link.JoinMsg
+    joinMsg.PlayerId = id
+    joinMsg.Ip = ip.(net.IP)
+    if plr := ws.players.GetPlayer(id); plr != nil {
+      joinMsg.Team = plr.Team
+      joinMsg.Stats = plr.Stats
+    }
+    sl.send(&joinMsg)
+  }
+  linkLog.Info("replayed players to physics", "region", sl.region, "players", len(ids))
+}
+
+// Address clients use to reach this SIM.
+func simAddress(c net.Conn) net.IP {
+  if helpers.GetConfig().SIM_HOST != "" {
+    return net.ParseIP(helpers.GetConfig().SIM_HOST)
+  }
+
+  ip := c.RemoteAddr().(*net.TCPAddr).IP
+  if ip.IsLoopback() {
+    // same machine as WORLD, give clients something they can reach
+    return snet.GetOutboundIP()
+  }
+  return ip
+}
+
+func (ws *worldServer) registerMetrics(r *metrics.Registry) {
+  r.GaugeFunc("space_world_sims", "SIMs currently linked to WORLD.", func() float64 {
+    ws.linksLock.Lock()
+    defer ws.linksLock.Unlock()
+    live := 0
+    for _, sl := range ws.links {
+      if sl.isLive() {
+        live++
+      }
+    }
+    return float64(live)
+  })
+  r.GaugeFunc("space_link_outgoing_queue", "Link messages waiting to go to SIMs.", func() float64 {
+    ws.linksLock.Lock()
+    defer ws.linksLock.Unlock()
+    pending := 0
+    for _, sl := range ws.links {
+      pending += len(sl.out)
+    }
+    return float64(pending)
+  })
+  r.CounterFunc("space_link_dropped_total", "Link messages dropped because a SIM's queue was full.", func() uint64 {
+    ws.linksLock.Lock()
+    defer ws.linksLock.Unlock()
+    dropped := uint64(0)
+    for _, sl := range ws.links {
+      dropped += atomic.LoadUint64(&sl.dropped)
+    }
+    return dropped
+  })
+}
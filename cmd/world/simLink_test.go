@@ -0,0 +1,30 @@
+package main
+
+import(
+  "time"
+  "testing"
+
+  "go-space-serv/internal/space/snet/link"
+)
+
+// A SIM that stops reading can't hold up whoever sends to it.
+func TestSendDropsWhenFull(t *testing.T) {
+  sl := &simLink{out: make(chan link.LinkMsg, 2)}
+
+  done := make(chan struct{})
+  go func() {
+    for i := 0; i < 5; i++ {
+      sl.send(&link.ShutdownMsg{})
+    }
+    close(done)
+  }()
+  select {
+    case <-done:
+    case <-time.After(time.Second):
+      t.Fatalf("send waited on a full queue")
+  }
+
+  if len(sl.out) != 2 || sl.dropped != 3 {
+    t.Fatalf("queued %d and dropped %d, want 2 and 3", len(sl.out), sl.dropped)
+  }
+}
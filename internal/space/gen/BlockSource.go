@@ -0,0 +1,32 @@
+package gen
+
+import(
+  "go-space-serv/internal/space/world"
+)
+
+// Anything that can decide what block is at a coordinate.
+// Must be safe to call from several goroutines.
+type BlockSource interface {
+  BlockAt(x, y uint32) world.BlockType
+}
+
+// Fills fileBytes with every block in the file,
+// chunk by chunk, row by row.
+func FillFile(info world.WorldInfo, src BlockSource, fileId uint32, fileBytes []byte) {
+  chunkId := fileId * info.ChunksPerFile
+  fileIdx := 0
+
+  for fileChunkId := uint32(0); fileChunkId < info.ChunksPerFile; fileChunkId++ {
+    // chunk coordinate in world space
+    chunkX := chunkId % info.Size
+    chunkY := chunkId / info.Size
+
+    for y := uint32(0); y < info.ChunkSize; y++ {
+      for x := uint32(0); x < info.ChunkSize; x++ {
+        fileBytes[fileIdx] = byte(src.BlockAt((chunkX * info.ChunkSize) + x, (chunkY * info.ChunkSize) + y))
+        fileIdx++
+      }
+    }
+    chunkId++
+  }
+}
@@ -0,0 +1,44 @@
+package gen
+
+import(
+  "github.com/ojrac/opensimplex-go"
+)
+
+// Sums several octaves of simplex noise.
+// Each octave multiplies frequency by lacunarity
+// and amplitude by persistence.
+type FractalNoise struct {
+  noise opensimplex.Noise
+  profile NoiseProfile
+  norm float64
+}
+
+func NewFractalNoise(seed int64, profile NoiseProfile) *FractalNoise {
+  var fn FractalNoise
+  fn.noise = opensimplex.New(seed)
+  fn.profile = profile
+
+  // normalize so output stays in the range of a single octave
+  amplitude := 1.0
+  fn.norm = 0
+  for i := 0; i < profile.Octaves; i++ {
+    fn.norm += amplitude
+    amplitude *= profile.Persistence
+  }
+
+  return &fn
+}
+
+func (fn *FractalNoise) Eval2(x, y float64) float64 {
+  result := 0.0
+  amplitude := 1.0
+  frequency := fn.profile.Scale
+
+  for i := 0; i < fn.profile.Octaves; i++ {
+    result += fn.noise.Eval2(x * frequency, y * frequency) * amplitude
+    frequency *= fn.profile.Lacunarity
+    amplitude *= fn.profile.Persistence
+  }
+
+  return result / fn.norm
+}
@@ -0,0 +1,124 @@
+package gen
+
+import(
+  "os"
+  "fmt"
+  "errors"
+  "io/ioutil"
+  "encoding/json"
+
+  "go-space-serv/internal/space/world"
+)
+
+// Describes how a map is generated.
+// Loaded from a json file so maps can be tuned without recompiling.
+type GenProfile struct {
+  Terrain     NoiseProfile    `json:"terrain"`
+  Biome       NoiseProfile    `json:"biome"`
+  Biomes      []BiomeProfile  `json:"biomes"`
+  SpawnZones  []SpawnZone     `json:"spawnZones"`
+}
+
+type NoiseProfile struct {
+  Scale       float64 `json:"scale"`
+  Octaves     int     `json:"octaves"`
+  Lacunarity  float64 `json:"lacunarity"`
+  Persistence float64 `json:"persistence"`
+}
+
+// A biome covers every block whose biome noise is below Max
+// and above the Max of the previous biome.
+type BiomeProfile struct {
+  Name        string  `json:"name"`
+  Max         float64 `json:"max"`
+  Block       string  `json:"block"`
+  Threshold   float64 `json:"threshold"`
+
+  blockType   world.BlockType
+}
+
+// Single octave, single biome.
+// Matches maps generated before profiles existed.
+func DefaultGenProfile(threshold float64) GenProfile {
+  var gp GenProfile
+  gp.Terrain = NoiseProfile{Scale: 0.05, Octaves: 1, Lacunarity: 2, Persistence: 0.5}
+  gp.Biome = NoiseProfile{Scale: 0.005, Octaves: 1, Lacunarity: 2, Persistence: 0.5}
+  gp.Biomes = []BiomeProfile{
+    {Name: "default", Max: 1, Block: "GRAY", Threshold: threshold, blockType: world.GRAY},
+  }
+
+  return gp
+}
+
+func LoadGenProfile(fileName string) (GenProfile, error) {
+  var gp GenProfile
+
+  f, err := os.Open(fileName)
+  if err != nil {
+    return gp, err
+  }
+  defer f.Close()
+
+  data, err := ioutil.ReadAll(f)
+  if err != nil {
+    return gp, err
+  }
+
+  if err = json.Unmarshal(data, &gp); err != nil {
+    return gp, fmt.Errorf("%s: %s", fileName, err)
+  }
+
+  if err = gp.Validate(); err != nil {
+    return gp, fmt.Errorf("%s: %s", fileName, err)
+  }
+
+  return gp, nil
+}
+
+// Checks values and resolves block names.
+func (gp *GenProfile) Validate() error {
+  if err := gp.Terrain.validate("terrain"); err != nil {
+    return err
+  }
+
+  if len(gp.Biomes) == 0 {
+    return errors.New("at least one biome is required")
+  }
+
+  if len(gp.Biomes) > 1 {
+    if err := gp.Biome.validate("biome"); err != nil {
+      return err
+    }
+  }
+
+  for i := range gp.Biomes {
+    b := &gp.Biomes[i]
+    t, err := world.ParseBlockType(b.Block)
+    if err != nil {
+      return fmt.Errorf("biome %q: %s", b.Name, err)
+    }
+    if t == world.EMPTY {
+      return fmt.Errorf("biome %q: block must not be EMPTY", b.Name)
+    }
+    b.blockType = t
+
+    if i > 0 && b.Max <= gp.Biomes[i-1].Max {
+      return fmt.Errorf("biome %q: max must be greater than the previous biome", b.Name)
+    }
+  }
+
+  return nil
+}
+
+func (np NoiseProfile) validate(name string) error {
+  if np.Scale <= 0 {
+    return fmt.Errorf("%s: scale must be positive", name)
+  }
+  if np.Octaves < 1 {
+    return fmt.Errorf("%s: octaves must be at least 1", name)
+  }
+  if np.Octaves > 1 && (np.Lacunarity <= 0 || np.Persistence <= 0) {
+    return fmt.Errorf("%s: lacunarity and persistence must be positive", name)
+  }
+  return nil
+}
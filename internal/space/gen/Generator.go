@@ -0,0 +1,54 @@
+package gen
+
+import(
+  "go-space-serv/internal/space/world"
+)
+
+// Read only after construction, safe to share between goroutines.
+type Generator struct {
+  info    world.WorldInfo
+  profile GenProfile
+  terrain *FractalNoise
+  biome   *FractalNoise
+}
+
+// profile must have been validated.
+func NewGenerator(info world.WorldInfo, profile GenProfile) *Generator {
+  var g Generator
+  g.info = info
+  g.profile = profile
+  g.terrain = NewFractalNoise(int64(info.Seed), profile.Terrain)
+  if len(profile.Biomes) > 1 {
+    g.biome = NewFractalNoise(int64(info.Seed) + 1, profile.Biome)
+  }
+
+  return &g
+}
+
+// Block coordinates are in world space.
+func (g *Generator) BlockAt(x, y uint32) world.BlockType {
+  b := g.biomeAt(x, y)
+  noiseVal := g.terrain.Eval2(float64(x), float64(y))
+
+  if noiseVal > b.Threshold {
+    return b.blockType
+  }
+
+  return world.EMPTY
+}
+
+func (g *Generator) biomeAt(x, y uint32) *BiomeProfile {
+  biomes := g.profile.Biomes
+  if g.biome == nil {
+    return &biomes[0]
+  }
+
+  val := g.biome.Eval2(float64(x), float64(y))
+  for i := range biomes {
+    if val <= biomes[i].Max {
+      return &biomes[i]
+    }
+  }
+
+  return &biomes[len(biomes) - 1]
+}
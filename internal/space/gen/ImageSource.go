@@ -0,0 +1,85 @@
+package gen
+
+import(
+  "os"
+  "fmt"
+  "image"
+  _ "image/png"
+
+  "go-space-serv/internal/space/world"
+)
+
+// Chunk ids are uint16, so a map is at most 256 chunks a side.
+const MAX_MAP_SIZE uint32 = 256
+
+// Blocks painted in an image, one pixel per block.
+// Anything outside the image is EMPTY.
+type ImageSource struct {
+  width   uint32
+  height  uint32
+  blocks  []world.BlockType
+}
+
+// Colours are resolved through the palette up front
+// so lookups during generation are cheap.
+func LoadImageSource(fileName string, palette *Palette) (*ImageSource, error) {
+  f, err := os.Open(fileName)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  img, _, err := image.Decode(f)
+  if err != nil {
+    return nil, err
+  }
+
+  bounds := img.Bounds()
+  var src ImageSource
+  src.width = uint32(bounds.Dx())
+  src.height = uint32(bounds.Dy())
+  src.blocks = make([]world.BlockType, src.width * src.height)
+
+  idx := 0
+  for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+    for x := bounds.Min.X; x < bounds.Max.X; x++ {
+      src.blocks[idx] = palette.BlockOf(img.At(x, y))
+      idx++
+    }
+  }
+
+  return &src, nil
+}
+
+func (src *ImageSource) BlockAt(x, y uint32) world.BlockType {
+  if x >= src.width || y >= src.height {
+    return world.EMPTY
+  }
+  return src.blocks[y * src.width + x]
+}
+
+func (src *ImageSource) Bounds() (width, height uint32) {
+  return src.width, src.height
+}
+
+// Smallest map size in chunks that covers the image
+// and splits evenly into files. Errors past MAX_MAP_SIZE.
+func (src *ImageSource) MapSize(chunkSize, chunksPerFile uint32) (uint32, error) {
+  longest := src.width
+  if src.height > longest {
+    longest = src.height
+  }
+
+  size := (longest + chunkSize - 1) / chunkSize
+  if size == 0 {
+    size = 1
+  }
+  for (size * size) % chunksPerFile != 0 {
+    size++
+  }
+
+  if size > MAX_MAP_SIZE {
+    return 0, fmt.Errorf("%dx%d image needs %d chunks a side, at most %d fit", src.width, src.height, size, MAX_MAP_SIZE)
+  }
+  return size, nil
+}
@@ -0,0 +1,135 @@
+package gen
+
+import(
+  "os"
+  "fmt"
+  "errors"
+  "strconv"
+  "strings"
+  "image/color"
+  "io/ioutil"
+  "encoding/json"
+
+  "go-space-serv/internal/space/world"
+)
+
+// Maps colours to block types and back.
+type Palette struct {
+  entries []PaletteEntry
+}
+
+type PaletteEntry struct {
+  Color   color.RGBA
+  Block   world.BlockType
+}
+
+// Format of a palette file entry.
+// Color is written as "#rrggbb".
+type paletteFileEntry struct {
+  Color   string  `json:"color"`
+  Block   string  `json:"block"`
+}
+
+func DefaultPalette() *Palette {
+  var p Palette
+  p.entries = []PaletteEntry{
+    {color.RGBA{0, 0, 0, 255}, world.EMPTY},
+    {color.RGBA{128, 128, 128, 255}, world.GRAY},
+    {color.RGBA{139, 94, 60, 255}, world.BROWN},
+    {color.RGBA{60, 90, 200, 255}, world.BLUE},
+    {color.RGBA{235, 235, 235, 255}, world.WHITE},
+    {color.RGBA{200, 50, 40, 255}, world.RED},
+  }
+
+  return &p
+}
+
+// Palette files are a json list of {"color": "#rrggbb", "block": "GRAY"}.
+func LoadPalette(fileName string) (*Palette, error) {
+  f, err := os.Open(fileName)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  data, err := ioutil.ReadAll(f)
+  if err != nil {
+    return nil, err
+  }
+
+  var fileEntries []paletteFileEntry
+  if err = json.Unmarshal(data, &fileEntries); err != nil {
+    return nil, fmt.Errorf("%s: %s", fileName, err)
+  }
+
+  if len(fileEntries) == 0 {
+    return nil, fmt.Errorf("%s: palette is empty", fileName)
+  }
+
+  var p Palette
+  for _, fe := range fileEntries {
+    c, err := parseHexColor(fe.Color)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s", fileName, err)
+    }
+
+    t, err := world.ParseBlockType(fe.Block)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s", fileName, err)
+    }
+
+    p.entries = append(p.entries, PaletteEntry{c, t})
+  }
+
+  return &p, nil
+}
+
+// Returns the block type of the nearest colour in the palette.
+func (p *Palette) BlockOf(c color.Color) world.BlockType {
+  rgba := color.RGBAModel.Convert(c).(color.RGBA)
+
+  best := 0
+  bestDist := -1
+  for i, e := range p.entries {
+    dr := int(rgba.R) - int(e.Color.R)
+    dg := int(rgba.G) - int(e.Color.G)
+    db := int(rgba.B) - int(e.Color.B)
+    dist := dr*dr + dg*dg + db*db
+    if bestDist == -1 || dist < bestDist {
+      best = i
+      bestDist = dist
+    }
+  }
+
+  return p.entries[best].Block
+}
+
+// Returns the first colour mapped to t, or magenta if there is none.
+func (p *Palette) ColorOf(t world.BlockType) color.RGBA {
+  for _, e := range p.entries {
+    if e.Block == t {
+      return e.Color
+    }
+  }
+
+  return color.RGBA{255, 0, 255, 255}
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+  var c color.RGBA
+  hex := strings.TrimPrefix(s, "#")
+  if len(hex) != 6 {
+    return c, errors.New(fmt.Sprintf("bad colour %q, expected #rrggbb", s))
+  }
+
+  v, err := strconv.ParseUint(hex, 16, 32)
+  if err != nil {
+    return c, errors.New(fmt.Sprintf("bad colour %q, expected #rrggbb", s))
+  }
+
+  c.R = uint8(v >> 16)
+  c.G = uint8(v >> 8)
+  c.B = uint8(v)
+  c.A = 255
+  return c, nil
+}
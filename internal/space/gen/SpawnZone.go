@@ -0,0 +1,108 @@
+package gen
+
+import(
+  "fmt"
+
+  "go-space-serv/internal/space/world"
+)
+
+// Clear cells required around a spawn point in every direction.
+const SpawnClearance uint32 = 4
+
+// Spawn points found per zone.
+const SpawnPointsPerZone int = 32
+
+// A rectangle of cells, inclusive min, exclusive max,
+// where players of a team may spawn.
+type SpawnZone struct {
+  Team  byte    `json:"team"`
+  MinX  uint32  `json:"minX"`
+  MinY  uint32  `json:"minY"`
+  MaxX  uint32  `json:"maxX"`
+  MaxY  uint32  `json:"maxY"`
+}
+
+// One zone for team 0 around the old hardcoded spawn point.
+func DefaultSpawnZones(info world.WorldInfo) []SpawnZone {
+  sizeInBlocks := info.Size * info.ChunkSize
+  var zone SpawnZone
+  zone.Team = 0
+  zone.MinX = clampSub(world.SPAWNX, 256)
+  zone.MinY = clampSub(world.SPAWNY, 256)
+  zone.MaxX = clampAdd(world.SPAWNX, 256, sizeInBlocks)
+  zone.MaxY = clampAdd(world.SPAWNY, 256, sizeInBlocks)
+
+  if zone.MinX >= zone.MaxX || zone.MinY >= zone.MaxY {
+    zone.MinX = 0
+    zone.MinY = 0
+    zone.MaxX = sizeInBlocks
+    zone.MaxY = sizeInBlocks
+  }
+
+  return []SpawnZone{zone}
+}
+
+// Scans each zone on an even grid for cells whose
+// surroundings are empty. Deterministic for a given source.
+func FindSpawnPoints(info world.WorldInfo, src BlockSource, zones []SpawnZone) ([]world.SpawnPoint, error) {
+  sizeInBlocks := info.Size * info.ChunkSize
+  result := []world.SpawnPoint{}
+
+  for _, zone := range zones {
+    if zone.MaxX > sizeInBlocks { zone.MaxX = sizeInBlocks }
+    if zone.MaxY > sizeInBlocks { zone.MaxY = sizeInBlocks }
+    if zone.MinX >= zone.MaxX || zone.MinY >= zone.MaxY {
+      return nil, fmt.Errorf("spawn zone for team %d is empty or outside the map", zone.Team)
+    }
+
+    // spread candidates across the zone rather than the top left corner.
+    step := (zone.MaxX - zone.MinX) / 16
+    if (zone.MaxY - zone.MinY) / 16 < step {
+      step = (zone.MaxY - zone.MinY) / 16
+    }
+    if step < SpawnClearance * 2 + 1 {
+      step = SpawnClearance * 2 + 1
+    }
+
+    found := 0
+    for y := zone.MinY + SpawnClearance; y + SpawnClearance < zone.MaxY && found < SpawnPointsPerZone; y += step {
+      for x := zone.MinX + SpawnClearance; x + SpawnClearance < zone.MaxX && found < SpawnPointsPerZone; x += step {
+        if isClear(src, x, y) {
+          result = append(result, world.SpawnPoint{Team: zone.Team, X: x, Y: y})
+          found++
+        }
+      }
+    }
+
+    if found == 0 {
+      return nil, fmt.Errorf("no clear spawn point in zone for team %d", zone.Team)
+    }
+  }
+
+  return result, nil
+}
+
+func isClear(src BlockSource, x, y uint32) bool {
+  for cy := y - SpawnClearance; cy <= y + SpawnClearance; cy++ {
+    for cx := x - SpawnClearance; cx <= x + SpawnClearance; cx++ {
+      if src.BlockAt(cx, cy) != world.EMPTY {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+func clampSub(val, sub uint32) uint32 {
+  if val < sub {
+    return 0
+  }
+  return val - sub
+}
+
+func clampAdd(val, add, max uint32) uint32 {
+  if val + add > max {
+    return max
+  }
+  return val + add
+}
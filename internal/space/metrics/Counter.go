@@ -0,0 +1,57 @@
+package metrics
+
+import(
+  "io"
+  "fmt"
+  "sync/atomic"
+)
+
+// Only goes up. Methods on a nil Counter do nothing.
+type Counter struct {
+  metricName  string
+  help        string
+  value       uint64
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+  c := &Counter{metricName: name, help: help}
+  r.register(c)
+  return c
+}
+
+func (c *Counter) Inc() {
+  c.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+  if c != nil {
+    atomic.AddUint64(&c.value, n)
+  }
+}
+
+func (c *Counter) Value() uint64 {
+  return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) name() string { return c.metricName }
+func (c *Counter) write(w io.Writer) {
+  writeHeader(w, c.metricName, c.help, "counter")
+  fmt.Fprintf(w, "%s %d\n", c.metricName, c.Value())
+}
+
+// Counter kept somewhere else, read when scraped.
+type counterFunc struct {
+  metricName  string
+  help        string
+  read        func() uint64
+}
+
+func (r *Registry) CounterFunc(name, help string, read func() uint64) {
+  r.register(&counterFunc{name, help, read})
+}
+
+func (c *counterFunc) name() string { return c.metricName }
+func (c *counterFunc) write(w io.Writer) {
+  writeHeader(w, c.metricName, c.help, "counter")
+  fmt.Fprintf(w, "%s %d\n", c.metricName, c.read())
+}
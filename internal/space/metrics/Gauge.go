@@ -0,0 +1,67 @@
+package metrics
+
+import(
+  "io"
+  "fmt"
+  "math"
+  "strconv"
+  "sync/atomic"
+)
+
+// Goes up and down. Methods on a nil Gauge do nothing.
+type Gauge struct {
+  metricName  string
+  help        string
+  bits        uint64
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+  g := &Gauge{metricName: name, help: help}
+  r.register(g)
+  return g
+}
+
+func (g *Gauge) Set(v float64) {
+  if g != nil {
+    atomic.StoreUint64(&g.bits, math.Float64bits(v))
+  }
+}
+
+func (g *Gauge) Value() float64 {
+  return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) name() string { return g.metricName }
+func (g *Gauge) write(w io.Writer) {
+  writeHeader(w, g.metricName, g.help, "gauge")
+  fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.Value()))
+}
+
+// Gauge read when scraped, e.g. the length of a channel.
+type gaugeFunc struct {
+  metricName  string
+  help        string
+  read        func() float64
+}
+
+func (r *Registry) GaugeFunc(name, help string, read func() float64) {
+  r.register(&gaugeFunc{name, help, read})
+}
+
+func (g *gaugeFunc) name() string { return g.metricName }
+func (g *gaugeFunc) write(w io.Writer) {
+  writeHeader(w, g.metricName, g.help, "gauge")
+  fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.read()))
+}
+
+func formatFloat(v float64) string {
+  switch {
+    case math.IsInf(v, 1):
+      return "+Inf"
+    case math.IsInf(v, -1):
+      return "-Inf"
+    case math.IsNaN(v):
+      return "NaN"
+  }
+  return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import(
+  "io"
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+)
+
+// Counts observations into buckets by upper bound.
+// Methods on a nil Histogram do nothing.
+type Histogram struct {
+  metricName  string
+  help        string
+  bounds      []float64
+
+  lock        sync.Mutex
+  counts      []uint64  // per bucket, not cumulative
+  sum         float64
+  count       uint64
+}
+
+func (r *Registry) Histogram(name, help string, bounds []float64) *Histogram {
+  h := &Histogram{metricName: name, help: help}
+  h.bounds = append([]float64{}, bounds...)
+  sort.Float64s(h.bounds)
+  h.counts = make([]uint64, len(h.bounds))
+  r.register(h)
+  return h
+}
+
+func (h *Histogram) Observe(v float64) {
+  if h == nil {
+    return
+  }
+
+  i := sort.SearchFloat64s(h.bounds, v)
+
+  h.lock.Lock()
+  if i < len(h.counts) {
+    h.counts[i]++
+  }
+  h.sum += v
+  h.count++
+  h.lock.Unlock()
+}
+
+func (h *Histogram) ObserveDuration(d time.Duration) {
+  h.Observe(d.Seconds())
+}
+
+func (h *Histogram) name() string { return h.metricName }
+func (h *Histogram) write(w io.Writer) {
+  h.lock.Lock()
+  counts := append([]uint64{}, h.counts...)
+  sum := h.sum
+  count := h.count
+  h.lock.Unlock()
+
+  writeHeader(w, h.metricName, h.help, "histogram")
+  cumulative := uint64(0)
+  for i, bound := range h.bounds {
+    cumulative += counts[i]
+    fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.metricName, formatFloat(bound), cumulative)
+  }
+  fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.metricName, count)
+  fmt.Fprintf(w, "%s_sum %s\n", h.metricName, formatFloat(sum))
+  fmt.Fprintf(w, "%s_count %d\n", h.metricName, count)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import(
+  "io"
+  "fmt"
+  "sync"
+  "bufio"
+  "net/http"
+
+  "go-space-serv/internal/space/util"
+)
+
+var logger = helpers.Logger("metrics")
+
+// Hand rolled Prometheus text exposition, version 0.0.4.
+// Metrics have no labels, each process serves its own endpoint.
+
+type metric interface {
+  name() string
+  write(w io.Writer)
+}
+
+type Registry struct {
+  lock    sync.Mutex
+  metrics []metric
+}
+
+func NewRegistry() *Registry {
+  var r Registry
+  return &r
+}
+
+func (r *Registry) register(m metric) {
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  for _, other := range r.metrics {
+    if other.name() == m.name() {
+      panic(fmt.Sprintf("metric %s registered twice", m.name()))
+    }
+  }
+  r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+  r.lock.Lock()
+  metrics := append([]metric{}, r.metrics...)
+  r.lock.Unlock()
+
+  bw := bufio.NewWriter(w)
+  for _, m := range metrics {
+    m.write(bw)
+  }
+  return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+  w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+  r.WriteText(w)
+}
+
+// Serves /metrics on addr until the process exits.
+func (r *Registry) Serve(addr string) {
+  mux := http.NewServeMux()
+  mux.Handle("/metrics", r)
+
+  logger.Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", addr))
+  if err := http.ListenAndServe(addr, mux); err != nil {
+    logger.Error("metrics stopped", "err", err)
+  }
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+  fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
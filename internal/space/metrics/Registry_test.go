@@ -0,0 +1,111 @@
+package metrics
+
+import(
+  "bytes"
+  "strings"
+  "testing"
+  "net/http/httptest"
+)
+
+func text(t *testing.T, r *Registry) string {
+  var buf bytes.Buffer
+  if err := r.WriteText(&buf); err != nil {
+    t.Fatal(err)
+  }
+  return buf.String()
+}
+
+// Every kind of metric, in the order registered.
+func TestWriteText(t *testing.T) {
+  r := NewRegistry()
+  c := r.Counter("test_sent_total", "Messages sent.")
+  r.CounterFunc("test_dropped_total", "Messages dropped.", func() uint64 { return 7 })
+  g := r.Gauge("test_players", "Players online.")
+  r.GaugeFunc("test_queue", "Queued messages.", func() float64 { return 0.5 })
+  h := r.Histogram("test_seconds", "How long it took.", []float64{0.1, 1})
+
+  c.Inc()
+  c.Add(2)
+  g.Set(4)
+  h.Observe(0.05)
+  h.Observe(2)
+
+  want := strings.Join([]string{
+    "# HELP test_sent_total Messages sent.",
+    "# TYPE test_sent_total counter",
+    "test_sent_total 3",
+    "# HELP test_dropped_total Messages dropped.",
+    "# TYPE test_dropped_total counter",
+    "test_dropped_total 7",
+    "# HELP test_players Players online.",
+    "# TYPE test_players gauge",
+    "test_players 4",
+    "# HELP test_queue Queued messages.",
+    "# TYPE test_queue gauge",
+    "test_queue 0.5",
+    "# HELP test_seconds How long it took.",
+    "# TYPE test_seconds histogram",
+    "test_seconds_bucket{le=\"0.1\"} 1",
+    "test_seconds_bucket{le=\"1\"} 1",
+    "test_seconds_bucket{le=\"+Inf\"} 2",
+    "test_seconds_sum 2.05",
+    "test_seconds_count 2",
+    "",
+  }, "\n")
+  if got := text(t, r); got != want {
+    t.Fatalf("got\n%s\nwant\n%s", got, want)
+  }
+
+  rec := httptest.NewRecorder()
+  r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+  if rec.Header().Get("Content-Type") != "text/plain; version=0.0.4" || rec.Body.String() != want {
+    t.Fatalf("served %q as %q", rec.Body.String(), rec.Header().Get("Content-Type"))
+  }
+}
+
+// Buckets are cumulative, a value on a bound counts in that
+// bucket, and bounds are sorted whatever order they came in.
+func TestHistogramBuckets(t *testing.T) {
+  r := NewRegistry()
+  h := r.Histogram("test_size", "Sizes.", []float64{10, 1, 100})
+  for _, v := range []float64{0, 1, 1.5, 10, 50, 100, 101, 1000} {
+    h.Observe(v)
+  }
+
+  got := text(t, r)
+  for _, want := range []string{
+    "test_size_bucket{le=\"1\"} 2\n",
+    "test_size_bucket{le=\"10\"} 4\n",
+    "test_size_bucket{le=\"100\"} 6\n",
+    "test_size_bucket{le=\"+Inf\"} 8\n",
+    "test_size_sum 1263.5\n",
+    "test_size_count 8\n",
+  } {
+    if !strings.Contains(got, want) {
+      t.Errorf("missing %q in\n%s", want, got)
+    }
+  }
+  if strings.Index(got, "le=\"1\"") > strings.Index(got, "le=\"10\"") {
+    t.Errorf("bounds out of order in\n%s", got)
+  }
+}
+
+func TestNilMetrics(t *testing.T) {
+  var c *Counter
+  var g *Gauge
+  var h *Histogram
+  c.Inc()
+  g.Set(1)
+  h.Observe(1)
+}
+
+func TestRegisterTwice(t *testing.T) {
+  r := NewRegistry()
+  r.Counter("test_total", "")
+  defer func() {
+    if recover() == nil {
+      t.Fatalf("registered test_total twice")
+    }
+  }()
+  r.Gauge("test_total", "")
+}
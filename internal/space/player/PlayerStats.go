@@ -1,9 +1,9 @@
 package player
 
 type PlayerStats struct {
-  Thrust        float32
-  MaxSpeed      float32
-  Rotation      float32
+  Thrust        float32   `json:"thrust"`
+  MaxSpeed      float32   `json:"maxSpeed"`
+  Rotation      float32   `json:"rotation"`
 }
 
 func DefaultPlayerStats() PlayerStats{
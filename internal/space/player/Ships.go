@@ -0,0 +1,48 @@
+package player
+
+import(
+  "os"
+  "fmt"
+  "errors"
+  "encoding/json"
+)
+
+// Ship definitions by name, read from a json file:
+//
+//   {"default": {"thrust": 12, "maxSpeed": 20, "rotation": 210}}
+//
+// Players fly "default", so every file needs one.
+type Ships map[string]PlayerStats
+
+// Only the built in ship.
+func DefaultShips() Ships {
+  return Ships{"default": DefaultPlayerStats()}
+}
+
+func LoadShips(fileName string) (Ships, error) {
+  data, err := os.ReadFile(fileName)
+  if err != nil {
+    return nil, err
+  }
+
+  var ships Ships
+  if err = json.Unmarshal(data, &ships); err != nil {
+    return nil, fmt.Errorf("%s: %s", fileName, err)
+  }
+  if _, ok := ships["default"]; !ok {
+    return nil, fmt.Errorf("%s: no \"default\" ship", fileName)
+  }
+  for name, stats := range ships {
+    if err = stats.check(); err != nil {
+      return nil, fmt.Errorf("%s: ship %q: %s", fileName, name, err)
+    }
+  }
+  return ships, nil
+}
+
+func (ps PlayerStats) check() error {
+  if ps.Thrust <= 0 || ps.MaxSpeed <= 0 || ps.Rotation <= 0 {
+    return errors.New("thrust, maxSpeed and rotation must be positive")
+  }
+  return nil
+}
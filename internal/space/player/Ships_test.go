@@ -0,0 +1,42 @@
+package player
+
+import(
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func writeShips(t *testing.T, text string) string {
+  fileName := filepath.Join(t.TempDir(), "ships.json")
+  if err := ioutil.WriteFile(fileName, []byte(text), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return fileName
+}
+
+func TestLoadShips(t *testing.T) {
+  ships, err := LoadShips(writeShips(t, `{
+    "default": {"thrust": 10, "maxSpeed": 30, "rotation": 180},
+    "scout": {"thrust": 20, "maxSpeed": 40, "rotation": 270}
+  }`))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ships["default"] != (PlayerStats{10, 30, 180}) || ships["scout"] != (PlayerStats{20, 40, 270}) {
+    t.Fatalf("got %+v", ships)
+  }
+
+  cases := map[string]string{
+    `{"scout": {"thrust": 1, "maxSpeed": 1, "rotation": 1}}`: "no \"default\" ship",
+    `{"default": {"thrust": 1, "maxSpeed": 0, "rotation": 1}}`: "ship \"default\": thrust",
+    `{"default": [1, 2, 3]}`: "json: cannot unmarshal",
+  }
+  for text, want := range cases {
+    fileName := writeShips(t, text)
+    _, err := LoadShips(fileName)
+    if err == nil || !strings.HasPrefix(err.Error(), fileName + ": " + want) {
+      t.Errorf("%s: got %v, want %s", text, err, want)
+    }
+  }
+}
@@ -0,0 +1,157 @@
+package sim
+
+import(
+  "sort"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/sim/msg"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/link"
+)
+
+// Cells around a camera bodies are streamed from,
+// the same square WORLD sends chunks for.
+const SPECTATE_RANGE int = 128
+
+// Where a spectator is looking, following a body or
+// held over a cell. Only touched by the simulation loop.
+type Camera struct {
+  Mode      byte      // msg.CAMERA_NONE, CAMERA_FOLLOW or CAMERA_FREE
+  BodyId    uint16
+  X         int       // cell, moves with the body when following
+  Y         int
+
+  reportedX int       // last cell WORLD was told about
+  reportedY int
+  reported  bool
+}
+
+// Point a spectator's camera where a SPECTATE message asks.
+func (s *Simulation) spectate(player *SimPlayer, m *msg.SpectateMsg) {
+  cam := &player.Camera
+  switch m.Mode {
+    case msg.CAMERA_NONE:
+      cam.Mode = msg.CAMERA_NONE
+    case msg.CAMERA_FOLLOW:
+      bod := s.findBody(m.BodyId)
+      if bod == nil {
+        logger.Debug("spectating missing body", "player", player.Udp.Id, "body", m.BodyId)
+        return
+      }
+      cam.Mode = msg.CAMERA_FOLLOW
+      cam.BodyId = m.BodyId
+      cam.X, cam.Y = s.worldMap.GetCellFromPosition(bod.TargetPosition.X(), bod.TargetPosition.Y())
+    case msg.CAMERA_FREE:
+      if !s.worldMap.InBounds(int(m.X), int(m.Y)) {
+        logger.Debug("camera off the map", "player", player.Udp.Id, "x", m.X, "y", m.Y)
+        return
+      }
+      cam.Mode = msg.CAMERA_FREE
+      cam.X = int(m.X)
+      cam.Y = int(m.Y)
+    default:
+      logger.Debug("unknown camera mode", "player", player.Udp.Id, "mode", m.Mode)
+  }
+}
+
+// Move cameras following bodies, then send each spectator the
+// bodies nearest its camera if stream, and return cameras that
+// moved since WORLD last heard if report.
+func (s *Simulation) watch(seq int, stream, report bool) (cameraMsg link.CameraMsg) {
+  var bodies []msg.BodyState
+  if stream {
+    s.controlledBodies.Range(func(key, value interface{}) bool {
+      bod := value.(*ControlledBody).GetBody()
+      bodies = append(bodies, msg.BodyState{
+        Id: bod.Id,
+        X: bod.TargetPosition.X(),
+        Y: bod.TargetPosition.Y(),
+        Angle: bod.TargetAngle,
+        VelocityX: bod.Velocity.X(),
+        VelocityY: bod.Velocity.Y(),
+      })
+      return true
+    })
+  }
+
+  s.players.playerMap.Range(func(key, value interface{}) bool {
+    player := value.(*SimPlayer)
+    cam := &player.Camera
+    if cam.Mode == msg.CAMERA_NONE || player.Udp.GetState() != udp.SPECTATING {
+      return true
+    }
+
+    if cam.Mode == msg.CAMERA_FOLLOW {
+      if bod := s.findBody(cam.BodyId); bod != nil {
+        cam.X, cam.Y = s.worldMap.GetCellFromPosition(bod.TargetPosition.X(), bod.TargetPosition.Y())
+      } else {
+        // it died or left, stay where it was last seen
+        cam.Mode = msg.CAMERA_FREE
+      }
+    }
+
+    if stream {
+      var stateMsg msg.StateMsg
+      stateMsg.Seq = uint16(seq)
+      stateMsg.X = uint32(cam.X)
+      stateMsg.Y = uint32(cam.Y)
+      stateMsg.Bodies = s.nearest(bodies, cam.X, cam.Y)
+      // the next stream replaces it, never hold up the loop
+      select {
+        case player.Udp.Outgoing <- &stateMsg:
+        default:
+      }
+    }
+
+    if report && (!cam.reported || cam.X != cam.reportedX || cam.Y != cam.reportedY) && len(cameraMsg.Cameras) < link.MAX_CAMERAS {
+      cam.reported = true
+      cam.reportedX = cam.X
+      cam.reportedY = cam.Y
+      cameraMsg.Cameras = append(cameraMsg.Cameras, link.CameraState{PlayerId: key.(uuid.UUID), X: uint16(cam.X), Y: uint16(cam.Y)})
+    }
+    return true
+  })
+  return
+}
+
+// Up to MAX_STATE_BODIES bodies within SPECTATE_RANGE of cell x, y, nearest first.
+func (s *Simulation) nearest(bodies []msg.BodyState, x, y int) []msg.BodyState {
+  type near struct {
+    body msg.BodyState
+    dist int
+  }
+
+  inRange := []near{}
+  for _, b := range bodies {
+    bx, by := s.worldMap.GetCellFromPosition(b.X, b.Y)
+    dx, dy := bx - x, by - y
+    if dx >= -SPECTATE_RANGE && dx <= SPECTATE_RANGE && dy >= -SPECTATE_RANGE && dy <= SPECTATE_RANGE {
+      inRange = append(inRange, near{b, dx*dx + dy*dy})
+    }
+  }
+  sort.Slice(inRange, func(i, j int) bool { return inRange[i].dist < inRange[j].dist })
+
+  if len(inRange) > msg.MAX_STATE_BODIES {
+    inRange = inRange[:msg.MAX_STATE_BODIES]
+  }
+  result := make([]msg.BodyState, len(inRange))
+  for i, n := range inRange {
+    result[i] = n.body
+  }
+  return result
+}
+
+// Live body with id, nil if there is none.
+func (s *Simulation) findBody(id uint16) *udp.UDPBody {
+  var found *udp.UDPBody
+  s.controlledBodies.Range(func(key, value interface{}) bool {
+    bod := value.(*ControlledBody).GetBody()
+    if bod.Id == id {
+      found = bod
+      return false
+    }
+    return true
+  })
+  return found
+}
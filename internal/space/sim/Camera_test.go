@@ -0,0 +1,123 @@
+package sim
+
+import(
+  "testing"
+  "reflect"
+  "math/rand"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/sim/msg"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/util"
+)
+
+// The StateMsg watch left for a spectator, failing if there is none.
+func streamed(t *testing.T, c *testClient) *msg.StateMsg {
+  select {
+    case m := <-c.plr.Outgoing:
+      stateMsg, ok := m.(*msg.StateMsg)
+      if !ok {
+        t.Fatalf("got %T, want a StateMsg", m)
+      }
+      return stateMsg
+    default:
+      t.Fatalf("nothing streamed")
+      return nil
+  }
+}
+
+// A spectator following a body gets it streamed and its camera
+// reported to WORLD, a free camera far away gets nothing and a
+// spectator with a full queue doesn't hold up the loop.
+func TestCameraStreamsNearbyBodies(t *testing.T) {
+  config := helpers.DefaultConfig()
+  helpers.SetConfig(&config)
+
+  var s Simulation
+  s.worldMap = testMap(t)
+  s.players = &SimPlayers{}
+  s.region = snet.WholeMap()
+  s.rng = rand.New(rand.NewSource(1))
+  s.fromPlayers = make(chan udp.UDPMsg, 100)
+  s.removals = make(chan uuid.UUID, 64)
+  s.toWorld = make(chan link.LinkMsg, 1000)
+
+  pilot := connectClient(t, s.players, 0)
+  spectator := connectClient(t, s.players, 1)
+
+  pilot.cmd(&s, udp.ENTER)
+  s.seq++
+  s.processFrame(int64(s.seq) * helpers.GetConfiguredTimestepNanos(), int(s.seq))
+  pilot.ack()
+  spectator.ack()
+
+  cb, ok := s.controlledBodies.Load(pilot.plr.Id)
+  if !ok {
+    t.Fatalf("pilot has no body")
+  }
+  bod := cb.(*ControlledBody).GetBody()
+  wantX, wantY := s.worldMap.GetCellFromPosition(bod.TargetPosition.X(), bod.TargetPosition.Y())
+
+  watcher := s.players.GetPlayer(spectator.plr.Id)
+  s.spectate(watcher, &msg.SpectateMsg{Mode: msg.CAMERA_FOLLOW, BodyId: bod.Id})
+  if watcher.Camera.Mode != msg.CAMERA_FOLLOW || watcher.Camera.X != wantX || watcher.Camera.Y != wantY {
+    t.Fatalf("camera %+v, want following body %d at %d, %d", watcher.Camera, bod.Id, wantX, wantY)
+  }
+
+  cameraMsg := s.watch(int(s.seq), true, true)
+  stateMsg := streamed(t, spectator)
+  if len(stateMsg.Bodies) != 1 || stateMsg.Bodies[0].Id != bod.Id {
+    t.Fatalf("streamed %+v, want body %d", stateMsg.Bodies, bod.Id)
+  }
+  if stateMsg.X != uint32(wantX) || stateMsg.Y != uint32(wantY) {
+    t.Fatalf("stream camera at %d, %d, want %d, %d", stateMsg.X, stateMsg.Y, wantX, wantY)
+  }
+  want := link.CameraState{PlayerId: spectator.plr.Id, X: uint16(wantX), Y: uint16(wantY)}
+  if len(cameraMsg.Cameras) != 1 || cameraMsg.Cameras[0] != want {
+    t.Fatalf("reported %+v, want %+v", cameraMsg.Cameras, want)
+  }
+
+  // what the client reads is what was streamed
+  bytes := make([]byte, stateMsg.GetSize())
+  stateMsg.Serialize(bytes)
+  var decoded msg.StateMsg
+  if head := decoded.Deserialize(bytes, 0); head != len(bytes) {
+    t.Fatalf("read %d of %d bytes", head, len(bytes))
+  }
+  if !reflect.DeepEqual(&decoded, stateMsg) {
+    t.Fatalf("decoded %+v, want %+v", decoded, *stateMsg)
+  }
+
+  // the pilot isn't spectating, so gets nothing
+  if len(pilot.plr.Outgoing) != 0 {
+    t.Fatalf("pilot was streamed to")
+  }
+
+  // a camera that didn't move isn't reported again
+  if cameraMsg = s.watch(int(s.seq), true, true); len(cameraMsg.Cameras) != 0 {
+    t.Fatalf("reported a camera that didn't move: %+v", cameraMsg.Cameras)
+  }
+  streamed(t, spectator)
+
+  // the far corner of testMap is out of SPECTATE_RANGE of the spawn
+  edge := 16 * 16 - 1
+  s.spectate(watcher, &msg.SpectateMsg{Mode: msg.CAMERA_FREE, X: uint32(edge), Y: uint32(edge)})
+  s.watch(int(s.seq), true, false)
+  if stateMsg = streamed(t, spectator); len(stateMsg.Bodies) != 0 {
+    t.Fatalf("streamed %+v from out of range", stateMsg.Bodies)
+  }
+
+  // off the map is refused and the camera stays
+  s.spectate(watcher, &msg.SpectateMsg{Mode: msg.CAMERA_FREE, X: uint32(edge + 1), Y: 0})
+  if watcher.Camera.X != edge || watcher.Camera.Y != edge {
+    t.Fatalf("camera moved off the map to %d, %d", watcher.Camera.X, watcher.Camera.Y)
+  }
+
+  for len(spectator.plr.Outgoing) < cap(spectator.plr.Outgoing) {
+    spectator.plr.Outgoing <- &msg.StateMsg{}
+  }
+  s.watch(int(s.seq), true, false)
+}
@@ -112,6 +112,10 @@ func (cb *ControlledBody) ProcessFrame(frameStart int64, seq int) (x, y float32)
   return
 }
 
+func (cb *ControlledBody) GetTransform(seq int) HistoricalTransform {
+  return cb.stateBuffer.Get(seq)
+}
+
 func (cb *ControlledBody) GetBody() *udp.UDPBody {
   return cb.bod
 }
@@ -0,0 +1,454 @@
+package sim
+
+import(
+  "io"
+  "os"
+  "fmt"
+  "math"
+  "sync"
+  "time"
+  "bufio"
+  "errors"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+  "github.com/go-gl/mathgl/mgl32"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/player"
+)
+
+// Everything that moved a body during a match, enough to run the
+// simulation again and get the same trajectories, see Replay.
+//
+// header: "SREC" version(2) timestep(8) timestepNano(8) region(16)
+//         mapFingerprint(8) mapSeed(8) mapSize(4) mapName(1+n) mapDir(2+n) started(8)
+// then records, each kind(1) frame(4) body:
+//   PLAYER  player(2) id(16)         numbers a player for the records after it
+//   ENTER   player(2) body(2) team(1) stats(12) seq(4) transform(44)
+//   EXIT    player(2)
+//   INPUT   player(2) tick(2) moveShoot(1)
+//   CHECK   bodies(2) hash(8)        body states after the frame
+//   END                              written when SIM shuts down cleanly
+//
+// frame counts simulation frames from 1. Records are only ever
+// appended, a SIM that died leaves a recording without END.
+
+const RECORDING_VERSION uint16 = 1
+const CHECK_RATE uint32 = 30    // frames between CHECK records
+
+var recordingMagic = []byte("SREC")
+
+var ErrNotRecording = errors.New("not a recording")
+
+type RecordKind byte
+
+const (
+  REC_PLAYER RecordKind = iota + 1
+  REC_ENTER
+  REC_EXIT
+  REC_INPUT
+  REC_CHECK
+  REC_END
+)
+
+type RecordingHeader struct {
+  Timestep      int64
+  TimestepNano  int64
+  Region        snet.Region
+  Map           world.MapIdentity
+  Started       time.Time
+}
+
+// One record, fields set as its Kind needs.
+type Record struct {
+  Kind        RecordKind
+  Frame       uint32
+  PlayerId    uuid.UUID
+  BodyId      uint16
+  Team        byte
+  Stats       player.PlayerStats
+  Transform   HistoricalTransform
+  Tick        uint16
+  MoveShoot   byte
+  Bodies      uint16
+  Hash        uint64
+}
+
+// Writing
+////////////
+
+// Appends records to a file. Safe to use from several goroutines,
+// a nil Recorder records nothing.
+type Recorder struct {
+  lock      sync.Mutex
+  file      *os.File
+  out       *bufio.Writer
+  players   map[uuid.UUID]uint16
+  lastFlush time.Time
+  closed    bool
+  err       error
+}
+
+// Starts a new recording at path, which must not exist yet.
+func CreateRecording(path string, h RecordingHeader) (*Recorder, error) {
+  f, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0644)
+  if err != nil {
+    return nil, err
+  }
+
+  var r Recorder
+  r.file = f
+  r.out = bufio.NewWriter(f)
+  r.players = map[uuid.UUID]uint16{}
+  r.lastFlush = time.Now()
+
+  b := append([]byte{}, recordingMagic...)
+  b = putUint16(b, RECORDING_VERSION)
+  b = putUint64(b, uint64(h.Timestep))
+  b = putUint64(b, uint64(h.TimestepNano))
+  b = putUint32(b, h.Region.MinX)
+  b = putUint32(b, h.Region.MinY)
+  b = putUint32(b, h.Region.MaxX)
+  b = putUint32(b, h.Region.MaxY)
+  b = putUint64(b, h.Map.Fingerprint)
+  b = putUint64(b, h.Map.Seed)
+  b = putUint32(b, h.Map.Size)
+  name, dir := h.Map.Name, h.Map.Dir
+  if len(name) > math.MaxUint8 {
+    name = name[:math.MaxUint8]
+  }
+  if len(dir) > math.MaxUint16 {
+    dir = dir[:math.MaxUint16]
+  }
+  b = append(b, byte(len(name)))
+  b = append(b, name...)
+  b = putUint16(b, uint16(len(dir)))
+  b = append(b, dir...)
+  b = putUint64(b, uint64(h.Started.UnixMilli()))
+  r.write(b)
+
+  if r.err != nil {
+    f.Close()
+    return nil, r.err
+  }
+  return &r, nil
+}
+
+func (r *Recorder) enter(frame uint32, plr *SimPlayer, playerId uuid.UUID, bodyId uint16, ht HistoricalTransform) {
+  if r == nil {
+    return
+  }
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  b := r.record(REC_ENTER, frame, playerId)
+  b = putUint16(b, bodyId)
+  b = append(b, plr.Team)
+  b = putFloats(b, plr.Stats.Thrust, plr.Stats.MaxSpeed, plr.Stats.Rotation)
+  b = putUint32(b, uint32(int32(ht.Seq)))
+  b = putFloats(b, ht.Angle, ht.AngleDelta)
+  b = putFloats(b, ht.Position[0:]...)
+  b = putFloats(b, ht.Velocity[0:]...)
+  b = putFloats(b, ht.VelocityDelta[0:]...)
+  r.write(b)
+}
+
+func (r *Recorder) exit(frame uint32, playerId uuid.UUID) {
+  if r == nil {
+    return
+  }
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  r.write(r.record(REC_EXIT, frame, playerId))
+}
+
+func (r *Recorder) input(frame uint32, playerId uuid.UUID, tick uint16, moveShoot byte) {
+  if r == nil {
+    return
+  }
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  b := r.record(REC_INPUT, frame, playerId)
+  b = putUint16(b, tick)
+  b = append(b, moveShoot)
+  r.write(b)
+}
+
+func (r *Recorder) check(frame uint32, bodies int, hash uint64) {
+  if r == nil {
+    return
+  }
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  b := r.record(REC_CHECK, frame, uuid.Nil)
+  b = putUint16(b, uint16(bodies))
+  b = putUint64(b, hash)
+  r.write(b)
+
+  // about once a second, so a crash loses little
+  if time.Since(r.lastFlush) > time.Second {
+    r.flush()
+  }
+}
+
+// Writes END and closes the file. Later records are dropped.
+func (r *Recorder) Close(frame uint32) error {
+  if r == nil {
+    return nil
+  }
+  r.lock.Lock()
+  defer r.lock.Unlock()
+
+  if r.closed {
+    return r.err
+  }
+  r.write(r.record(REC_END, frame, uuid.Nil))
+  r.flush()
+  r.closed = true
+  if err := r.file.Close(); err != nil && r.err == nil {
+    r.err = err
+  }
+  return r.err
+}
+
+// Kind and frame, and the player's number if it has one,
+// after a PLAYER record the first time the player is seen.
+func (r *Recorder) record(kind RecordKind, frame uint32, playerId uuid.UUID) []byte {
+  var b []byte
+  if kind != REC_CHECK && kind != REC_END {
+    idx, ok := r.players[playerId]
+    if !ok {
+      idx = uint16(len(r.players))
+      r.players[playerId] = idx
+      b = append(b, byte(REC_PLAYER))
+      b = putUint32(b, frame)
+      b = putUint16(b, idx)
+      b = append(b, playerId[0:]...)
+    }
+    b = append(b, byte(kind))
+    b = putUint32(b, frame)
+    return putUint16(b, idx)
+  }
+
+  b = append(b, byte(kind))
+  return putUint32(b, frame)
+}
+
+func (r *Recorder) write(b []byte) {
+  if r.closed || r.err != nil {
+    return
+  }
+  if _, err := r.out.Write(b); err != nil {
+    r.err = err
+    logger.Error("recording failed", "err", err)
+  }
+}
+
+func (r *Recorder) flush() {
+  if r.err == nil {
+    r.err = r.out.Flush()
+  }
+  r.lastFlush = time.Now()
+}
+
+// Reading
+////////////
+
+type RecordingReader struct {
+  Header    RecordingHeader
+  in        *bufio.Reader
+  file      *os.File
+  players   []uuid.UUID
+}
+
+func OpenRecording(path string) (*RecordingReader, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+
+  rr := &RecordingReader{file: f, in: bufio.NewReader(f)}
+  if err = rr.readHeader(); err != nil {
+    f.Close()
+    return nil, err
+  }
+  return rr, nil
+}
+
+func (rr *RecordingReader) Close() error {
+  return rr.file.Close()
+}
+
+func (rr *RecordingReader) readHeader() error {
+  magic := make([]byte, len(recordingMagic))
+  if _, err := io.ReadFull(rr.in, magic); err != nil || string(magic) != string(recordingMagic) {
+    return ErrNotRecording
+  }
+
+  b, err := rr.read(2 + 8 + 8 + 16 + 8 + 8 + 4 + 1)
+  if err != nil {
+    return err
+  }
+  if version := binary.LittleEndian.Uint16(b[0:2]); version != RECORDING_VERSION {
+    return fmt.Errorf("recording version %d, this build reads %d", version, RECORDING_VERSION)
+  }
+
+  h := &rr.Header
+  h.Timestep = int64(binary.LittleEndian.Uint64(b[2:10]))
+  h.TimestepNano = int64(binary.LittleEndian.Uint64(b[10:18]))
+  h.Region.MinX = binary.LittleEndian.Uint32(b[18:22])
+  h.Region.MinY = binary.LittleEndian.Uint32(b[22:26])
+  h.Region.MaxX = binary.LittleEndian.Uint32(b[26:30])
+  h.Region.MaxY = binary.LittleEndian.Uint32(b[30:34])
+  h.Map.Fingerprint = binary.LittleEndian.Uint64(b[34:42])
+  h.Map.Seed = binary.LittleEndian.Uint64(b[42:50])
+  h.Map.Size = binary.LittleEndian.Uint32(b[50:54])
+
+  name, err := rr.read(int(b[54]))
+  if err != nil {
+    return err
+  }
+  h.Map.Name = string(name)
+
+  if b, err = rr.read(2); err != nil {
+    return err
+  }
+  dir, err := rr.read(int(binary.LittleEndian.Uint16(b)))
+  if err != nil {
+    return err
+  }
+  h.Map.Dir = string(dir)
+
+  if b, err = rr.read(8); err != nil {
+    return err
+  }
+  h.Started = time.UnixMilli(int64(binary.LittleEndian.Uint64(b)))
+  return nil
+}
+
+// Next record, io.EOF after the last one and io.ErrUnexpectedEOF
+// if the recording stops halfway through one.
+func (rr *RecordingReader) Next() (Record, error) {
+  for {
+    var rec Record
+    kind, err := rr.in.ReadByte()
+    if err != nil {
+      return rec, err
+    }
+    rec.Kind = RecordKind(kind)
+
+    b, err := rr.read(4)
+    if err != nil {
+      return rec, err
+    }
+    rec.Frame = binary.LittleEndian.Uint32(b)
+
+    switch rec.Kind {
+      case REC_PLAYER:
+        if b, err = rr.read(2 + 16); err != nil {
+          return rec, err
+        }
+        idx := int(binary.LittleEndian.Uint16(b[0:2]))
+        for len(rr.players) <= idx {
+          rr.players = append(rr.players, uuid.Nil)
+        }
+        copy(rr.players[idx][0:], b[2:18])
+        continue
+      case REC_ENTER:
+        if err = rr.readPlayer(&rec); err != nil {
+          return rec, err
+        }
+        if b, err = rr.read(2 + 1 + 12 + 4 + 44); err != nil {
+          return rec, err
+        }
+        rec.BodyId = binary.LittleEndian.Uint16(b[0:2])
+        rec.Team = b[2]
+        f := getFloats(b[3:15])
+        rec.Stats = player.PlayerStats{Thrust: f[0], MaxSpeed: f[1], Rotation: f[2]}
+        rec.Transform.Seq = int(int32(binary.LittleEndian.Uint32(b[15:19])))
+        f = getFloats(b[19:63])
+        rec.Transform.Angle = f[0]
+        rec.Transform.AngleDelta = f[1]
+        rec.Transform.Position = mgl32.Vec3{f[2], f[3], f[4]}
+        rec.Transform.Velocity = mgl32.Vec3{f[5], f[6], f[7]}
+        rec.Transform.VelocityDelta = mgl32.Vec3{f[8], f[9], f[10]}
+      case REC_EXIT:
+        err = rr.readPlayer(&rec)
+      case REC_INPUT:
+        if err = rr.readPlayer(&rec); err != nil {
+          return rec, err
+        }
+        if b, err = rr.read(3); err != nil {
+          return rec, err
+        }
+        rec.Tick = binary.LittleEndian.Uint16(b[0:2])
+        rec.MoveShoot = b[2]
+      case REC_CHECK:
+        if b, err = rr.read(10); err != nil {
+          return rec, err
+        }
+        rec.Bodies = binary.LittleEndian.Uint16(b[0:2])
+        rec.Hash = binary.LittleEndian.Uint64(b[2:10])
+      case REC_END:
+      default:
+        return rec, fmt.Errorf("unknown record %d at frame %d", kind, rec.Frame)
+    }
+    return rec, err
+  }
+}
+
+func (rr *RecordingReader) readPlayer(rec *Record) error {
+  b, err := rr.read(2)
+  if err != nil {
+    return err
+  }
+  idx := int(binary.LittleEndian.Uint16(b))
+  if idx >= len(rr.players) {
+    return fmt.Errorf("player %d used before it was numbered", idx)
+  }
+  rec.PlayerId = rr.players[idx]
+  return nil
+}
+
+func (rr *RecordingReader) read(n int) ([]byte, error) {
+  b := make([]byte, n)
+  if _, err := io.ReadFull(rr.in, b); err != nil {
+    if err == io.EOF {
+      err = io.ErrUnexpectedEOF
+    }
+    return nil, err
+  }
+  return b, nil
+}
+
+func putUint16(b []byte, v uint16) []byte {
+  return append(b, byte(v), byte(v >> 8))
+}
+
+func putUint32(b []byte, v uint32) []byte {
+  return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func putUint64(b []byte, v uint64) []byte {
+  return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func putFloats(b []byte, fs ...float32) []byte {
+  for _, f := range fs {
+    b = putUint32(b, math.Float32bits(f))
+  }
+  return b
+}
+
+func getFloats(b []byte) []float32 {
+  fs := make([]float32, len(b) / 4)
+  for i := range fs {
+    fs[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:i*4+4]))
+  }
+  return fs
+}
@@ -0,0 +1,141 @@
+package sim
+
+import(
+  "io"
+  "os"
+  "time"
+  "testing"
+  "path/filepath"
+
+  "github.com/google/uuid"
+  "github.com/go-gl/mathgl/mgl32"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/player"
+)
+
+// Every record kind written by a Recorder comes back the same from OpenRecording.
+func TestRecordingRoundTrip(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "match.srec")
+
+  var header RecordingHeader
+  header.Timestep = 16
+  header.TimestepNano = 16000000
+  header.Region = snet.Region{MinX: 0, MinY: 1024, MaxX: 1024, MaxY: 2048}
+  header.Map = world.MapIdentity{Name: "arena", Dir: "/maps/arena", Seed: 42, Size: 64, Fingerprint: 0xdeadbeef}
+  header.Started = time.UnixMilli(1700000000123)
+
+  r, err := CreateRecording(path, header)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  a, b := uuid.New(), uuid.New()
+  plr := &SimPlayer{Stats: player.PlayerStats{Thrust: 1.5, MaxSpeed: 20, Rotation: 0.25}, Team: 1}
+  var ht HistoricalTransform
+  ht.Seq = -3
+  ht.Angle = 1.25
+  ht.AngleDelta = -0.5
+  ht.Position = mgl32.Vec3{100, 200.5, 0}
+  ht.Velocity = mgl32.Vec3{-1, 2, 0}
+  ht.VelocityDelta = mgl32.Vec3{0.125, 0, 0}
+
+  r.enter(1, plr, a, 7, ht)
+  r.input(2, a, 300, 0x15)
+  r.enter(2, plr, b, 8, ht)
+  r.input(3, b, 301, 0x02)
+  r.check(30, 2, 0x0123456789abcdef)
+  r.exit(31, a)
+  r.input(32, b, 302, 0x00)
+  if err = r.Close(40); err != nil {
+    t.Fatal(err)
+  }
+
+  // dropped, the recording is closed
+  r.exit(41, b)
+
+  rr, err := OpenRecording(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer rr.Close()
+
+  got := rr.Header
+  if got.Timestep != header.Timestep || got.TimestepNano != header.TimestepNano ||
+     got.Region != header.Region || got.Map != header.Map || !got.Started.Equal(header.Started) {
+    t.Fatalf("header %+v, want %+v", got, header)
+  }
+
+  enter := func(frame uint32, id uuid.UUID, body uint16) Record {
+    return Record{Kind: REC_ENTER, Frame: frame, PlayerId: id, BodyId: body, Team: plr.Team, Stats: plr.Stats, Transform: ht}
+  }
+  want := []Record{
+    enter(1, a, 7),
+    {Kind: REC_INPUT, Frame: 2, PlayerId: a, Tick: 300, MoveShoot: 0x15},
+    enter(2, b, 8),
+    {Kind: REC_INPUT, Frame: 3, PlayerId: b, Tick: 301, MoveShoot: 0x02},
+    {Kind: REC_CHECK, Frame: 30, Bodies: 2, Hash: 0x0123456789abcdef},
+    {Kind: REC_EXIT, Frame: 31, PlayerId: a},
+    {Kind: REC_INPUT, Frame: 32, PlayerId: b, Tick: 302},
+    {Kind: REC_END, Frame: 40},
+  }
+  for i, w := range want {
+    rec, err := rr.Next()
+    if err != nil {
+      t.Fatalf("record %d: %s", i, err)
+    }
+    if rec != w {
+      t.Fatalf("record %d is %+v, want %+v", i, rec, w)
+    }
+  }
+
+  if _, err = rr.Next(); err != io.EOF {
+    t.Fatalf("after END got %v, want EOF", err)
+  }
+}
+
+// A SIM that died mid-write leaves half a record, which reads as unexpected EOF.
+func TestRecordingTruncated(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "match.srec")
+  r, err := CreateRecording(path, RecordingHeader{Started: time.Now()})
+  if err != nil {
+    t.Fatal(err)
+  }
+  r.input(1, uuid.New(), 1, 0x01)
+  if err = r.Close(2); err != nil {
+    t.Fatal(err)
+  }
+
+  data, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // cut into the END record
+  if err = os.WriteFile(path, data[:len(data) - 2], 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  rr, err := OpenRecording(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer rr.Close()
+
+  if rec, err := rr.Next(); err != nil || rec.Kind != REC_INPUT {
+    t.Fatalf("got %+v %v, want the input", rec, err)
+  }
+  if _, err = rr.Next(); err != io.ErrUnexpectedEOF {
+    t.Fatalf("got %v, want unexpected EOF", err)
+  }
+}
+
+func TestOpenRecordingRejectsOtherFiles(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "meta.chunks")
+  if err := os.WriteFile(path, []byte("not a recording at all"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := OpenRecording(path); err != ErrNotRecording {
+    t.Fatalf("got %v, want ErrNotRecording", err)
+  }
+}
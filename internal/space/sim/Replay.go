@@ -0,0 +1,159 @@
+package sim
+
+import(
+  "io"
+  "sort"
+
+  "github.com/google/uuid"
+  "github.com/go-gl/mathgl/mgl32"
+
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/util"
+)
+
+// Runs a recording through the simulation again, frame by frame
+// as fast as it goes, with no players, WORLD or clock. Bodies are
+// put where the recording says they spawned and get the recorded
+// input, so the same code gives the same trajectories.
+// The configured timestep must be the recording's.
+type Replay struct {
+  sim       Simulation
+  reader    *RecordingReader
+  next      *Record
+
+  // Called after every frame with the bodies sorted by id, if set.
+  OnFrame   func(frame uint32, bodies []ReplayBody)
+}
+
+type ReplayBody struct {
+  PlayerId  uuid.UUID
+  BodyId    uint16
+  Position  mgl32.Vec3
+  Angle     float32
+  Velocity  mgl32.Vec3
+}
+
+type ReplayResult struct {
+  Frames    uint32
+  Enters    int
+  Exits     int
+  Inputs    int
+  Checks    int
+  Desync    uint32    // first frame whose CHECK didn't match, 0 if none
+  Ended     bool      // reached END, false if SIM didn't shut down cleanly
+}
+
+func NewReplay(rr *RecordingReader, worldMap *world.WorldMap) *Replay {
+  var r Replay
+  r.reader = rr
+  r.sim.worldMap = worldMap
+  r.sim.region = rr.Header.Region
+  r.sim.players = &SimPlayers{}
+  return &r
+}
+
+// Plays the recording to its end, or for at most frames if not 0.
+func (r *Replay) Run(frames uint32) (ReplayResult, error) {
+  var result ReplayResult
+  s := &r.sim
+  timestepNano := helpers.GetConfiguredTimestepNanos()
+
+  for frames == 0 || s.frame < frames {
+    rec, err := r.peek()
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+      break
+    } else if err != nil {
+      return result, err
+    }
+    if rec.Kind == REC_END && rec.Frame <= s.frame {
+      result.Ended = true
+      break
+    }
+
+    // as loop does
+    s.seq++
+    seq := int(s.seq)
+    s.frame++
+
+    // what happened before the bodies moved
+    for rec != nil && rec.Frame == s.frame && rec.Kind != REC_CHECK && rec.Kind != REC_END {
+      switch rec.Kind {
+        case REC_ENTER:
+          r.enter(rec)
+          result.Enters++
+        case REC_EXIT:
+          s.removeControlledBody(rec.PlayerId, s.frame)
+          result.Exits++
+        case REC_INPUT:
+          if cb, ok := s.controlledBodies.Load(rec.PlayerId); ok {
+            cb.(*ControlledBody).InputToState(int(rec.Tick), rec.MoveShoot)
+          }
+          result.Inputs++
+      }
+      r.next = nil
+      if rec, err = r.peek(); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return result, err
+      }
+    }
+
+    s.advanceBodies(int64(seq) * timestepNano, seq, false)
+    s.dropDeadBodies()
+
+    for rec != nil && rec.Frame == s.frame && rec.Kind == REC_CHECK {
+      bodies, hash := s.bodyHash()
+      if (bodies != int(rec.Bodies) || hash != rec.Hash) && result.Desync == 0 {
+        result.Desync = s.frame
+      }
+      result.Checks++
+      r.next = nil
+      if rec, err = r.peek(); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return result, err
+      }
+    }
+
+    if r.OnFrame != nil {
+      r.OnFrame(s.frame, r.bodies())
+    }
+
+    if s.seq == 0 {
+      s.seq = 1
+    }
+  }
+
+  result.Frames = s.frame
+  return result, nil
+}
+
+// Next record without taking it, nil with the error at the end.
+func (r *Replay) peek() (*Record, error) {
+  if r.next == nil {
+    rec, err := r.reader.Next()
+    if err != nil {
+      return nil, err
+    }
+    r.next = &rec
+  }
+  return r.next, nil
+}
+
+func (r *Replay) enter(rec *Record) {
+  var plr SimPlayer
+  plr.Stats = rec.Stats
+  plr.Team = rec.Team
+
+  cb := NewControlledBody(&plr)
+  cb.GetBody().Id = rec.BodyId
+  cb.Initialize(rec.Transform)
+  r.sim.addControlledBody(rec.PlayerId, cb)
+}
+
+func (r *Replay) bodies() []ReplayBody {
+  var bodies []ReplayBody
+  r.sim.controlledBodies.Range(func(key, value interface{}) bool {
+    bod := value.(*ControlledBody).GetBody()
+    bodies = append(bodies, ReplayBody{key.(uuid.UUID), bod.Id, bod.TargetPosition, bod.TargetAngle, bod.Velocity})
+    return true
+  })
+  sort.Slice(bodies, func(i, j int) bool { return bodies[i].BodyId < bodies[j].BodyId })
+  return bodies
+}
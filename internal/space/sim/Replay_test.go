@@ -0,0 +1,230 @@
+package sim
+
+import(
+  "os"
+  "testing"
+  "math/rand"
+  "path/filepath"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/sim/msg"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/world"
+  "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/util"
+)
+
+// A map with no chunk files, the simulation only needs its spawn points.
+func testMap(t *testing.T) *world.WorldMap {
+  dir := filepath.Join(t.TempDir(), "test-map")
+  if err := os.Mkdir(dir, 0755); err != nil {
+    t.Fatal(err)
+  }
+
+  var info world.WorldInfo
+  info.ChunksPerFile = 4
+  info.ChunkSize = 16
+  info.Size = 16
+  info.BlocksPerChunk = 16 * 16
+  info.BlocksPerFile = 4 * 16 * 16
+  info.NumFiles = 64
+  info.Seed = 1
+  info.SpawnPoints = []world.SpawnPoint{{Team: 0, X: 100, Y: 100}, {Team: 1, X: 150, Y: 150}}
+  if err := os.WriteFile(filepath.Join(dir, "meta.chunks"), world.SerializeWorldInfo(info), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  wm, err := world.NewWorldMap(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return wm
+}
+
+// Just enough of pkg/client to get welcomed and ack
+// what SIM sends, so nothing backs up.
+type testClient struct {
+  plr       *udp.UDPPlayer
+  packets   chan []byte
+  salt      int64
+}
+
+func connectClient(t *testing.T, players *SimPlayers, team byte) *testClient {
+  simEnd, clientEnd := transport.Pipe("sim", "client")
+  t.Cleanup(func() { simEnd.Close() })
+
+  plr := udp.NewPlayer(nil, uuid.New(), nil, nil)
+  size := helpers.GetConfig().MAX_MSG_SIZE
+  hello := make([]byte, size)
+  binary.LittleEndian.PutUint32(hello[0:4], helpers.GetProtocolId())
+  hello[4] = byte(udp.HELLO)
+  binary.LittleEndian.PutUint64(hello[5:13], 77)
+  plr.AuthenticateConnection(hello, simEnd)
+
+  packets := make(chan []byte, 256)
+  go func() {
+    for {
+      packet, err := clientEnd.Recv()
+      if err != nil {
+        return
+      }
+      packets <- packet
+    }
+  }()
+
+  challenge := <-packets
+  if udp.UDPCmd(challenge[4]) != udp.CHALLENGE {
+    t.Fatalf("no challenge, got cmd %d", challenge[4])
+  }
+  salt := snet.Read_int64(challenge[5:13]) ^ snet.Read_int64(challenge[13:21])
+  answer := make([]byte, size)
+  binary.LittleEndian.PutUint32(answer[0:4], helpers.GetProtocolId())
+  answer[4] = byte(udp.CHALLENGE)
+  binary.LittleEndian.PutUint64(answer[5:13], uint64(salt))
+  if !plr.AuthenticateConnection(answer, simEnd) {
+    t.Fatalf("not welcomed")
+  }
+
+  players.Add(plr, team, player.DefaultPlayerStats())
+  c := &testClient{plr: plr, packets: packets, salt: salt}
+  c.ack()
+  return c
+}
+
+// Acks the newest packet that arrived, as if it had been read.
+func (c *testClient) ack() {
+  var seq uint16
+  for draining := true; draining; {
+    select {
+      case packet := <-c.packets:
+        if len(packet) > udp.HEADER_SIZE && snet.Read_int64(packet[4:12]) == c.salt {
+          seq = snet.Read_uint16(packet[12:14])
+        }
+      default:
+        draining = false
+    }
+  }
+
+  // salt(8) seq(2) ack(2) SHUTUP, as Unpack reads it
+  b := make([]byte, 13)
+  binary.LittleEndian.PutUint64(b[0:8], uint64(c.salt))
+  binary.LittleEndian.PutUint16(b[10:12], seq)
+  b[12] = byte(udp.SHUTUP)
+  c.plr.Unpack(b)
+}
+
+func (c *testClient) cmd(s *Simulation, cmd udp.UDPCmd) {
+  var m msg.CmdMsg
+  m.Deserialize([]byte{byte(cmd)}, 0)
+  m.SetPlayerId(c.plr.Id)
+  s.fromPlayers <- &m
+}
+
+// Plays a short match with two players entering, steering, leaving
+// and coming back, recording it, then replays the recording and
+// expects every CHECK to match.
+func TestReplayMatchesRecording(t *testing.T) {
+  config := helpers.DefaultConfig()
+  helpers.SetConfig(&config)
+
+  wm := testMap(t)
+  path := filepath.Join(t.TempDir(), "match.srec")
+
+  var header RecordingHeader
+  header.Timestep = config.TIMESTEP
+  header.TimestepNano = config.TIMESTEP_NANO
+  header.Region = snet.WholeMap()
+  header.Map = wm.Identity()
+  recorder, err := CreateRecording(path, header)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var s Simulation
+  s.worldMap = wm
+  s.players = &SimPlayers{}
+  s.region = header.Region
+  s.rng = rand.New(rand.NewSource(1))
+  s.fromPlayers = make(chan udp.UDPMsg, 100)
+  s.removals = make(chan uuid.UUID, 64)
+  s.toWorld = make(chan link.LinkMsg, 1000)
+  s.SetRecorder(recorder)
+  s.SetLinked(true)
+
+  a := connectClient(t, s.players, 0)
+  b := connectClient(t, s.players, 1)
+  clients := []*testClient{a, b}
+
+  inputs := rand.New(rand.NewSource(1))
+  timestepNano := helpers.GetConfiguredTimestepNanos()
+  const frames = 10 * CHECK_RATE
+
+  for frame := uint32(1); frame <= frames; frame++ {
+    switch frame {
+      case 1:
+        a.cmd(&s, udp.ENTER)
+        b.cmd(&s, udp.ENTER)
+      case 4 * CHECK_RATE:
+        a.cmd(&s, udp.EXIT)
+      case 5 * CHECK_RATE + 7:
+        a.cmd(&s, udp.ENTER)
+      case 8 * CHECK_RATE + 3:
+        s.RemoveControlledBody(b.plr.Id)
+    }
+
+    if frame % 3 == 0 {
+      for _, c := range clients {
+        if c.plr.GetState() == udp.PLAYING {
+          m := &msg.MoveShootMsg{Tick: s.seq + 1, MoveShoot: byte(inputs.Intn(16))}
+          m.SetPlayerId(c.plr.Id)
+          s.fromPlayers <- m
+        }
+      }
+    }
+
+    // as loop does
+    s.seq++
+    s.lastFrame = int64(s.seq) * timestepNano
+    s.processFrame(s.lastFrame, int(s.seq))
+
+    for draining := true; draining; {
+      select {
+        case <-s.toWorld:
+        default:
+          draining = false
+      }
+    }
+    for _, c := range clients {
+      c.ack()
+    }
+  }
+
+  if err := s.StopRecording(); err != nil {
+    t.Fatal(err)
+  }
+
+  rr, err := OpenRecording(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer rr.Close()
+
+  result, err := NewReplay(rr, wm).Run(0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if result.Desync != 0 {
+    t.Fatalf("replay went apart from the match at frame %d", result.Desync)
+  }
+  if !result.Ended || result.Frames != frames {
+    t.Fatalf("replayed %d of %d frames, ended %v", result.Frames, frames, result.Ended)
+  }
+  if result.Checks != int(frames / CHECK_RATE) || result.Enters != 3 || result.Exits != 2 || result.Inputs == 0 {
+    t.Fatalf("recording missed something: %+v", result)
+  }
+}
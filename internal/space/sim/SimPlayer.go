@@ -7,5 +7,7 @@ import(
 
 type SimPlayer struct {
   Stats     player.PlayerStats
+  Team      byte
   Udp       *udp.UDPPlayer
+  Camera    Camera      // only used while spectating
 }
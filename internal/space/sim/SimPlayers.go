@@ -2,7 +2,6 @@ package sim
 
 import (
   "sync"
-  "log"
 
   "github.com/google/uuid"
 
@@ -15,21 +14,22 @@ type SimPlayers struct {
   playerMap sync.Map
 }
 
-func (p *SimPlayers) Add(udpPlayer *udp.UDPPlayer) {
+func (p *SimPlayers) Add(udpPlayer *udp.UDPPlayer, team byte, stats player.PlayerStats) {
   var plr SimPlayer
-  plr.Stats = player.DefaultPlayerStats()
+  plr.Stats = stats
+  plr.Team = team
   plr.Udp = udpPlayer
 
   _, exists := p.playerMap.LoadOrStore(plr.Udp.Id, &plr)
   if !exists {
     p.Count += 1
-    log.Printf("%v joined the simulation.", plr.Udp.Id)
+    logger.Info("joined the simulation", "player", plr.Udp.Id)
   }
 }
 
 func (p *SimPlayers) Remove(id uuid.UUID) {
   p.playerMap.Delete(id)
-  log.Printf("%s left the simulation", id)
+  logger.Info("left the simulation", "player", id)
 }
 
 func (p *SimPlayers) GetPlayer(id uuid.UUID) *SimPlayer {
@@ -46,7 +46,7 @@ func (p *SimPlayers) Push(playerId uuid.UUID, msg udp.UDPMsg) {
   if plr != nil && plr.Udp.GetState() >= udp.CONNECTED {
     plr.Udp.Outgoing <- msg
   } else {
-    log.Printf("Tried to add msg to player %s who doesnt exist", playerId)
+    logger.Debug("dropped msg for missing player", "player", playerId)
   }
 }
 
@@ -79,3 +79,20 @@ func (p *SimPlayers) PackAndSend() {
     return true
   })
 }
+
+func (p *SimPlayers) DisconnectAll() {
+  p.playerMap.Range(func(key, value interface{}) bool {
+    value.(*SimPlayer).Udp.Disconnect()
+    return true
+  })
+}
+
+// Messages queued for every player but not yet packed.
+func (p *SimPlayers) Pending() int {
+  pending := 0
+  p.playerMap.Range(func(key, value interface{}) bool {
+    pending += len(value.(*SimPlayer).Udp.Outgoing)
+    return true
+  })
+  return pending
+}
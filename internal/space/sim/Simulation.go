@@ -1,10 +1,14 @@
 package sim
 
 import (
-  "log"
+  "sort"
   "sync"
   "time"
+  "math"
+  "math/rand"
+  "hash/fnv"
   "encoding/binary"
+  "sync/atomic"
 
   "github.com/go-gl/mathgl/mgl32"
   "github.com/google/uuid"
@@ -14,30 +18,52 @@ import (
   "go-space-serv/internal/space/sim/msg"
   "go-space-serv/internal/space/snet/udp"
   "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/metrics"
 )
 
+var logger = helpers.Logger("sim")
+
 type Simulation struct {
   controlledBodies    sync.Map
   allBodies           []*udp.UDPBody
   worldMap            *world.WorldMap
   players             *SimPlayers
 
+  // Sharding
+  region              snet.Region
+  linked              int32       // 1 while WORLD can take handoffs
+  handoffs            sync.Map    // player id -> *link.HandoffMsg waiting for the player to connect
+  rng                 *rand.Rand  // breaks ties between spawn cells, only used on the loop
+
   // Timing
   seq                 uint16      // incremented each simulation frame, sync when rolls over
   lastSync            int64       // unix nanos the last time sync was performed
   lastFrame           int64       // unix nanos since the last simulation frame
   framesSinceLastSync int64       // simulation frames since last sync
+  frame               uint32      // frames processed, never rolls over
+
+  // Recording, see Recording.go
+  recorder            *Recorder
+  removals    chan    uuid.UUID   // bodies to remove, from outside the loop
 
   fromPlayers chan    udp.UDPMsg  // incoming msgs from clients (UdpPlayer)
-  toWorld     chan    []byte
+  toWorld     chan    link.LinkMsg
   ticker              *time.Ticker
+
+  // Metrics, nil unless registered
+  frameTime           *metrics.Histogram
+  framesBehind        *metrics.Gauge
 }
 
-func (s *Simulation) Start(worldMap *world.WorldMap, players *SimPlayers, worldChan chan []byte) {
+func (s *Simulation) Start(worldMap *world.WorldMap, players *SimPlayers, worldChan chan link.LinkMsg, region snet.Region) {
   s.players = players
+  s.region = region
   s.toWorld = worldChan
   s.fromPlayers = make(chan udp.UDPMsg, 100)
+  s.removals = make(chan uuid.UUID, 64)
   s.worldMap = worldMap
+  s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
   s.seq = 0
   s.lastSync = 0
   s.framesSinceLastSync = 0
@@ -50,6 +76,17 @@ func (s *Simulation) Start(worldMap *world.WorldMap, players *SimPlayers, worldC
 //   - produce outgoing messages for players
 //   - instruct UDPPlayer to pack and send messages
 func (s *Simulation) processFrame(frameStart int64, seq int) {
+  s.frame++
+
+  for removing := true; removing; {
+    select {
+      case playerId := <-s.removals:
+        s.removeControlledBody(playerId, s.frame)
+      default:
+        removing = false
+    }
+  }
+
   // Process incoming messages from players
   for j := 0; j < 50; j++ {
     tmp := s.pullFromPlayers()
@@ -74,58 +111,39 @@ func (s *Simulation) processFrame(frameStart int64, seq int) {
           case udp.ENTER:
             // TODO: verify rtt/ploss limit
             player := s.players.GetPlayer(playerId)
-            if player != nil && player.Udp.GetState() != udp.SPECTATING {
-              log.Printf("player %s spawn when not spectating.", playerId)
+            if player == nil || player.Udp.GetState() != udp.SPECTATING {
+              logger.Debug("enter when not spectating", "player", playerId)
               break
             }
 
-            x, y := s.worldMap.GetSpawnPoint()
-            pBod := NewControlledBody(player)
+            cellX, cellY := s.worldMap.PickSpawnPoint(player.Team, s.occupiedCells(), s.region, s.rng)
+            x, y := s.worldMap.GetCellCenter(cellX, cellY)
             var ht HistoricalTransform
-            ht.Seq = int(s.seq)
-            ht.Angle = 0
-            ht.AngleDelta = 0
             ht.Position = mgl32.Vec3{x, y, 0}
-            ht.Velocity = mgl32.Vec3{0, 0, 0}
-            ht.VelocityDelta = mgl32.Vec3{0, 0, 0}
-            pBod.Initialize(ht)
-            s.addControlledBody(playerId, pBod)
-            player.Udp.SetState(udp.PLAYING)
-
-            log.Printf("Spawning %s at %d/%d -- %f/%f", playerId, world.SPAWNX, world.SPAWNY, x, y)
-
-            // tell other players
-            var response msg.EnterMsg
-            response.PlayerId = player.Udp.Id
-            response.BodyId = pBod.GetBody().Id
-            response.X = uint32(world.SPAWNX)
-            response.Y = uint32(world.SPAWNY)
-            s.players.PushAll(&response)
-
-            // tell the map server
-            worldSpawnMsg := []byte{byte(snet.ISpawn), 0, 0}
-            binary.LittleEndian.PutUint16(worldSpawnMsg[1:3], pBod.GetBody().Id)
-
-            worldSpawnMsg = append(worldSpawnMsg,  playerId[0:]...)
-            s.toWorld <- worldSpawnMsg
+            s.spawn(player, ht, s.frame)
           case udp.EXIT:
             player := s.players.GetPlayer(playerId)
             if player != nil && player.Udp.GetState() == udp.PLAYING {
               cb, ok := s.controlledBodies.Load(playerId)
               if ok && cb != nil {
-                bodyId := cb.(*ControlledBody).GetBody().Id
-                s.RemoveControlledBody(playerId)
+                bod := cb.(*ControlledBody).GetBody()
+                bodyId := bod.Id
+                s.removeControlledBody(playerId, s.frame)
                 player.Udp.SetState(udp.SPECTATING)
 
+                // watch from where the body was until told otherwise
+                player.Camera = Camera{Mode: msg.CAMERA_FREE}
+                player.Camera.X, player.Camera.Y = s.worldMap.GetCellFromPosition(bod.TargetPosition.X(), bod.TargetPosition.Y())
+
                 // tell other playesr
                 var response msg.ExitMsg
                 response.BodyId = bodyId
                 s.players.PushAll(&response)
 
                 // tell the map server
-                worldSpecMsg := []byte{byte(snet.ISpec), 0, 0}
-                binary.LittleEndian.PutUint16(worldSpecMsg[1:3], bodyId)
-                s.toWorld <- worldSpecMsg
+                var worldSpecMsg link.SpecMsg
+                worldSpecMsg.BodyId = bodyId
+                s.toWorld <- &worldSpecMsg
               }
             }
         }
@@ -140,52 +158,77 @@ func (s *Simulation) processFrame(frameStart int64, seq int) {
           m.BodyId = cb.GetBody().Id;
           s.players.PushExcluding(playerId, m)
           cb.InputToState(int(m.Tick), m.MoveShoot)
+          s.recorder.input(s.frame, playerId, m.Tick, m.MoveShoot)
         }
 
         break
+      case *msg.SpectateMsg:
+        player := s.players.GetPlayer(t.GetPlayerId())
+        if player == nil || player.Udp.GetState() != udp.SPECTATING {
+          logger.Debug("spectate when not spectating", "player", t.GetPlayerId())
+          break
+        }
+        s.spectate(player, t)
       default:
     }
   }
 
   notifyWorld := seq % helpers.GetConfiguredWorldRate() == 0
-  x := float32(-1)
-  y := float32(-1)
+  worldMsg, leaving := s.advanceBodies(frameStart, seq, notifyWorld)
+  if s.recorder != nil && s.frame % CHECK_RATE == 0 {
+    bodies, hash := s.bodyHash()
+    s.recorder.check(s.frame, bodies, hash)
+  }
 
+  if notifyWorld {
+    for _, part := range worldMsg.Split() {
+      s.toWorld <- part
+    }
+  }
 
-  worldMsg := []byte{}
-  head := 1
+  stream := seq % helpers.GetConfig().SPECTATE_RATE == 0
+  if stream || notifyWorld {
+    cameraMsg := s.watch(seq, stream, notifyWorld)
+    if len(cameraMsg.Cameras) > 0 {
+      s.toWorld <- &cameraMsg
+    }
+  }
 
-  if notifyWorld == true {
-    worldMsg = append(worldMsg, byte(snet.IState))
+  for _, playerId := range leaving {
+    s.handOff(playerId, seq)
   }
+  s.spawnHandoffs()
+  s.dropDeadBodies()
+
+  s.players.PackAndSend()
+}
 
-  // Advance the simulation by one step for each controlled body
+// Advance the simulation by one step for each controlled body.
+// Returns where bodies are for WORLD if asked, and who left the region.
+func (s *Simulation) advanceBodies(frameStart int64, seq int, notifyWorld bool) (worldMsg link.StateMsg, leaving []uuid.UUID) {
   s.controlledBodies.Range(func(key, value interface{}) bool {
     cb := value.(*ControlledBody)
-    x, y = cb.ProcessFrame(frameStart, seq)
-    if notifyWorld && x != -1 && y != -1 {
+    x, y := cb.ProcessFrame(frameStart, seq)
+    if x != -1 && y != -1 {
       gridX, gridY := s.worldMap.GetCellFromPosition(x, y)
-      bod := cb.GetBody()
-      worldMsg = append(worldMsg, []byte{0, 0, 0, 0, 0, 0}...)
-      binary.LittleEndian.PutUint16(worldMsg[head:head+2], bod.Id)
-      head += 2
-      binary.LittleEndian.PutUint16(worldMsg[head:head+2], uint16(gridX))
-      head += 2
-      binary.LittleEndian.PutUint16(worldMsg[head:head+2], uint16(gridY))
-      head+= 2
+      if !s.region.Contains(gridX, gridY) {
+        leaving = append(leaving, key.(uuid.UUID))
+      } else if notifyWorld {
+        bod := cb.GetBody()
+        worldMsg.Bodies = append(worldMsg.Bodies, link.BodyState{Id: bod.Id, X: uint16(gridX), Y: uint16(gridY)})
+      }
     }
 
     return true
   })
+  return
+}
 
-  if notifyWorld && len(worldMsg) > 1 {
-    s.toWorld <- worldMsg
-  }
-
-  // Update all bodies
-  // flag dead bodies for removal
-  // process live bodies
-  // replace ps.bodies with filtered list
+// Update all bodies
+// flag dead bodies for removal
+// process live bodies
+// replace ps.bodies with filtered list
+func (s *Simulation) dropDeadBodies() {
   filteredBodies := s.allBodies[:0]
   for i, b := range s.allBodies {
     if !b.IsDead() {
@@ -196,8 +239,28 @@ func (s *Simulation) processFrame(frameStart int64, seq int) {
     }
   }
   s.allBodies = filteredBodies
+}
 
-  s.players.PackAndSend()
+// Number of controlled bodies and a hash of where they are after
+// the last frame, compared by Replay to find where it went apart.
+func (s *Simulation) bodyHash() (int, uint64) {
+  var bodies []*udp.UDPBody
+  s.controlledBodies.Range(func(key, value interface{}) bool {
+    bodies = append(bodies, value.(*ControlledBody).GetBody())
+    return true
+  })
+  sort.Slice(bodies, func(i, j int) bool { return bodies[i].Id < bodies[j].Id })
+
+  hash := fnv.New64a()
+  b := make([]byte, 0, 2 + 4 * 7)
+  for _, bod := range bodies {
+    b = binary.LittleEndian.AppendUint16(b[:0], bod.Id)
+    for _, f := range []float32{bod.TargetPosition[0], bod.TargetPosition[1], bod.TargetPosition[2], bod.TargetAngle, bod.Velocity[0], bod.Velocity[1], bod.Velocity[2]} {
+      b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+    }
+    hash.Write(b)
+  }
+  return len(bodies), hash.Sum64()
 }
 
 // Simulation loop
@@ -219,10 +282,13 @@ func (s *Simulation) loop() {
     frameStart = frameStartTime.UnixNano()
     framesToProcess = ((frameStart - s.lastSync) / timestepNano) - int64(s.seq)
     if framesToProcess > 0 {
+      s.framesBehind.Set(float64(framesToProcess - 1))
       for i := int64(0); i < framesToProcess; i++ {
         s.seq++
         s.lastFrame = s.lastSync + (int64(s.seq) * timestepNano)
+        processStart := time.Now()
         s.processFrame(s.lastFrame, int(s.seq))
+        s.frameTime.ObserveDuration(time.Since(processStart))
 
         if s.seq == 0 {
           shouldSync = true
@@ -237,6 +303,25 @@ func (s *Simulation) loop() {
   }
 }
 
+// Record the match to r, call before Start.
+func (s *Simulation) SetRecorder(r *Recorder) {
+  s.recorder = r
+}
+
+// Ends the recording, if any. Frames after are not recorded.
+func (s *Simulation) StopRecording() error {
+  return s.recorder.Close(s.frame)
+}
+
+// Call before Start. Queue depths are read on each scrape.
+func (s *Simulation) RegisterMetrics(r *metrics.Registry) {
+  s.frameTime = r.Histogram("space_sim_frame_seconds", "Time spent processing one simulation frame.",
+    []float64{.0005, .001, .0025, .005, .01, .02, .033, .05, .1})
+  s.framesBehind = r.Gauge("space_sim_frames_behind", "Frames the last tick had to catch up on.")
+  r.GaugeFunc("space_sim_from_players_queue", "Client messages waiting for the simulation.", func() float64 { return float64(len(s.fromPlayers)) })
+  r.GaugeFunc("space_sim_to_world_queue", "Link messages waiting to go to WORLD.", func() float64 { return float64(len(s.toWorld)) })
+}
+
 // Actions
 //////////////
 
@@ -259,17 +344,174 @@ func (s *Simulation) addControlledBody(id uuid.UUID, cb *ControlledBody) {
   s.controlledBodies.Store(id, cb)
 }
 
+// Removed at the start of the next frame, safe from any goroutine.
 func (s *Simulation) RemoveControlledBody(id uuid.UUID) {
+  if s.removals == nil {
+    // not started, nothing to remove
+    return
+  }
+  s.removals <- id
+}
+
+// Remove now, recorded as happening before frame at.
+func (s *Simulation) removeControlledBody(id uuid.UUID, at uint32) {
   cb, ok := s.controlledBodies.Load(id)
   if ok && cb != nil {
     cb.(*ControlledBody).GetBody().Kill()
     s.controlledBodies.Delete(id)
+    s.recorder.exit(at, id)
   }
 }
 
 // Access
 /////////////
 
+// Cells of every live body, used to keep spawns apart.
+func (s *Simulation) occupiedCells() [][2]int {
+  cells := [][2]int{}
+  for _, b := range s.allBodies {
+    if !b.IsDead() {
+      x, y := s.worldMap.GetCellFromPosition(b.Position.X(), b.Position.Y())
+      cells = append(cells, [2]int{x, y})
+    }
+  }
+  return cells
+}
+
 func (s *Simulation) GetPlayerChan() chan udp.UDPMsg {
   return s.fromPlayers
 }
+
+// Who controls which body, for resyncing WORLD.
+func (s *Simulation) ControlledBodies() []link.SyncBody {
+  bodies := []link.SyncBody{}
+  s.controlledBodies.Range(func(key, value interface{}) bool {
+    bodies = append(bodies, link.SyncBody{BodyId: value.(*ControlledBody).GetBody().Id, PlayerId: key.(uuid.UUID)})
+    return true
+  })
+  return bodies
+}
+
+// Sharding
+/////////////
+
+// Bodies only leave the region while WORLD is there to take them.
+func (s *Simulation) SetLinked(linked bool) {
+  if linked {
+    atomic.StoreInt32(&s.linked, 1)
+  } else {
+    atomic.StoreInt32(&s.linked, 0)
+  }
+}
+
+// Body arriving from another SIM, spawned once its player connects.
+func (s *Simulation) AcceptHandoff(m *link.HandoffMsg) {
+  s.handoffs.Store(m.PlayerId, m)
+}
+
+func (s *Simulation) ForgetHandoff(playerId uuid.UUID) {
+  s.handoffs.Delete(playerId)
+}
+
+// Give a body that crossed the region boundary to WORLD
+// so it can pass it to the SIM owning where it went.
+func (s *Simulation) handOff(playerId uuid.UUID, seq int) {
+  if atomic.LoadInt32(&s.linked) == 0 {
+    return
+  }
+
+  player := s.players.GetPlayer(playerId)
+  cb, ok := s.controlledBodies.Load(playerId)
+  if player == nil || !ok || cb == nil {
+    return
+  }
+
+  bodyId := cb.(*ControlledBody).GetBody().Id
+  ht := cb.(*ControlledBody).GetTransform(seq - 1)
+  // after this frame's bodies moved, so it counts from the next one
+  s.removeControlledBody(playerId, s.frame + 1)
+  player.Udp.SetState(udp.SPECTATING)
+
+  var exitMsg msg.ExitMsg
+  exitMsg.BodyId = bodyId
+  s.players.PushAll(&exitMsg)
+
+  var handoffMsg link.HandoffMsg
+  handoffMsg.PlayerId = playerId
+  handoffMsg.Team = player.Team
+  handoffMsg.Stats = player.Stats
+  handoffMsg.Angle = ht.Angle
+  handoffMsg.AngleDelta = ht.AngleDelta
+  handoffMsg.Position = ht.Position
+  handoffMsg.Velocity = ht.Velocity
+  handoffMsg.VelocityDelta = ht.VelocityDelta
+  s.toWorld <- &handoffMsg
+
+  logger.Info("handing off", "player", playerId, "x", ht.Position.X(), "y", ht.Position.Y())
+}
+
+func (s *Simulation) spawnHandoffs() {
+  s.handoffs.Range(func(key, value interface{}) bool {
+    player := s.players.GetPlayer(key.(uuid.UUID))
+    if player == nil || player.Udp.GetState() != udp.SPECTATING {
+      return true
+    }
+
+    m := value.(*link.HandoffMsg)
+    player.Team = m.Team
+    player.Stats = m.Stats
+
+    var ht HistoricalTransform
+    ht.Angle = m.Angle
+    ht.AngleDelta = m.AngleDelta
+    ht.Position = m.Position
+    ht.Velocity = m.Velocity
+    ht.VelocityDelta = m.VelocityDelta
+
+    // WORLD bounces a body back when nobody owns where it went,
+    // stop it at the edge instead.
+    cellX, cellY := s.worldMap.GetCellFromPosition(ht.Position.X(), ht.Position.Y())
+    if !s.region.Contains(cellX, cellY) {
+      cellX, cellY = s.region.Clamp(cellX, cellY)
+      x, y := s.worldMap.GetCellCenter(cellX, cellY)
+      ht.Position = mgl32.Vec3{x, y, 0}
+      ht.Velocity = mgl32.Vec3{0, 0, 0}
+      ht.VelocityDelta = mgl32.Vec3{0, 0, 0}
+    }
+
+    s.handoffs.Delete(key)
+    s.spawn(player, ht, s.frame + 1)
+    return true
+  })
+}
+
+// Put player in control of a new body at ht, recorded as
+// happening before frame at.
+func (s *Simulation) spawn(player *SimPlayer, ht HistoricalTransform, at uint32) {
+  playerId := player.Udp.Id
+  ht.Seq = int(s.seq)
+
+  pBod := NewControlledBody(player)
+  pBod.Initialize(ht)
+  s.addControlledBody(playerId, pBod)
+  s.recorder.enter(at, player, playerId, pBod.GetBody().Id, ht)
+  player.Udp.SetState(udp.PLAYING)
+  player.Camera = Camera{}
+
+  cellX, cellY := s.worldMap.GetCellFromPosition(ht.Position.X(), ht.Position.Y())
+  logger.Info("spawning", "player", playerId, "body", pBod.GetBody().Id, "cellX", cellX, "cellY", cellY)
+
+  // tell other players
+  var response msg.EnterMsg
+  response.PlayerId = playerId
+  response.BodyId = pBod.GetBody().Id
+  response.X = uint32(cellX)
+  response.Y = uint32(cellY)
+  s.players.PushAll(&response)
+
+  // tell the map server
+  var worldSpawnMsg link.SpawnMsg
+  worldSpawnMsg.BodyId = pBod.GetBody().Id
+  worldSpawnMsg.PlayerId = playerId
+  s.toWorld <- &worldSpawnMsg
+}
@@ -1,8 +1,6 @@
 package sim
 
 import(
-  "log"
-
   "go-space-serv/internal/space/util"
 )
 
@@ -32,7 +30,7 @@ func NewStateBuffer(size int) *StateBuffer {
 }
 
 func (sb *StateBuffer) Initialize(ht HistoricalTransform) {
-  log.Printf("Initializing statebuffer @ %d", ht.Seq)
+  logger.Debug("initializing state buffer", "seq", ht.Seq)
   sb.currentSeq = ht.Seq
   sb.current = ht
   sb.current.Seq = ht.Seq
@@ -30,7 +30,18 @@ func (msg *EnterMsg) Serialize(bytes []byte) {
   return
 }
 func (msg *EnterMsg) GetSize() int {
-  return 26
+  return 27
 }
 
-func (msg *EnterMsg) Deserialize(bytes []byte, head int) int { return head }
+func (msg *EnterMsg) Deserialize(bytes []byte, head int) int {
+  head++
+  copy(msg.PlayerId[0:], bytes[head:head+16])
+  head += 16
+  msg.BodyId = binary.LittleEndian.Uint16(bytes[head:head+2])
+  head += 2
+  msg.X = binary.LittleEndian.Uint32(bytes[head:head+4])
+  head += 4
+  msg.Y = binary.LittleEndian.Uint32(bytes[head:head+4])
+  head += 4
+  return head
+}
@@ -21,7 +21,11 @@ func (msg *ExitMsg) Serialize(bytes []byte) {
   return
 }
 func (msg *ExitMsg) GetSize() int {
-  return 26
+  return 3
 }
 
-func (msg *ExitMsg) Deserialize(bytes []byte, head int) int { return head }
+func (msg *ExitMsg) Deserialize(bytes []byte, head int) int {
+  head++
+  msg.BodyId = binary.LittleEndian.Uint16(bytes[head:head+2])
+  return head + 2
+}
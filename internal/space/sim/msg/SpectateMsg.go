@@ -0,0 +1,52 @@
+package msg
+
+import(
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet/udp"
+)
+
+// Camera modes of a SpectateMsg.
+const(
+  CAMERA_NONE   byte = iota   // stop streaming
+  CAMERA_FOLLOW               // follow BodyId
+  CAMERA_FREE                 // hold still over cell X, Y
+)
+
+// client -> SIM: what a spectator wants to watch.
+type SpectateMsg struct {
+  // local
+  playerId uuid.UUID
+
+  // common
+  Mode    byte
+  BodyId  uint16
+  X       uint32
+  Y       uint32
+}
+
+func (msg *SpectateMsg) GetCmd() udp.UDPCmd { return udp.SPECTATE }
+func (msg *SpectateMsg) GetSize() int { return 12 }
+
+func (msg *SpectateMsg) Serialize(bytes []byte) {
+  bytes[0] = byte(udp.SPECTATE)
+  bytes[1] = msg.Mode
+  binary.LittleEndian.PutUint16(bytes[2:4], msg.BodyId)
+  binary.LittleEndian.PutUint32(bytes[4:8], msg.X)
+  binary.LittleEndian.PutUint32(bytes[8:12], msg.Y)
+}
+
+func (msg *SpectateMsg) Deserialize(bytes []byte, head int) int {
+  head++
+  msg.Mode = bytes[head]
+  head++
+  msg.BodyId = binary.LittleEndian.Uint16(bytes[head:head+2])
+  head += 2
+  msg.X = binary.LittleEndian.Uint32(bytes[head:head+4])
+  head += 4
+  msg.Y = binary.LittleEndian.Uint32(bytes[head:head+4])
+  return head + 4
+}
+
+func (msg *SpectateMsg) SetPlayerId(id uuid.UUID) { msg.playerId = id }
+func (msg *SpectateMsg) GetPlayerId() uuid.UUID   { return msg.playerId }
@@ -0,0 +1,73 @@
+package msg
+
+import(
+  "math"
+  "encoding/binary"
+  "go-space-serv/internal/space/snet/udp"
+)
+
+const bodyStateSize int = 22
+
+// Most bodies in one StateMsg, so a few unacked ones still fit in a packet.
+const MAX_STATE_BODIES int = 16
+
+// Where a body is after frame Seq, in world units.
+type BodyState struct {
+  Id        uint16
+  X         float32
+  Y         float32
+  Angle     float32
+  VelocityX float32
+  VelocityY float32
+}
+
+// SIM -> spectator: the bodies nearest its camera.
+type StateMsg struct {
+  Seq     uint16
+  X       uint32    // camera cell
+  Y       uint32
+  Bodies  []BodyState
+}
+
+func (msg *StateMsg) GetCmd() udp.UDPCmd { return udp.STATE }
+func (msg *StateMsg) GetSize() int { return 12 + len(msg.Bodies) * bodyStateSize }
+
+func (msg *StateMsg) Serialize(bytes []byte) {
+  bytes[0] = byte(udp.STATE)
+  binary.LittleEndian.PutUint16(bytes[1:3], msg.Seq)
+  binary.LittleEndian.PutUint32(bytes[3:7], msg.X)
+  binary.LittleEndian.PutUint32(bytes[7:11], msg.Y)
+  bytes[11] = byte(len(msg.Bodies))
+
+  head := 12
+  for _, b := range msg.Bodies {
+    binary.LittleEndian.PutUint16(bytes[head:head+2], b.Id)
+    binary.LittleEndian.PutUint32(bytes[head+2:head+6], math.Float32bits(b.X))
+    binary.LittleEndian.PutUint32(bytes[head+6:head+10], math.Float32bits(b.Y))
+    binary.LittleEndian.PutUint32(bytes[head+10:head+14], math.Float32bits(b.Angle))
+    binary.LittleEndian.PutUint32(bytes[head+14:head+18], math.Float32bits(b.VelocityX))
+    binary.LittleEndian.PutUint32(bytes[head+18:head+22], math.Float32bits(b.VelocityY))
+    head += bodyStateSize
+  }
+}
+
+func (msg *StateMsg) Deserialize(bytes []byte, head int) int {
+  head++
+  msg.Seq = binary.LittleEndian.Uint16(bytes[head:head+2])
+  msg.X = binary.LittleEndian.Uint32(bytes[head+2:head+6])
+  msg.Y = binary.LittleEndian.Uint32(bytes[head+6:head+10])
+  msg.Bodies = make([]BodyState, bytes[head+10])
+  head += 11
+
+  for i := range msg.Bodies {
+    b := &msg.Bodies[i]
+    b.Id = binary.LittleEndian.Uint16(bytes[head:head+2])
+    b.X = math.Float32frombits(binary.LittleEndian.Uint32(bytes[head+2:head+6]))
+    b.Y = math.Float32frombits(binary.LittleEndian.Uint32(bytes[head+6:head+10]))
+    b.Angle = math.Float32frombits(binary.LittleEndian.Uint32(bytes[head+10:head+14]))
+    b.VelocityX = math.Float32frombits(binary.LittleEndian.Uint32(bytes[head+14:head+18]))
+    b.VelocityY = math.Float32frombits(binary.LittleEndian.Uint32(bytes[head+18:head+22]))
+    head += bodyStateSize
+  }
+  return head
+}
@@ -22,4 +22,10 @@ func (msg *SyncMsg) Serialize(bytes []byte) {
   return
 }
 
-func (msg *SyncMsg) Deserialize(bytes []byte, head int) int { return head }
+func (msg *SyncMsg) Deserialize(bytes []byte, head int) int {
+  head++
+  msg.Seq = binary.LittleEndian.Uint16(bytes[head:head+2])
+  head += 2
+  msg.Time = binary.LittleEndian.Uint64(bytes[head:head+8])
+  return head + 8
+}
@@ -12,4 +12,12 @@ const(
   ISpawn
   IState
   IShutdown
+  IChallenge
+  IHello
+  IWelcome
+  IReject
+  ISync
+  IHandoff
+  ILogLevel
+  ICamera
 )
@@ -0,0 +1,62 @@
+package snet
+
+import(
+  "crypto/hmac"
+  "crypto/sha256"
+)
+
+// WORLD <-> SIM handshake
+//
+// WORLD -> SIM   IChallenge version(2) worldNonce(16)
+// SIM -> WORLD   IHello version(2) simNonce(16) mac(32)
+// WORLD -> SIM   IWelcome mac(32), or IReject reason(1)
+//
+// Each mac is HMAC-SHA256 keyed with the shared secret over who is
+// proving it, then both nonces. Both sides prove they know the secret
+// without it crossing the wire, and neither mac can be replayed as the other.
+
+// Bump whenever the internal protocol changes.
+const LINK_VERSION uint16 = 8
+
+const LINK_NONCE_SIZE int = 16
+const LINK_MAC_SIZE int = sha256.Size
+const LINK_CHALLENGE_SIZE int = 1 + 2 + LINK_NONCE_SIZE
+const LINK_HELLO_SIZE int = 1 + 2 + LINK_NONCE_SIZE + LINK_MAC_SIZE
+const LINK_WELCOME_SIZE int = 1 + LINK_MAC_SIZE
+
+// Who a mac proves knows the secret.
+type LinkRole string
+
+const (
+  LINK_SIM LinkRole = "sim"
+  LINK_WORLD LinkRole = "world"
+)
+
+type LinkRejectReason byte
+
+const (
+  REJECT_VERSION LinkRejectReason = iota + 1
+  REJECT_AUTH
+)
+
+func (r LinkRejectReason) String() string {
+  switch r {
+    case REJECT_VERSION:
+      return "protocol version mismatch"
+    case REJECT_AUTH:
+      return "bad secret"
+  }
+  return "unknown"
+}
+
+func LinkMAC(secret string, role LinkRole, worldNonce, simNonce []byte) []byte {
+  mac := hmac.New(sha256.New, []byte(secret))
+  mac.Write([]byte(role))
+  mac.Write(worldNonce)
+  mac.Write(simNonce)
+  return mac.Sum(nil)
+}
+
+func CheckLinkMAC(secret string, role LinkRole, worldNonce, simNonce, received []byte) bool {
+  return hmac.Equal(LinkMAC(secret, role, worldNonce, simNonce), received)
+}
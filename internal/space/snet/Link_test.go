@@ -0,0 +1,29 @@
+package snet
+
+import(
+  "bytes"
+  "testing"
+)
+
+// A mac only checks for the role, secret and nonces it was made with.
+func TestLinkMAC(t *testing.T) {
+  worldNonce := bytes.Repeat([]byte{1}, LINK_NONCE_SIZE)
+  simNonce := bytes.Repeat([]byte{2}, LINK_NONCE_SIZE)
+  mac := LinkMAC("secret", LINK_SIM, worldNonce, simNonce)
+
+  if len(mac) != LINK_MAC_SIZE {
+    t.Fatalf("mac is %d bytes, want %d", len(mac), LINK_MAC_SIZE)
+  }
+  if !CheckLinkMAC("secret", LINK_SIM, worldNonce, simNonce, mac) {
+    t.Fatalf("mac doesn't check")
+  }
+  if CheckLinkMAC("secret", LINK_WORLD, worldNonce, simNonce, mac) {
+    t.Fatalf("sim's mac passes as world's")
+  }
+  if CheckLinkMAC("other", LINK_SIM, worldNonce, simNonce, mac) {
+    t.Fatalf("mac checks with another secret")
+  }
+  if CheckLinkMAC("secret", LINK_SIM, simNonce, worldNonce, mac) {
+    t.Fatalf("mac checks with the nonces swapped")
+  }
+}
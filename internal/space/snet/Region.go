@@ -0,0 +1,80 @@
+package snet
+
+import(
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+// Rectangle of map cells one SIM is responsible for.
+// Min is inclusive, Max is exclusive.
+type Region struct {
+  MinX uint32
+  MinY uint32
+  MaxX uint32
+  MaxY uint32
+}
+
+func WholeMap() Region {
+  return Region{0, 0, math.MaxUint32, math.MaxUint32}
+}
+
+// "minX,minY,maxX,maxY", empty for the whole map.
+func ParseRegion(s string) (Region, error) {
+  if strings.TrimSpace(s) == "" {
+    return WholeMap(), nil
+  }
+
+  parts := strings.Split(s, ",")
+  if len(parts) != 4 {
+    return Region{}, fmt.Errorf("region %q: expected minX,minY,maxX,maxY", s)
+  }
+
+  var vals [4]uint32
+  for i, p := range parts {
+    v, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32)
+    if err != nil {
+      return Region{}, fmt.Errorf("region %q: %s", s, err)
+    }
+    vals[i] = uint32(v)
+  }
+
+  r := Region{vals[0], vals[1], vals[2], vals[3]}
+  if r.MinX >= r.MaxX || r.MinY >= r.MaxY {
+    return Region{}, fmt.Errorf("region %q is empty", s)
+  }
+  return r, nil
+}
+
+func (r Region) Contains(x, y int) bool {
+  return x >= 0 && y >= 0 &&
+    uint32(x) >= r.MinX && uint32(x) < r.MaxX &&
+    uint32(y) >= r.MinY && uint32(y) < r.MaxY
+}
+
+func (r Region) Overlaps(o Region) bool {
+  return r.MinX < o.MaxX && o.MinX < r.MaxX && r.MinY < o.MaxY && o.MinY < r.MaxY
+}
+
+// Nearest cell inside the region.
+func (r Region) Clamp(x, y int) (int, int) {
+  return clampCell(x, r.MinX, r.MaxX), clampCell(y, r.MinY, r.MaxY)
+}
+
+func clampCell(v int, min, max uint32) int {
+  if v < 0 || uint32(v) < min {
+    return int(min)
+  }
+  if uint32(v) >= max {
+    return int(max - 1)
+  }
+  return v
+}
+
+func (r Region) String() string {
+  if r == WholeMap() {
+    return "whole map"
+  }
+  return fmt.Sprintf("%d,%d-%d,%d", r.MinX, r.MinY, r.MaxX, r.MaxY)
+}
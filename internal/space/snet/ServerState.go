@@ -8,6 +8,27 @@ const (
   WAIT_WORLD                    // Waiting on a world connection
   SETUP                         // Exchanging data
   ALIVE                         // Accepting player connections
+  DEGRADED                      // Lost physics, keeping players until it returns
   SHUTDOWN                      // Shutting down the server.
 
 )
+
+func (s ServerState) String() string {
+  switch s {
+    case DEAD:
+      return "DEAD"
+    case WAIT_PHYS:
+      return "WAIT_PHYS"
+    case WAIT_WORLD:
+      return "WAIT_WORLD"
+    case SETUP:
+      return "SETUP"
+    case ALIVE:
+      return "ALIVE"
+    case DEGRADED:
+      return "DEGRADED"
+    case SHUTDOWN:
+      return "SHUTDOWN"
+  }
+  return "UNKNOWN"
+}
@@ -0,0 +1,55 @@
+package link
+
+import(
+  "errors"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+)
+
+const cameraStateSize int = 20
+
+// Most cameras that fit in one frame.
+const MAX_CAMERAS int = (MAX_FRAME_SIZE - 1) / cameraStateSize
+
+// Grid cell a spectator is looking at.
+type CameraState struct {
+  PlayerId uuid.UUID
+  X uint16
+  Y uint16
+}
+
+// SIM -> WORLD: where spectators' cameras moved, sent every
+// WORLD_RATE frames for the ones that moved since.
+type CameraMsg struct {
+  Cameras []CameraState
+}
+
+func (msg *CameraMsg) GetCmd() snet.InternalCmd { return snet.ICamera }
+func (msg *CameraMsg) Serialize() []byte {
+  body := make([]byte, len(msg.Cameras) * cameraStateSize)
+  head := 0
+  for _, c := range msg.Cameras {
+    copy(body[head:head+16], c.PlayerId[0:])
+    binary.LittleEndian.PutUint16(body[head+16:head+18], c.X)
+    binary.LittleEndian.PutUint16(body[head+18:head+20], c.Y)
+    head += cameraStateSize
+  }
+  return body
+}
+func (msg *CameraMsg) Deserialize(body []byte) error {
+  if len(body) % cameraStateSize != 0 {
+    return errors.New("link: camera body is not a whole number of cameras")
+  }
+  msg.Cameras = make([]CameraState, len(body) / cameraStateSize)
+  head := 0
+  for i := range msg.Cameras {
+    copy(msg.Cameras[i].PlayerId[0:], body[head:head+16])
+    msg.Cameras[i].X = binary.LittleEndian.Uint16(body[head+16:head+18])
+    msg.Cameras[i].Y = binary.LittleEndian.Uint16(body[head+18:head+20])
+    head += cameraStateSize
+  }
+  return nil
+}
@@ -0,0 +1,74 @@
+package link
+
+import(
+  "math"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+  "github.com/go-gl/mathgl/mgl32"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/player"
+)
+
+const handoffSize int = 16 + 1 + 12 + 4 * 2 + 12 * 3
+
+// SIM -> WORLD: body left this SIM's region.
+// WORLD -> SIM: body entered this SIM's region, spawn it
+// once the player connects.
+type HandoffMsg struct {
+  PlayerId uuid.UUID
+  Team byte
+  Stats player.PlayerStats
+
+  // HistoricalTransform at the moment it left, minus Seq
+  // which means nothing to another simulation.
+  Angle float32
+  AngleDelta float32
+  Position mgl32.Vec3
+  Velocity mgl32.Vec3
+  VelocityDelta mgl32.Vec3
+}
+
+func (msg *HandoffMsg) GetCmd() snet.InternalCmd { return snet.IHandoff }
+func (msg *HandoffMsg) Serialize() []byte {
+  body := make([]byte, 17, handoffSize)
+  copy(body[0:16], msg.PlayerId[0:])
+  body[16] = msg.Team
+
+  floats := []float32{
+    msg.Stats.Thrust, msg.Stats.MaxSpeed, msg.Stats.Rotation,
+    msg.Angle, msg.AngleDelta,
+  }
+  floats = append(floats, msg.Position[0:]...)
+  floats = append(floats, msg.Velocity[0:]...)
+  floats = append(floats, msg.VelocityDelta[0:]...)
+  for _, f := range floats {
+    body = append(body, 0, 0, 0, 0)
+    binary.LittleEndian.PutUint32(body[len(body)-4:], math.Float32bits(f))
+  }
+  return body
+}
+func (msg *HandoffMsg) Deserialize(body []byte) error {
+  if len(body) < handoffSize {
+    return ErrShortBody
+  }
+  copy(msg.PlayerId[0:], body[0:16])
+  msg.Team = body[16]
+
+  head := 17
+  next := func() float32 {
+    f := math.Float32frombits(binary.LittleEndian.Uint32(body[head:head+4]))
+    head += 4
+    return f
+  }
+  msg.Stats.Thrust = next()
+  msg.Stats.MaxSpeed = next()
+  msg.Stats.Rotation = next()
+  msg.Angle = next()
+  msg.AngleDelta = next()
+  msg.Position = mgl32.Vec3{next(), next(), next()}
+  msg.Velocity = mgl32.Vec3{next(), next(), next()}
+  msg.VelocityDelta = mgl32.Vec3{next(), next(), next()}
+  return nil
+}
@@ -0,0 +1,63 @@
+package link
+
+import(
+  "net"
+  "math"
+  "errors"
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/player"
+)
+
+// WORLD -> SIM: accept udp packets from Ip for this player,
+// who spawns with Team flying a ship with Stats.
+//
+// body: player(16) ipLen(1) ip(ipLen) team(1) thrust(4) maxSpeed(4) rotation(4)
+type JoinMsg struct {
+  PlayerId uuid.UUID
+  Ip net.IP
+  Team byte
+  Stats player.PlayerStats
+}
+
+func (msg *JoinMsg) GetCmd() snet.InternalCmd { return snet.IJoin }
+func (msg *JoinMsg) Serialize() []byte {
+  body := make([]byte, 0, 30 + len(msg.Ip))
+  body = append(body, msg.PlayerId[0:]...)
+  body = append(body, byte(len(msg.Ip)))
+  body = append(body, msg.Ip...)
+  body = append(body, msg.Team)
+  for _, f := range []float32{msg.Stats.Thrust, msg.Stats.MaxSpeed, msg.Stats.Rotation} {
+    body = append(body, 0, 0, 0, 0)
+    binary.LittleEndian.PutUint32(body[len(body)-4:], math.Float32bits(f))
+  }
+  return body
+}
+func (msg *JoinMsg) Deserialize(body []byte) error {
+  if len(body) < 17 {
+    return ErrShortBody
+  }
+  copy(msg.PlayerId[0:], body[0:16])
+
+  ipLen := int(body[16])
+  if ipLen != net.IPv4len && ipLen != net.IPv6len {
+    return errors.New("link: bad ip length")
+  }
+  if len(body) < 30 + ipLen {
+    return ErrShortBody
+  }
+  msg.Ip = append(net.IP{}, body[17:17+ipLen]...)
+  msg.Team = body[17+ipLen]
+
+  head := 18 + ipLen
+  next := func() float32 {
+    f := math.Float32frombits(binary.LittleEndian.Uint32(body[head:head+4]))
+    head += 4
+    return f
+  }
+  msg.Stats.Thrust = next()
+  msg.Stats.MaxSpeed = next()
+  msg.Stats.Rotation = next()
+  return nil
+}
@@ -0,0 +1,23 @@
+package link
+
+import(
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+)
+
+// WORLD -> SIM: player disconnected.
+type LeaveMsg struct {
+  PlayerId uuid.UUID
+}
+
+func (msg *LeaveMsg) GetCmd() snet.InternalCmd { return snet.ILeave }
+func (msg *LeaveMsg) Serialize() []byte {
+  return append([]byte{}, msg.PlayerId[0:]...)
+}
+func (msg *LeaveMsg) Deserialize(body []byte) error {
+  if len(body) < 16 {
+    return ErrShortBody
+  }
+  copy(msg.PlayerId[0:], body[0:16])
+  return nil
+}
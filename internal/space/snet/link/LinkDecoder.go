@@ -0,0 +1,76 @@
+package link
+
+import(
+  "fmt"
+  "errors"
+  "encoding/binary"
+
+  "go-space-serv/internal/space/snet"
+)
+
+// A frame with length 0 means the stream is out of step
+// and nothing after it can be trusted.
+var ErrBadFrame = errors.New("link: bad frame length")
+
+// Turns a stream of bytes, split or merged arbitrarily
+// by the transport, back into messages.
+type LinkDecoder struct {
+  buf []byte
+}
+
+func NewLinkDecoder() *LinkDecoder {
+  var d LinkDecoder
+  d.buf = make([]byte, 0, 1024)
+  return &d
+}
+
+// Append bytes read from the link.
+func (d *LinkDecoder) Feed(data []byte) {
+  d.buf = append(d.buf, data...)
+}
+
+// Returns the next complete message, or nil if more bytes are needed.
+// A frame with an unknown cmd or malformed body is consumed and
+// reported as an error, the stream can continue after it.
+// ErrBadFrame is not recoverable.
+func (d *LinkDecoder) Next() (LinkMsg, error) {
+  if len(d.buf) < FRAME_HEADER_SIZE {
+    return nil, nil
+  }
+
+  length := int(binary.LittleEndian.Uint16(d.buf[0:2]))
+  if length == 0 {
+    return nil, ErrBadFrame
+  }
+
+  if len(d.buf) < FRAME_HEADER_SIZE + length {
+    return nil, nil
+  }
+
+  cmd := snet.InternalCmd(d.buf[FRAME_HEADER_SIZE])
+  body := d.buf[FRAME_HEADER_SIZE + 1 : FRAME_HEADER_SIZE + length]
+  // body points into buf, read it before shifting what follows over it
+  defer d.consume(FRAME_HEADER_SIZE + length)
+
+  msg := newMsg(cmd)
+  if msg == nil {
+    return nil, fmt.Errorf("link: unknown cmd %d", cmd)
+  }
+
+  if err := msg.Deserialize(body); err != nil {
+    return nil, err
+  }
+
+  return msg, nil
+}
+
+// Bytes received but not yet decoded.
+func (d *LinkDecoder) Buffered() int {
+  return len(d.buf)
+}
+
+func (d *LinkDecoder) consume(n int) {
+  // messages never keep references into buf, safe to shift.
+  remaining := copy(d.buf, d.buf[n:])
+  d.buf = d.buf[:remaining]
+}
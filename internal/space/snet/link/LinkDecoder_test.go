@@ -0,0 +1,200 @@
+package link
+
+import(
+  "net"
+  "errors"
+  "reflect"
+  "testing"
+
+  "github.com/go-gl/mathgl/mgl32"
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/player"
+)
+
+// One of every message, with every field set.
+func sampleMsgs() []LinkMsg {
+  a := uuid.MustParse("0b5e5a53-1c7e-4c0e-9d55-6f1a2b3c4d5e")
+  b := uuid.MustParse("9f8e7d6c-5b4a-4392-8170-6a5b4c3d2e1f")
+  return []LinkMsg{
+    &ReadyMsg{Port: 7777, Region: snet.Region{MinX: 1, MinY: 2, MaxX: 300, MaxY: 400}},
+    &JoinMsg{PlayerId: a, Ip: net.IPv4(10, 0, 0, 7).To4(), Team: 2, Stats: player.DefaultPlayerStats()},
+    &JoinMsg{PlayerId: b, Ip: net.ParseIP("2001:db8::1"), Team: 0, Stats: player.PlayerStats{Thrust: 20, MaxSpeed: 40, Rotation: 270}},
+    &LeaveMsg{PlayerId: a},
+    &SpecMsg{BodyId: 12},
+    &SpawnMsg{BodyId: 13, PlayerId: b},
+    &StateMsg{Bodies: []BodyState{{Id: 1, X: 2, Y: 3}, {Id: 65535, X: 400, Y: 0}}},
+    &ShutdownMsg{},
+    &SyncMsg{Players: []uuid.UUID{a, b}, Bodies: []SyncBody{{BodyId: 4, PlayerId: a}}},
+    &SyncMsg{Continued: true, Players: []uuid.UUID{}, Bodies: []SyncBody{{BodyId: 5, PlayerId: b}}},
+    &HandoffMsg{
+      PlayerId: b,
+      Team: 1,
+      Stats: player.DefaultPlayerStats(),
+      Angle: 1.5,
+      AngleDelta: -0.25,
+      Position: mgl32.Vec3{100, 200, 0},
+      Velocity: mgl32.Vec3{-3, 4.5, 0},
+      VelocityDelta: mgl32.Vec3{0.5, 0, 0},
+    },
+    &CameraMsg{Cameras: []CameraState{{PlayerId: a, X: 5, Y: 6}, {PlayerId: b, X: 1023, Y: 0}}},
+    &LogLevelMsg{Subsystem: "udp", Level: "debug"},
+    &LogLevelMsg{Subsystem: "", Level: "warn"},
+  }
+}
+
+func encodeAll(t testing.TB, msgs []LinkMsg) []byte {
+  stream := []byte{}
+  for _, m := range msgs {
+    frame, err := Encode(m)
+    if err != nil {
+      t.Fatalf("encode %T: %s", m, err)
+    }
+    stream = append(stream, frame...)
+  }
+  return stream
+}
+
+// Everything Next returns until it wants more bytes.
+func drain(t testing.TB, d *LinkDecoder) []LinkMsg {
+  msgs := []LinkMsg{}
+  for {
+    m, err := d.Next()
+    if err != nil {
+      t.Fatalf("next: %s", err)
+    }
+    if m == nil {
+      return msgs
+    }
+    msgs = append(msgs, m)
+  }
+}
+
+func checkMsgs(t testing.TB, got, want []LinkMsg) {
+  if len(got) != len(want) {
+    t.Fatalf("got %d messages, want %d", len(got), len(want))
+  }
+  for i := range want {
+    if !reflect.DeepEqual(got[i], want[i]) {
+      t.Fatalf("message %d: got %+v, want %+v", i, got[i], want[i])
+    }
+  }
+}
+
+func TestRoundTrip(t *testing.T) {
+  for _, m := range sampleMsgs() {
+    d := NewLinkDecoder()
+    d.Feed(encodeAll(t, []LinkMsg{m}))
+    got := drain(t, d)
+    checkMsgs(t, got, []LinkMsg{m})
+    if d.Buffered() != 0 {
+      t.Fatalf("%T left %d bytes behind", m, d.Buffered())
+    }
+  }
+}
+
+func TestRoundTripByteAtATime(t *testing.T) {
+  want := sampleMsgs()
+  stream := encodeAll(t, want)
+
+  d := NewLinkDecoder()
+  got := []LinkMsg{}
+  for i := range stream {
+    d.Feed(stream[i:i+1])
+    got = append(got, drain(t, d)...)
+  }
+  checkMsgs(t, got, want)
+}
+
+func TestEncodeTooLarge(t *testing.T) {
+  m := &StateMsg{Bodies: make([]BodyState, MAX_STATE_BODIES + 1)}
+  if _, err := Encode(m); !errors.Is(err, ErrTooLarge) {
+    t.Fatalf("got %v, want ErrTooLarge", err)
+  }
+
+  parts := m.Split()
+  if len(parts) != 2 || len(parts[0].Bodies) != MAX_STATE_BODIES || len(parts[1].Bodies) != 1 {
+    t.Fatalf("split into %d parts", len(parts))
+  }
+  for _, part := range parts {
+    if _, err := Encode(part); err != nil {
+      t.Fatalf("encode part: %s", err)
+    }
+  }
+}
+
+// A sync too big for a frame splits into parts that each fit,
+// only the first replacing what WORLD knows.
+func TestSyncSplit(t *testing.T) {
+  m := &SyncMsg{Players: make([]uuid.UUID, 3000), Bodies: make([]SyncBody, 3000)}
+  for i := range m.Bodies {
+    m.Bodies[i].BodyId = uint16(i)
+  }
+  if _, err := Encode(m); !errors.Is(err, ErrTooLarge) {
+    t.Fatalf("got %v, want ErrTooLarge", err)
+  }
+
+  merged := &SyncMsg{}
+  parts := m.Split()
+  if len(parts) < 2 {
+    t.Fatalf("split into %d parts", len(parts))
+  }
+  for i, part := range parts {
+    if part.Continued != (i > 0) {
+      t.Fatalf("part %d continued %t", i, part.Continued)
+    }
+    if _, err := Encode(part); err != nil {
+      t.Fatalf("encode part %d: %s", i, err)
+    }
+    merged.Players = append(merged.Players, part.Players...)
+    merged.Bodies = append(merged.Bodies, part.Bodies...)
+  }
+  if !reflect.DeepEqual(merged.Players, m.Players) || !reflect.DeepEqual(merged.Bodies, m.Bodies) {
+    t.Fatalf("parts don't add up to the sync")
+  }
+
+  if parts := (&SyncMsg{}).Split(); len(parts) != 1 || parts[0].Continued {
+    t.Fatalf("empty sync split into %d parts", len(parts))
+  }
+}
+
+// The samples split wherever cuts says and merged back by the decoder
+// come out whole and in order. Any other bytes must not panic it.
+func FuzzLinkDecoder(f *testing.F) {
+  f.Add([]byte{1}, []byte{})
+  f.Add([]byte{2, 3, 5, 7, 11, 13}, []byte{3, 0, 1, 2, 3})
+  f.Add([]byte{255, 0, 40}, []byte{0, 0})
+  f.Add([]byte{}, []byte{5, 0, 99, 1, 2, 3, 4})
+
+  want := sampleMsgs()
+  stream := encodeAll(f, want)
+
+  f.Fuzz(func(t *testing.T, cuts []byte, garbage []byte) {
+    d := NewLinkDecoder()
+    got := []LinkMsg{}
+    head := 0
+    for i := 0; head < len(stream); i++ {
+      n := len(stream) - head
+      if len(cuts) > 0 {
+        n = int(cuts[i % len(cuts)]) + 1
+      }
+      if head + n > len(stream) {
+        n = len(stream) - head
+      }
+      d.Feed(stream[head:head+n])
+      head += n
+      got = append(got, drain(t, d)...)
+    }
+    checkMsgs(t, got, want)
+
+    d = NewLinkDecoder()
+    d.Feed(garbage)
+    for {
+      m, err := d.Next()
+      if err == ErrBadFrame || (m == nil && err == nil) {
+        break
+      }
+    }
+  })
+}
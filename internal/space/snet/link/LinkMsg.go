@@ -0,0 +1,69 @@
+package link
+
+import(
+  "errors"
+  "encoding/binary"
+
+  "go-space-serv/internal/space/snet"
+)
+
+// Framed messages between WORLD and SIM, sent after the handshake.
+//
+// frame: length(2) cmd(1) body(length - 1)
+//
+// length counts the cmd byte and the body.
+
+const FRAME_HEADER_SIZE int = 2
+const MAX_FRAME_SIZE int = 65535
+
+var ErrShortBody = errors.New("link: message body too short")
+var ErrTooLarge = errors.New("link: message does not fit in a frame")
+
+type LinkMsg interface {
+  GetCmd() snet.InternalCmd
+  Serialize() []byte              // body only, without cmd
+  Deserialize(body []byte) error  // body only, without cmd
+}
+
+// Wraps a message in a frame ready to write to the link.
+// Messages longer than MAX_FRAME_SIZE must be split by the
+// sender, they are refused rather than cut short.
+func Encode(msg LinkMsg) ([]byte, error) {
+  body := msg.Serialize()
+  if 1 + len(body) > MAX_FRAME_SIZE {
+    return nil, ErrTooLarge
+  }
+  frame := make([]byte, FRAME_HEADER_SIZE + 1 + len(body))
+  binary.LittleEndian.PutUint16(frame[0:2], uint16(1 + len(body)))
+  frame[2] = byte(msg.GetCmd())
+  copy(frame[3:], body)
+  return frame, nil
+}
+
+func newMsg(cmd snet.InternalCmd) LinkMsg {
+  switch cmd {
+    case snet.IReady:
+      return &ReadyMsg{}
+    case snet.IJoin:
+      return &JoinMsg{}
+    case snet.ILeave:
+      return &LeaveMsg{}
+    case snet.ISpec:
+      return &SpecMsg{}
+    case snet.ISpawn:
+      return &SpawnMsg{}
+    case snet.IState:
+      return &StateMsg{}
+    case snet.IShutdown:
+      return &ShutdownMsg{}
+    case snet.ISync:
+      return &SyncMsg{}
+    case snet.IHandoff:
+      return &HandoffMsg{}
+    case snet.ILogLevel:
+      return &LogLevelMsg{}
+    case snet.ICamera:
+      return &CameraMsg{}
+  }
+  return nil
+}
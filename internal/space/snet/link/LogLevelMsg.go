@@ -0,0 +1,37 @@
+package link
+
+import(
+  "go-space-serv/internal/space/snet"
+)
+
+// WORLD -> SIM: change a log level, an empty Subsystem means all of them.
+//
+// body: len(1) subsystem(len) len(1) level(len)
+type LogLevelMsg struct {
+  Subsystem string
+  Level     string
+}
+
+func (msg *LogLevelMsg) GetCmd() snet.InternalCmd { return snet.ILogLevel }
+func (msg *LogLevelMsg) Serialize() []byte {
+  body := make([]byte, 0, 2 + len(msg.Subsystem) + len(msg.Level))
+  body = append(body, byte(len(msg.Subsystem)))
+  body = append(body, msg.Subsystem...)
+  body = append(body, byte(len(msg.Level)))
+  body = append(body, msg.Level...)
+  return body
+}
+func (msg *LogLevelMsg) Deserialize(body []byte) error {
+  if len(body) < 1 || len(body) < 2 + int(body[0]) {
+    return ErrShortBody
+  }
+  sysLen := int(body[0])
+  msg.Subsystem = string(body[1:1+sysLen])
+
+  rest := body[1+sysLen:]
+  if len(rest) < 1 + int(rest[0]) {
+    return ErrShortBody
+  }
+  msg.Level = string(rest[1:1+int(rest[0])])
+  return nil
+}
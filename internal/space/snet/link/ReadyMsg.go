@@ -0,0 +1,35 @@
+package link
+
+import(
+  "encoding/binary"
+  "go-space-serv/internal/space/snet"
+)
+
+// SIM -> WORLD: simulation is running, accepting udp on Port
+// and responsible for bodies inside Region.
+type ReadyMsg struct {
+  Port uint32
+  Region snet.Region
+}
+
+func (msg *ReadyMsg) GetCmd() snet.InternalCmd { return snet.IReady }
+func (msg *ReadyMsg) Serialize() []byte {
+  body := make([]byte, 20)
+  binary.LittleEndian.PutUint32(body[0:4], msg.Port)
+  binary.LittleEndian.PutUint32(body[4:8], msg.Region.MinX)
+  binary.LittleEndian.PutUint32(body[8:12], msg.Region.MinY)
+  binary.LittleEndian.PutUint32(body[12:16], msg.Region.MaxX)
+  binary.LittleEndian.PutUint32(body[16:20], msg.Region.MaxY)
+  return body
+}
+func (msg *ReadyMsg) Deserialize(body []byte) error {
+  if len(body) < 20 {
+    return ErrShortBody
+  }
+  msg.Port = binary.LittleEndian.Uint32(body[0:4])
+  msg.Region.MinX = binary.LittleEndian.Uint32(body[4:8])
+  msg.Region.MinY = binary.LittleEndian.Uint32(body[8:12])
+  msg.Region.MaxX = binary.LittleEndian.Uint32(body[12:16])
+  msg.Region.MaxY = binary.LittleEndian.Uint32(body[16:20])
+  return nil
+}
@@ -0,0 +1,12 @@
+package link
+
+import(
+  "go-space-serv/internal/space/snet"
+)
+
+// WORLD -> SIM: stop.
+type ShutdownMsg struct {}
+
+func (msg *ShutdownMsg) GetCmd() snet.InternalCmd { return snet.IShutdown }
+func (msg *ShutdownMsg) Serialize() []byte { return []byte{} }
+func (msg *ShutdownMsg) Deserialize(body []byte) error { return nil }
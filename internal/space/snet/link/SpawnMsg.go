@@ -0,0 +1,29 @@
+package link
+
+import(
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+)
+
+// SIM -> WORLD: player now controls body.
+type SpawnMsg struct {
+  BodyId uint16
+  PlayerId uuid.UUID
+}
+
+func (msg *SpawnMsg) GetCmd() snet.InternalCmd { return snet.ISpawn }
+func (msg *SpawnMsg) Serialize() []byte {
+  body := make([]byte, 18)
+  binary.LittleEndian.PutUint16(body[0:2], msg.BodyId)
+  copy(body[2:18], msg.PlayerId[0:])
+  return body
+}
+func (msg *SpawnMsg) Deserialize(body []byte) error {
+  if len(body) < 18 {
+    return ErrShortBody
+  }
+  msg.BodyId = binary.LittleEndian.Uint16(body[0:2])
+  copy(msg.PlayerId[0:], body[2:18])
+  return nil
+}
@@ -0,0 +1,25 @@
+package link
+
+import(
+  "encoding/binary"
+  "go-space-serv/internal/space/snet"
+)
+
+// SIM -> WORLD: body was removed, its player is spectating.
+type SpecMsg struct {
+  BodyId uint16
+}
+
+func (msg *SpecMsg) GetCmd() snet.InternalCmd { return snet.ISpec }
+func (msg *SpecMsg) Serialize() []byte {
+  body := make([]byte, 2)
+  binary.LittleEndian.PutUint16(body[0:2], msg.BodyId)
+  return body
+}
+func (msg *SpecMsg) Deserialize(body []byte) error {
+  if len(body) < 2 {
+    return ErrShortBody
+  }
+  msg.BodyId = binary.LittleEndian.Uint16(body[0:2])
+  return nil
+}
@@ -0,0 +1,64 @@
+package link
+
+import(
+  "errors"
+  "encoding/binary"
+  "go-space-serv/internal/space/snet"
+)
+
+const bodyStateSize int = 6
+
+// Most bodies that fit in one frame.
+const MAX_STATE_BODIES int = (MAX_FRAME_SIZE - 1) / bodyStateSize
+
+// Grid cell of a body.
+type BodyState struct {
+  Id uint16
+  X uint16
+  Y uint16
+}
+
+// SIM -> WORLD: where bodies are, sent every WORLD_RATE frames.
+type StateMsg struct {
+  Bodies []BodyState
+}
+
+// The same bodies in messages of at most MAX_STATE_BODIES.
+func (msg *StateMsg) Split() []*StateMsg {
+  parts := []*StateMsg{}
+  for start := 0; start < len(msg.Bodies); start += MAX_STATE_BODIES {
+    end := start + MAX_STATE_BODIES
+    if end > len(msg.Bodies) {
+      end = len(msg.Bodies)
+    }
+    parts = append(parts, &StateMsg{Bodies: msg.Bodies[start:end]})
+  }
+  return parts
+}
+
+func (msg *StateMsg) GetCmd() snet.InternalCmd { return snet.IState }
+func (msg *StateMsg) Serialize() []byte {
+  body := make([]byte, len(msg.Bodies) * bodyStateSize)
+  head := 0
+  for _, b := range msg.Bodies {
+    binary.LittleEndian.PutUint16(body[head:head+2], b.Id)
+    binary.LittleEndian.PutUint16(body[head+2:head+4], b.X)
+    binary.LittleEndian.PutUint16(body[head+4:head+6], b.Y)
+    head += bodyStateSize
+  }
+  return body
+}
+func (msg *StateMsg) Deserialize(body []byte) error {
+  if len(body) % bodyStateSize != 0 {
+    return errors.New("link: state body is not a whole number of bodies")
+  }
+  msg.Bodies = make([]BodyState, len(body) / bodyStateSize)
+  head := 0
+  for i := range msg.Bodies {
+    msg.Bodies[i].Id = binary.LittleEndian.Uint16(body[head:head+2])
+    msg.Bodies[i].X = binary.LittleEndian.Uint16(body[head+2:head+4])
+    msg.Bodies[i].Y = binary.LittleEndian.Uint16(body[head+4:head+6])
+    head += bodyStateSize
+  }
+  return nil
+}
@@ -0,0 +1,105 @@
+package link
+
+import(
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+)
+
+// A body and the player controlling it.
+type SyncBody struct {
+  BodyId uint16
+  PlayerId uuid.UUID
+}
+
+// SIM -> WORLD: everything SIM knows, sent before anything else
+// after ReadyMsg each time the link comes up so WORLD can catch up
+// on whatever happened while it was down. Too much for one frame
+// goes in several, each after the first marked Continued.
+//
+// body: continued(1) playerCount(2) playerId(16)... bodyCount(2) [bodyId(2) playerId(16)]...
+type SyncMsg struct {
+  Continued bool    // adds to the SyncMsg before it instead of replacing what WORLD knows
+  Players []uuid.UUID
+  Bodies []SyncBody
+}
+
+const syncHeaderSize int = 1 + 2 + 2
+const syncPlayerSize int = 16
+const syncBodySize int = 18
+
+// The same players and bodies in as few messages as fit in frames.
+func (msg *SyncMsg) Split() []*SyncMsg {
+  room := MAX_FRAME_SIZE - 1 - syncHeaderSize
+  part := &SyncMsg{Continued: msg.Continued}
+  parts := []*SyncMsg{part}
+  size := 0
+  next := func(n int) {
+    if size + n > room {
+      part = &SyncMsg{Continued: true}
+      parts = append(parts, part)
+      size = 0
+    }
+    size += n
+  }
+
+  for _, id := range msg.Players {
+    next(syncPlayerSize)
+    part.Players = append(part.Players, id)
+  }
+  for _, b := range msg.Bodies {
+    next(syncBodySize)
+    part.Bodies = append(part.Bodies, b)
+  }
+  return parts
+}
+
+func (msg *SyncMsg) GetCmd() snet.InternalCmd { return snet.ISync }
+func (msg *SyncMsg) Serialize() []byte {
+  body := make([]byte, 3, syncHeaderSize + len(msg.Players) * syncPlayerSize + len(msg.Bodies) * syncBodySize)
+  if msg.Continued {
+    body[0] = 1
+  }
+  binary.LittleEndian.PutUint16(body[1:3], uint16(len(msg.Players)))
+  for _, id := range msg.Players {
+    body = append(body, id[0:]...)
+  }
+
+  body = append(body, 0, 0)
+  binary.LittleEndian.PutUint16(body[len(body)-2:], uint16(len(msg.Bodies)))
+  for _, b := range msg.Bodies {
+    body = append(body, 0, 0)
+    binary.LittleEndian.PutUint16(body[len(body)-2:], b.BodyId)
+    body = append(body, b.PlayerId[0:]...)
+  }
+  return body
+}
+func (msg *SyncMsg) Deserialize(body []byte) error {
+  if len(body) < 3 {
+    return ErrShortBody
+  }
+  msg.Continued = body[0] != 0
+  count := int(binary.LittleEndian.Uint16(body[1:3]))
+  head := 3
+  if len(body) < head + count * syncPlayerSize + 2 {
+    return ErrShortBody
+  }
+  msg.Players = make([]uuid.UUID, count)
+  for i := range msg.Players {
+    copy(msg.Players[i][0:], body[head:head+16])
+    head += syncPlayerSize
+  }
+
+  count = int(binary.LittleEndian.Uint16(body[head:head+2]))
+  head += 2
+  if len(body) < head + count * syncBodySize {
+    return ErrShortBody
+  }
+  msg.Bodies = make([]SyncBody, count)
+  for i := range msg.Bodies {
+    msg.Bodies[i].BodyId = binary.LittleEndian.Uint16(body[head:head+2])
+    copy(msg.Bodies[i].PlayerId[0:], body[head+2:head+18])
+    head += syncBodySize
+  }
+  return nil
+}
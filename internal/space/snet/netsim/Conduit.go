@@ -0,0 +1,49 @@
+package netsim
+
+import(
+  "net"
+  "time"
+
+  "go-space-serv/internal/space/snet/transport"
+)
+
+// Puts a transport behind the network. Delayed packets are copied,
+// the caller may reuse buf as soon as Send returns. Errors from
+// the wrapped transport are only seen for packets sent right away.
+type Conduit struct {
+  next    transport.Transport
+  network *Network
+}
+
+func (n *Network) Wrap(next transport.Transport) *Conduit {
+  return &Conduit{next: next, network: n}
+}
+
+func (c *Conduit) RemoteAddr() net.Addr {
+  return c.next.RemoteAddr()
+}
+
+func (c *Conduit) Send(buf []byte) error {
+  delays := c.network.fate()
+  if len(delays) == 0 {
+    return nil
+  }
+
+  var err error
+  var packet []byte
+  for _, d := range delays {
+    if d <= 0 {
+      err = c.next.Send(buf)
+      continue
+    }
+
+    if packet == nil {
+      packet = append([]byte{}, buf...)
+    }
+    p := packet
+    time.AfterFunc(d, func() {
+      c.next.Send(p)
+    })
+  }
+  return err
+}
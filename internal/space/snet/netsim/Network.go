@@ -0,0 +1,102 @@
+package netsim
+
+import(
+  "fmt"
+  "sync"
+  "time"
+  "math/rand"
+)
+
+// A bad network to put packets through, for testing what a
+// connection does under latency, jitter, loss, duplication and
+// reordering. What happens to each packet is drawn from one seeded
+// source, so the same seed and the same packets in the same order
+// always get the same treatment.
+type Conditions struct {
+  Latency       time.Duration   // added to every packet
+  Jitter        time.Duration   // up to this much more, at random
+  Loss          float64         // chance a packet is dropped, 0 to 1
+  Duplicate     float64         // chance a packet is sent twice
+  Reorder       float64         // chance a packet is held back ReorderDelay
+  ReorderDelay  time.Duration   // so later packets overtake it
+}
+
+// True when packets go through untouched.
+func (c Conditions) Clean() bool {
+  return c.Latency == 0 && c.Jitter == 0 && c.Loss == 0 && c.Duplicate == 0 && c.Reorder == 0
+}
+
+func (c Conditions) String() string {
+  return fmt.Sprintf("latency %s jitter %s loss %.1f%% duplicate %.1f%% reorder %.1f%% by %s",
+    c.Latency, c.Jitter, c.Loss * 100, c.Duplicate * 100, c.Reorder * 100, c.ReorderDelay)
+}
+
+// What the network did so far.
+type Stats struct {
+  Sent        uint64
+  Dropped     uint64
+  Duplicated  uint64
+  Reordered   uint64
+}
+
+type Network struct {
+  conditions  Conditions
+
+  lock        sync.Mutex
+  rng         *rand.Rand
+  stats       Stats
+}
+
+func New(c Conditions, seed int64) *Network {
+  if c.Reorder > 0 && c.ReorderDelay == 0 {
+    c.ReorderDelay = c.Latency + c.Jitter + 10 * time.Millisecond
+  }
+
+  var n Network
+  n.conditions = c
+  n.rng = rand.New(rand.NewSource(seed))
+  return &n
+}
+
+func (n *Network) Conditions() Conditions {
+  return n.conditions
+}
+
+func (n *Network) Stats() Stats {
+  n.lock.Lock()
+  defer n.lock.Unlock()
+  return n.stats
+}
+
+// Delays for each copy of a packet that gets through, none if it's lost.
+func (n *Network) fate() []time.Duration {
+  c := n.conditions
+
+  n.lock.Lock()
+  defer n.lock.Unlock()
+
+  n.stats.Sent++
+  if c.Loss > 0 && n.rng.Float64() < c.Loss {
+    n.stats.Dropped++
+    return nil
+  }
+
+  copies := 1
+  if c.Duplicate > 0 && n.rng.Float64() < c.Duplicate {
+    n.stats.Duplicated++
+    copies = 2
+  }
+
+  delays := make([]time.Duration, copies)
+  for i := range delays {
+    delays[i] = c.Latency
+    if c.Jitter > 0 {
+      delays[i] += time.Duration(n.rng.Int63n(int64(c.Jitter) + 1))
+    }
+    if c.Reorder > 0 && n.rng.Float64() < c.Reorder {
+      n.stats.Reordered++
+      delays[i] += c.ReorderDelay
+    }
+  }
+  return delays
+}
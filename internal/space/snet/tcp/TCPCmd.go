@@ -13,4 +13,10 @@ const (
   JOIN
   LEAVE
   BLOCKS
+  SIM_LOST
+  SHUTDOWN
+  BROADCAST
+  CHAT
+  PLAYER_UPDATE
+  LOGIN
 )
@@ -0,0 +1,37 @@
+package tcp
+
+import(
+  "go-space-serv/internal/space/metrics"
+)
+
+// Shared by every TCPPlayer on WORLD.
+// A nil *TCPMetrics records nothing.
+type TCPMetrics struct {
+  MessagesOut *metrics.Counter
+  WritesOut   *metrics.Counter
+  BytesIn     *metrics.Counter
+  BytesOut    *metrics.Counter
+}
+
+func NewTCPMetrics(r *metrics.Registry) *TCPMetrics {
+  var m TCPMetrics
+  m.MessagesOut = r.Counter("space_tcp_messages_out_total", "TCP messages sent to clients.")
+  m.WritesOut = r.Counter("space_tcp_writes_out_total", "TCP writes to clients, each holding one or more messages.")
+  m.BytesIn = r.Counter("space_tcp_bytes_in_total", "TCP bytes received from clients.")
+  m.BytesOut = r.Counter("space_tcp_bytes_out_total", "TCP bytes sent to clients.")
+  return &m
+}
+
+func (m *TCPMetrics) Received(n int) {
+  if m != nil {
+    m.BytesIn.Add(uint64(n))
+  }
+}
+
+func (m *TCPMetrics) sent(msgs, n int) {
+  if m != nil {
+    m.MessagesOut.Add(uint64(msgs))
+    m.WritesOut.Inc()
+    m.BytesOut.Add(uint64(n))
+  }
+}
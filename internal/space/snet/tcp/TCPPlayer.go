@@ -2,10 +2,13 @@ package tcp
 
 import (
   "time"
-  "log"
+  "errors"
+  "log/slog"
   "encoding/binary"
   "github.com/google/uuid"
-  "github.com/panjf2000/gnet"
+
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/util"
 )
 
 type TCPPlayerState byte
@@ -16,25 +19,49 @@ const (
   CONNECTED
 )
 
+func (s TCPPlayerState) String() string {
+  switch s {
+    case DISCONNECTED:
+      return "DISCONNECTED"
+    case AUTH:
+      return "AUTH"
+    case CONNECTED:
+      return "CONNECTED"
+  }
+  return "UNKNOWN"
+}
+
 const PacketSize int = 1024
 
+// The client sent a frame length we can't follow, nothing
+// after it can be read.
+var ErrBadFrame = errors.New("tcp: bad frame length")
+
+var logger = helpers.Logger("tcp")
+
 type TCPPlayer struct {
   Id              uuid.UUID
   Outgoing  chan  TCPMsg
 
   incoming  chan  TCPMsg
-  connection      gnet.Conn
+  connection      transport.Transport
   factory         TCPMsgFactory
   state           TCPPlayerState
+  metrics         *TCPMetrics
+  log             *slog.Logger
+  rxBuf           []byte      // part of a frame still being received
 }
 
-func NewPlayer(conn gnet.Conn, id uuid.UUID, factory TCPMsgFactory) *TCPPlayer {
+func NewPlayer(in chan TCPMsg, conn transport.Transport, id uuid.UUID, factory TCPMsgFactory, m *TCPMetrics) *TCPPlayer {
   var p TCPPlayer
   p.Outgoing = make(chan TCPMsg, 100)
-  p.incoming = make(chan TCPMsg, 100)
+  p.incoming = in
   p.connection = conn
+  p.factory = factory
   p.state = DISCONNECTED
   p.Id = id
+  p.metrics = m
+  p.log = logger.With("player", id)
 
   return &p
 }
@@ -52,7 +79,7 @@ func (p *TCPPlayer) Tx() {
 
   for {
     if p.state == DISCONNECTED {
-      log.Printf("disconnected")
+      p.log.Debug("tx stopped, disconnected")
       break
     }
     var m TCPMsg
@@ -64,7 +91,8 @@ func (p *TCPPlayer) Tx() {
     if head > 2 {
       toSend := packet
       binary.LittleEndian.PutUint16(packet[0:2], uint16(head - 2))
-      p.connection.AsyncWrite(toSend[:head])
+      p.connection.Send(toSend[:head])
+      p.metrics.sent(1, head)
       head = 2
       packet = make([]byte, PacketSize)
     }
@@ -73,12 +101,72 @@ func (p *TCPPlayer) Tx() {
   }
 }
 
-func (p *TCPPlayer) Rx() {}
+// Writes m in a frame of its own now, ahead of anything queued
+// on Outgoing, e.g. a PING that shouldn't measure the queue.
+func (p *TCPPlayer) SendNow(m TCPMsg) error {
+  frame := make([]byte, PacketSize)
+  head := m.Serialize(frame, 2)
+  binary.LittleEndian.PutUint16(frame[0:2], uint16(head - 2))
+  if err := p.connection.Send(frame[:head]); err != nil {
+    return err
+  }
+  p.metrics.sent(1, head)
+  return nil
+}
+
+// Client -> WORLD, framed the same way as what we send:
+//
+// frame: length(2) msg(length)
+//
+// Takes bytes as tcp delivers them, split or merged arbitrarily,
+// and publishes each whole message on incoming. ErrBadFrame
+// means the connection should be closed.
+func (p *TCPPlayer) Rx(data []byte) error {
+  p.rxBuf = append(p.rxBuf, data...)
+  for len(p.rxBuf) >= 2 {
+    length := int(binary.LittleEndian.Uint16(p.rxBuf[0:2]))
+    if length == 0 || length > PacketSize - 2 {
+      return ErrBadFrame
+    }
+    if len(p.rxBuf) < 2 + length {
+      break
+    }
+
+    p.publish(p.rxBuf[2:2+length])
+    remaining := copy(p.rxBuf, p.rxBuf[2+length:])
+    p.rxBuf = p.rxBuf[:remaining]
+  }
+  return nil
+}
+
+// Messages never keep references into frame, rxBuf is reused.
+func (p *TCPPlayer) publish(frame []byte) {
+  defer func() {
+    if recover() != nil {
+      p.log.Debug("dropped frame with a message cut short")
+    }
+  }()
+
+  head := 0
+  for head < len(frame) {
+    next := p.factory.CreateAndPublishMsg(frame, head, p.incoming, p.Id)
+    if next <= head {
+      p.log.Debug("dropped frame with unknown cmd", "cmd", frame[head])
+      return
+    }
+    head = next
+  }
+}
+
+// Messages queued but not yet written.
+func (p *TCPPlayer) Pending() int {
+  return len(p.Outgoing)
+}
 
 func (p *TCPPlayer) GetState() TCPPlayerState {
   return p.state
 }
 
-func (p *TCPPlayer) GetConnection() gnet.Conn {
+func (p *TCPPlayer) GetConnection() transport.Transport {
   return p.connection
 }
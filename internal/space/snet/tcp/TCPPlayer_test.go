@@ -0,0 +1,165 @@
+package tcp
+
+import(
+  "errors"
+  "testing"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet/transport"
+)
+
+const valueCmd TCPCmd = 0x7e
+
+// cmd(1) value(1)
+type valueMsg struct {
+  value byte
+}
+
+func (m *valueMsg) GetCmd() TCPCmd { return valueCmd }
+func (m *valueMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(valueCmd)
+  packet[head+1] = m.value
+  return head + 2
+}
+func (m *valueMsg) Deserialize(packet []byte, head int) int {
+  m.value = packet[head+1]
+  return head + 2
+}
+
+type valueFactory struct {}
+
+func (f *valueFactory) CreateAndPublishMsg(packet []byte, head int, out chan TCPMsg, id uuid.UUID) int {
+  if TCPCmd(packet[head]) != valueCmd {
+    return head
+  }
+  m := &valueMsg{}
+  head = m.Deserialize(packet, head)
+  out <- m
+  return head
+}
+
+func newTestPlayer(conn transport.Transport) (*TCPPlayer, chan TCPMsg) {
+  in := make(chan TCPMsg, 100)
+  return NewPlayer(in, conn, uuid.New(), &valueFactory{}, nil), in
+}
+
+func frame(values ...byte) []byte {
+  f := make([]byte, 2)
+  binary.LittleEndian.PutUint16(f, uint16(2 * len(values)))
+  for _, v := range values {
+    f = append(f, byte(valueCmd), v)
+  }
+  return f
+}
+
+func received(in chan TCPMsg) []byte {
+  values := []byte{}
+  for {
+    select {
+      case m := <-in:
+        values = append(values, m.(*valueMsg).value)
+      default:
+        return values
+    }
+  }
+}
+
+func checkValues(t *testing.T, got, want []byte) {
+  if string(got) != string(want) {
+    t.Fatalf("got %v, want %v", got, want)
+  }
+}
+
+// However tcp cuts the stream, every message comes out once, in order.
+func TestRxSplitFrames(t *testing.T) {
+  stream := append(frame(1), frame(2, 3)...)
+  stream = append(stream, frame(4)...)
+  want := []byte{1, 2, 3, 4}
+
+  for size := 1; size <= len(stream); size++ {
+    p, in := newTestPlayer(nil)
+    for head := 0; head < len(stream); head += size {
+      tail := head + size
+      if tail > len(stream) {
+        tail = len(stream)
+      }
+      if err := p.Rx(stream[head:tail]); err != nil {
+        t.Fatalf("cut every %d bytes: %s", size, err)
+      }
+    }
+    checkValues(t, received(in), want)
+  }
+}
+
+func TestRxBadFrame(t *testing.T) {
+  tooLong := make([]byte, 2)
+  binary.LittleEndian.PutUint16(tooLong, uint16(PacketSize - 1))
+
+  for _, bad := range [][]byte{{0, 0}, tooLong} {
+    p, in := newTestPlayer(nil)
+    if err := p.Rx(frame(9)); err != nil {
+      t.Fatalf("good frame: %s", err)
+    }
+    // the length may arrive a byte at a time
+    if err := p.Rx(bad[:1]); err != nil {
+      t.Fatalf("half a length: %s", err)
+    }
+    if err := p.Rx(bad[1:]); !errors.Is(err, ErrBadFrame) {
+      t.Fatalf("length %v: got %v, want ErrBadFrame", bad, err)
+    }
+    checkValues(t, received(in), []byte{9})
+  }
+}
+
+// What Tx writes, Rx reads back.
+func TestTxToRxOverPipe(t *testing.T) {
+  a, b := transport.Pipe("world", "client")
+  defer a.Close()
+
+  sender, _ := newTestPlayer(a)
+  sender.Connected()
+  want := []byte{5, 6, 7}
+  for _, v := range want {
+    sender.Outgoing <- &valueMsg{value: v}
+  }
+
+  receiver, in := newTestPlayer(b)
+  got := []byte{}
+  for len(got) < len(want) {
+    packet, err := b.Recv()
+    if err != nil {
+      t.Fatalf("recv: %s", err)
+    }
+    if err := receiver.Rx(packet); err != nil {
+      t.Fatalf("rx: %s", err)
+    }
+    got = append(got, received(in)...)
+  }
+  checkValues(t, got, want)
+}
+
+// SendNow writes its message in a frame of its own
+// while everything on Outgoing waits.
+func TestSendNowSkipsQueue(t *testing.T) {
+  a, b := transport.Pipe("world", "client")
+  defer a.Close()
+
+  sender, _ := newTestPlayer(a)
+  sender.Outgoing <- &valueMsg{value: 1}
+  if err := sender.SendNow(&valueMsg{value: 9}); err != nil {
+    t.Fatal(err)
+  }
+
+  packet, err := b.Recv()
+  if err != nil {
+    t.Fatalf("recv: %s", err)
+  }
+  if string(packet) != string(frame(9)) {
+    t.Fatalf("got %v, want %v", packet, frame(9))
+  }
+  if sender.Pending() != 1 {
+    t.Fatalf("queue has %d, want 1", sender.Pending())
+  }
+}
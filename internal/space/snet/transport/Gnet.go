@@ -0,0 +1,36 @@
+package transport
+
+import(
+  "net"
+
+  "github.com/panjf2000/gnet"
+)
+
+// A gnet udp connection, sends with SendTo.
+type GnetUDP struct {
+  Conn gnet.Conn
+}
+
+func (t GnetUDP) Send(buf []byte) error {
+  return t.Conn.SendTo(buf)
+}
+
+func (t GnetUDP) RemoteAddr() net.Addr {
+  return t.Conn.RemoteAddr()
+}
+
+// A gnet tcp connection, writes with AsyncWrite so it
+// can be used from outside the event loop.
+type GnetTCP struct {
+  Conn gnet.Conn
+}
+
+// AsyncWrite keeps buf until the event loop gets to
+// it, by then the caller may have reused it.
+func (t GnetTCP) Send(buf []byte) error {
+  return t.Conn.AsyncWrite(append([]byte{}, buf...))
+}
+
+func (t GnetTCP) RemoteAddr() net.Addr {
+  return t.Conn.RemoteAddr()
+}
@@ -0,0 +1,52 @@
+package transport
+
+import(
+  "net"
+  "sync"
+)
+
+// One peer of a udp socket from the net package. With a nil Addr
+// the socket must be connected, e.g. from net.DialUDP.
+type UDP struct {
+  Conn  *net.UDPConn
+  Addr  *net.UDPAddr
+}
+
+func (t UDP) Send(buf []byte) error {
+  var err error
+  if t.Addr == nil {
+    _, err = t.Conn.Write(buf)
+  } else {
+    _, err = t.Conn.WriteToUDP(buf, t.Addr)
+  }
+  return err
+}
+
+func (t UDP) RemoteAddr() net.Addr {
+  if t.Addr == nil {
+    return t.Conn.RemoteAddr()
+  }
+  return t.Addr
+}
+
+// A tcp connection from the net package. Sends are serialized
+// so frames from different goroutines don't interleave.
+type TCP struct {
+  Conn  *net.TCPConn
+  lock  sync.Mutex
+}
+
+func NewTCP(conn *net.TCPConn) *TCP {
+  return &TCP{Conn: conn}
+}
+
+func (t *TCP) Send(buf []byte) error {
+  t.lock.Lock()
+  defer t.lock.Unlock()
+  _, err := t.Conn.Write(buf)
+  return err
+}
+
+func (t *TCP) RemoteAddr() net.Addr {
+  return t.Conn.RemoteAddr()
+}
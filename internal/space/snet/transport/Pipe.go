@@ -0,0 +1,107 @@
+package transport
+
+import(
+  "net"
+  "sync"
+  "errors"
+)
+
+var ErrPipeClosed = errors.New("transport: pipe closed")
+
+const pipeBuffer int = 256
+
+// Both ends of an in-memory connection, for running players
+// and clients in one process. What one end sends the other
+// receives whole, in order. Like a udp socket, sending to a
+// full end drops the packet rather than waiting.
+func Pipe(a, b string) (*PipeEnd, *PipeEnd) {
+  closed := make(chan struct{})
+  shared := &pipe{closed: closed}
+  ea := &PipeEnd{pipe: shared, addr: pipeAddr(a), packets: make(chan []byte, pipeBuffer)}
+  eb := &PipeEnd{pipe: shared, addr: pipeAddr(b), packets: make(chan []byte, pipeBuffer)}
+  ea.peer = eb
+  eb.peer = ea
+  return ea, eb
+}
+
+type pipe struct {
+  closed    chan struct{}
+  closeOnce sync.Once
+}
+
+type PipeEnd struct {
+  *pipe
+  addr      pipeAddr
+  peer      *PipeEnd
+  packets   chan []byte
+
+  lock      sync.Mutex
+  dropped   int
+}
+
+func (e *PipeEnd) Send(buf []byte) error {
+  select {
+    case <-e.closed:
+      return ErrPipeClosed
+    default:
+  }
+
+  select {
+    case e.peer.packets <- append([]byte{}, buf...):
+    default:
+      e.lock.Lock()
+      e.dropped++
+      e.lock.Unlock()
+  }
+  return nil
+}
+
+// Address of the other end, as a socket would report it.
+func (e *PipeEnd) RemoteAddr() net.Addr {
+  return e.peer.addr
+}
+
+func (e *PipeEnd) LocalAddr() net.Addr {
+  return e.addr
+}
+
+// Next packet sent from the other end, waiting for one.
+func (e *PipeEnd) Recv() ([]byte, error) {
+  select {
+    case p := <-e.packets:
+      return p, nil
+    case <-e.closed:
+      // still hand out what arrived before
+      select {
+        case p := <-e.packets:
+          return p, nil
+        default:
+          return nil, ErrPipeClosed
+      }
+  }
+}
+
+// Packets this end sent that the other end had no room for.
+func (e *PipeEnd) Dropped() int {
+  e.lock.Lock()
+  defer e.lock.Unlock()
+  return e.dropped
+}
+
+// Closes both ends.
+func (e *PipeEnd) Close() error {
+  e.closeOnce.Do(func() {
+    close(e.closed)
+  })
+  return nil
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+  return "pipe"
+}
+
+func (a pipeAddr) String() string {
+  return string(a)
+}
@@ -0,0 +1,13 @@
+package transport
+
+import(
+  "net"
+)
+
+// The other end of a player's connection, all UDPPlayer and TCPPlayer
+// need of a socket. Send takes one datagram, or for tcp one or more
+// whole frames, and doesn't keep buf once it returns.
+type Transport interface {
+  Send(buf []byte) error
+  RemoteAddr() net.Addr
+}
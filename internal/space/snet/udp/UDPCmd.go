@@ -13,5 +13,7 @@ const (
   ENTER
   EXIT
   MOVESHOOT
+  SPECTATE
+  STATE
 )
 
@@ -0,0 +1,46 @@
+package udp
+
+import(
+  "go-space-serv/internal/space/metrics"
+)
+
+// Shared by every UDPPlayer on a SIM.
+// A nil *UDPMetrics records nothing.
+type UDPMetrics struct {
+  PacketsIn   *metrics.Counter
+  PacketsOut  *metrics.Counter
+  BytesIn     *metrics.Counter
+  BytesOut    *metrics.Counter
+  Rtt         *metrics.Histogram
+}
+
+func NewUDPMetrics(r *metrics.Registry) *UDPMetrics {
+  var m UDPMetrics
+  m.PacketsIn = r.Counter("space_udp_packets_in_total", "UDP packets received from clients.")
+  m.PacketsOut = r.Counter("space_udp_packets_out_total", "UDP packets sent to clients.")
+  m.BytesIn = r.Counter("space_udp_bytes_in_total", "UDP bytes received from clients.")
+  m.BytesOut = r.Counter("space_udp_bytes_out_total", "UDP bytes sent to clients.")
+  m.Rtt = r.Histogram("space_udp_rtt_seconds", "Time from sending a packet to its ack.",
+    []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5})
+  return &m
+}
+
+func (m *UDPMetrics) Received(n int) {
+  if m != nil {
+    m.PacketsIn.Inc()
+    m.BytesIn.Add(uint64(n))
+  }
+}
+
+func (m *UDPMetrics) sent(n int) {
+  if m != nil {
+    m.PacketsOut.Inc()
+    m.BytesOut.Add(uint64(n))
+  }
+}
+
+func (m *UDPMetrics) acked(rttMillis int64) {
+  if m != nil {
+    m.Rtt.Observe(float64(rttMillis) / 1000)
+  }
+}
@@ -1,16 +1,17 @@
 package udp
 
 import (
-  "log"
   "math"
   "math/rand"
+  "sync"
   "time"
+  "log/slog"
   "encoding/binary"
 
-  "github.com/panjf2000/gnet"
   "github.com/google/uuid"
 
   "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/transport"
   "go-space-serv/internal/space/util"
 )
 
@@ -26,6 +27,9 @@ const (
 
 const BUFFER_SIZE uint16 = 1024
 const SHUTUP_TIME int    = 10
+const DISCONNECT_COUNT int = 3
+
+var logger = helpers.Logger("udp")
 
 type PacketData struct {
   Acked     bool
@@ -39,10 +43,13 @@ type UDPPlayer struct {
 
   incoming    chan  UDPMsg
   state             UDPPlayerState
-  connection        gnet.Conn
+  connection        transport.Transport
   msgFactory        UDPMsgFactory
+  metrics           *UDPMetrics
+  log               *slog.Logger
 
   spamChan          chan struct{}
+  spamLock          sync.Mutex    // Unpack runs on pool goroutines
   active            bool
   lastSync          int64
 
@@ -63,9 +70,10 @@ type UDPPlayer struct {
   packetBuffer      []byte
   packetBufferTail  int
   packetBufferEmpty bool
+  held              UDPMsg    // didn't fit until more is acked
 }
 
-func NewPlayer(in chan UDPMsg, id uuid.UUID, factory UDPMsgFactory) *UDPPlayer {
+func NewPlayer(in chan UDPMsg, id uuid.UUID, factory UDPMsgFactory, m *UDPMetrics) *UDPPlayer {
   var p UDPPlayer
   p.active = false
   p.state = DISCONNECTED
@@ -83,6 +91,8 @@ func NewPlayer(in chan UDPMsg, id uuid.UUID, factory UDPMsgFactory) *UDPPlayer {
   p.Outgoing = make(chan UDPMsg, 100)
   p.Id = id
   p.msgFactory = factory
+  p.metrics = m
+  p.log = logger.With("player", id)
 
   p.seqBuffer = make([]uint32, BUFFER_SIZE)
   p.packetData = make([]PacketData, BUFFER_SIZE)
@@ -111,12 +121,24 @@ func (p *UDPPlayer) onPacketAcked(seq uint16) {
   if p.seqBuffer[idx] == uint32(seq) {
     p.packetData[idx].Acked = true
     p.seqBuffer[idx] = math.MaxUint32
+    p.metrics.acked(helpers.NowMillis() - p.packetData[idx].SendTime)
   }
 
   // TODO: calculate exponential moving average RTT
 }
 
+func (p *UDPPlayer) send(msg []byte) {
+  p.connection.Send(msg)
+  p.metrics.sent(len(msg))
+}
+
 func (p *UDPPlayer) getMsg() UDPMsg {
+  if p.held != nil {
+    tmp := p.held
+    p.held = nil
+    return tmp
+  }
+
   var tmp UDPMsg
   select {
   case tmp = <-p.Outgoing:
@@ -127,41 +149,54 @@ func (p *UDPPlayer) getMsg() UDPMsg {
   return tmp
 }
 
-// Sends a packet every rate milliseconds count times
+// Sends a packet now and then every rate milliseconds count times,
+// until the next sendRepeating or stopRepeating.
 func (p *UDPPlayer) sendRepeating(msg []byte, rate, count int) {
-  if p.spamChan != nil {
-    close(p.spamChan)
-  }
-
-  ticker := time.NewTicker(time.Duration(rate) * time.Millisecond)
-  defer ticker.Stop()
-
-  log.Printf("sending first %d", msg[4])
-  p.connection.SendTo(msg)
-
   // Use a local reference to the chan
   // for the case where it was closed
-  // and re-opened during Sleep
+  // and re-opened while waiting
   thisChan := make(chan struct{})
+  p.spamLock.Lock()
+  p.closeSpamChan()
   p.spamChan = thisChan
+  p.spamLock.Unlock()
+
+  p.log.Debug("sending", "cmd", msg[4])
+  p.send(msg)
 
   go func() {
+    ticker := time.NewTicker(time.Duration(rate) * time.Millisecond)
+    defer ticker.Stop()
+
     for i := 0; i < count; i++ {
-      _, open := <-thisChan
-      if !open {
-        return
+      select {
+        case <-thisChan:
+          return
+        case <-ticker.C:
       }
 
-      log.Printf("sending %d (iteration %d)", msg[4], i)
-      p.connection.SendTo(msg)
-      <- ticker.C
+      p.log.Debug("resending", "cmd", msg[4], "iteration", i)
+      p.send(msg)
     }
 
-    log.Printf("Player.sendRepeating finished all iterations.")
-    close(thisChan)
+    p.log.Debug("stopped resending", "cmd", msg[4])
   }()
 }
 
+func (p *UDPPlayer) stopRepeating() {
+  p.spamLock.Lock()
+  p.closeSpamChan()
+  p.spamLock.Unlock()
+}
+
+// Callers hold spamLock.
+func (p *UDPPlayer) closeSpamChan() {
+  if p.spamChan != nil {
+    close(p.spamChan)
+    p.spamChan = nil
+  }
+}
+
 func (p *UDPPlayer) Unpack(packet []byte) {
   head := 8
   tail := 0
@@ -172,6 +207,9 @@ func (p *UDPPlayer) Unpack(packet []byte) {
     return
   }
 
+  // the client has our WELCOME
+  p.stopRepeating()
+
   // handle seq/ack
   head += 2
   seq := snet.Read_uint16(packet[tail:head])
@@ -182,7 +220,7 @@ func (p *UDPPlayer) Unpack(packet []byte) {
 
   if seqGreaterThan(ack, p.txAck) {
     p.txAck = ack
-    p.onPacketAcked(seq)
+    p.onPacketAcked(ack)
   }
 
   if (head < msgLen) {
@@ -207,6 +245,9 @@ func (p *UDPPlayer) Unpack(packet []byte) {
 
 func (p *UDPPlayer) PackAndSend() {
   numMsgs := len(p.Outgoing)
+  if p.held != nil {
+    numMsgs++
+  }
 
   shouldStop := numMsgs == 0
   shouldStop = shouldStop && p.txSeq == p.txAck
@@ -222,10 +263,10 @@ func (p *UDPPlayer) PackAndSend() {
   header.ProtocolId = helpers.GetProtocolId()
   header.Salt = p.clientSalt ^ p.serverSalt
   header.Ack = p.rxSeq
+  header.Seq = p.txSeq
 
   // Client has acknowledged all our messages
   if numMsgs == 0 && p.txSeq == p.txAck {
-    header.Seq = p.txSeq
     var pd PacketData
     pd.Acked = false
     pd.SendTime = helpers.NowMillis()
@@ -235,15 +276,16 @@ func (p *UDPPlayer) PackAndSend() {
     p.packetBufferEmpty = true
     p.shutupTx++
     header.Serialize(p.packetBuffer)
-    p.connection.SendTo(p.packetBuffer[:HEADER_SIZE+1])
+    p.send(p.packetBuffer[:HEADER_SIZE+1])
     return
   } else {
     p.shutupTx = 0
   }
 
-  // Move the tail based on newest ack
+  // Move the tail based on newest ack, everything the
+  // client hasn't acked yet goes out again behind the new messages
   p.packetBufferTail = HEADER_SIZE
-  for i := p.txSeq; i < p.txAck; i-- {
+  for i := p.txSeq; i != p.txAck; i-- {
     pd := p.getPacketData(i)
     p.packetBufferTail += int(pd.Size)
   }
@@ -257,8 +299,10 @@ func (p *UDPPlayer) PackAndSend() {
     msg := tmp.(UDPMsg)
     msgSize := msg.GetSize()
     if p.packetBufferTail + msgSize >= int(BUFFER_SIZE) {
-      p.Outgoing <- msg
-      log.Printf("%v packetBuffer overflow.", p.Id)
+      // waits for acks, sending it anyway would lose older ones
+      p.held = msg
+      p.log.Warn("packet buffer overflow")
+      break
     }
 
     if !p.packetBufferEmpty {
@@ -277,27 +321,28 @@ func (p *UDPPlayer) PackAndSend() {
     pd.Acked = false
     pd.SendTime = helpers.NowMillis()
     pd.Size = int32(msgSize)
+    p.insertPacketData(pd, p.txSeq)
 
     msg = nil
   }
 
   header.Serialize(p.packetBuffer)
-  p.connection.SendTo(p.packetBuffer[:p.packetBufferTail])
+  p.send(p.packetBuffer[:p.packetBufferTail])
 }
 
 // TODO: add sequence to this
-func (p *UDPPlayer) AuthenticateConnection(bytes []byte, conn gnet.Conn) bool {
+func (p *UDPPlayer) AuthenticateConnection(bytes []byte, conn transport.Transport) bool {
   // Respond to HELLO with CHALLENGE
   if p.state == DISCONNECTED {
     // enforce padding to avoid participating in DDoS minification
     if len(bytes) != helpers.GetConfig().MAX_MSG_SIZE {
-      log.Printf("Rejecting packet due to lack of padding.")
+      p.log.Debug("rejecting packet without padding", "size", len(bytes))
       return false
     }
 
     cmd := UDPCmd(bytes[4])
     if cmd == HELLO {
-      log.Printf("Received HELLO");
+      p.log.Debug("hello")
       p.clientSalt = snet.Read_int64(bytes[5:13])
       p.serverSalt = rand.Int63()
       p.connection = conn
@@ -317,7 +362,7 @@ func (p *UDPPlayer) AuthenticateConnection(bytes []byte, conn gnet.Conn) bool {
   if p.state == CHALLENGED {
     // enforce padding to avoid participating in DDoS minification
     if len(bytes) != helpers.GetConfig().MAX_MSG_SIZE {
-      log.Printf("Rejecting packet due to lack of padding.")
+      p.log.Debug("rejecting packet without padding", "size", len(bytes))
       return false
     }
 
@@ -326,7 +371,7 @@ func (p *UDPPlayer) AuthenticateConnection(bytes []byte, conn gnet.Conn) bool {
       challengeResponse := snet.Read_int64(bytes[5:13])
       if challengeResponse == p.clientSalt ^ p.serverSalt {
         p.state = CONNECTED
-        log.Printf("%v is welcome.", p.Id)
+        p.log.Info("welcome")
         msgBytes := make([]byte, 13)
         binary.LittleEndian.PutUint32(msgBytes[0:4], helpers.GetProtocolId())
         msgBytes[4] = byte(WELCOME)
@@ -343,6 +388,23 @@ func (p *UDPPlayer) AuthenticateConnection(bytes []byte, conn gnet.Conn) bool {
   return false
 }
 
+// Tell the client the server is going away. Sent a few times
+// up front since nothing will be around to resend it.
+func (p *UDPPlayer) Disconnect() {
+  if p.state < CONNECTED || p.connection == nil {
+    return
+  }
+
+  msgBytes := make([]byte, 13)
+  binary.LittleEndian.PutUint32(msgBytes[0:4], helpers.GetProtocolId())
+  msgBytes[4] = byte(DISCONNECT)
+  binary.LittleEndian.PutUint64(msgBytes[5:13], uint64(p.clientSalt ^ p.serverSalt))
+  for i := 0; i < DISCONNECT_COUNT; i++ {
+    p.send(msgBytes)
+  }
+  p.state = DISCONNECTED
+}
+
 func (p *UDPPlayer) SetState(s UDPPlayerState) {
   p.state = s
 }
@@ -0,0 +1,286 @@
+package udp
+
+import(
+  "time"
+  "testing"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/netsim"
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/util"
+)
+
+const countCmd UDPCmd = 0xf0
+
+// A numbered message, so the far end can tell what it got.
+type countMsg struct {
+  n uint32
+}
+
+func (m *countMsg) GetCmd() UDPCmd { return countCmd }
+func (m *countMsg) GetSize() int   { return 5 }
+func (m *countMsg) Serialize(bytes []byte) {
+  bytes[0] = byte(countCmd)
+  binary.LittleEndian.PutUint32(bytes[1:5], m.n)
+}
+func (m *countMsg) Deserialize(bytes []byte, head int) int {
+  m.n = binary.LittleEndian.Uint32(bytes[head+1:head+5])
+  return head + 5
+}
+
+func setTestConfig() {
+  c := helpers.DefaultConfig()
+  helpers.SetConfig(&c)
+}
+
+// The client's end as pkg/client does it: UDPPlayer bumps seq once per
+// message and repeats unacked ones behind the new ones, so only the
+// first seq - rxSeq messages of a fresh packet are new.
+type testPeer struct {
+  t       *testing.T
+  salt    int64
+  rxSeq   uint16
+  got     []uint32
+}
+
+func (c *testPeer) receive(packet []byte) {
+  if len(packet) <= HEADER_SIZE || snet.Read_int64(packet[4:12]) != c.salt {
+    return
+  }
+  seq := snet.Read_uint16(packet[12:14])
+  if !seqGreaterThan(seq, c.rxSeq) {
+    return
+  }
+  gap := int(seq - c.rxSeq)
+  c.rxSeq = seq
+
+  fresh := []uint32{}
+  for head := HEADER_SIZE; head < len(packet) && len(fresh) < gap; {
+    if UDPCmd(packet[head]) != countCmd {
+      c.t.Fatalf("packet %d has cmd %d at %d", seq, packet[head], head)
+    }
+    var m countMsg
+    head = m.Deserialize(packet, head)
+    fresh = append(fresh, m.n)
+  }
+  if len(fresh) < gap {
+    c.t.Fatalf("packet %d holds %d new messages, want %d", seq, len(fresh), gap)
+  }
+
+  // newest first
+  for i := len(fresh) - 1; i >= 0; i-- {
+    c.got = append(c.got, fresh[i])
+  }
+}
+
+// Acks everything received so far.
+func (c *testPeer) ack() []byte {
+  packet := make([]byte, HEADER_SIZE + 1)
+  var header UDPHeader
+  header.ProtocolId = helpers.GetProtocolId()
+  header.Salt = c.salt
+  header.Ack = c.rxSeq
+  header.Serialize(packet)
+  packet[HEADER_SIZE] = byte(SHUTUP)
+  return packet
+}
+
+func recvAll(end *transport.PipeEnd) chan []byte {
+  packets := make(chan []byte, 256)
+  go func() {
+    for {
+      p, err := end.Recv()
+      if err != nil {
+        close(packets)
+        return
+      }
+      packets <- p
+    }
+  }()
+  return packets
+}
+
+// Sends count messages from a connected UDPPlayer starting at seq
+// through a bad network both ways and checks each arrives once, in order.
+func checkDelivery(t *testing.T, c netsim.Conditions, seed int64, seq uint16, count uint32) {
+  setTestConfig()
+  simEnd, clientEnd := transport.Pipe("sim", "client")
+  defer simEnd.Close()
+  downNet := netsim.New(c, seed)
+  upNet := netsim.New(c, seed + 1)
+  down := downNet.Wrap(simEnd)
+  up := upNet.Wrap(clientEnd)
+  toClient := recvAll(clientEnd)
+  toSim := recvAll(simEnd)
+
+  p := NewPlayer(make(chan UDPMsg, 1), uuid.New(), nil, nil)
+  p.connection = down
+  p.state = PLAYING
+  p.clientSalt = 0x1234
+  p.serverSalt = 0x5678
+  p.txSeq = seq
+  p.txAck = seq
+
+  peer := &testPeer{t: t, salt: p.clientSalt ^ p.serverSalt, rxSeq: seq}
+
+  next := uint32(0)
+  deadline := time.Now().Add(20 * time.Second)
+  for uint32(len(peer.got)) < count {
+    if time.Now().After(deadline) {
+      t.Fatalf("only %d of %d messages arrived", len(peer.got), count)
+    }
+
+    for next < count && len(p.Outgoing) < cap(p.Outgoing) {
+      p.Outgoing <- &countMsg{n: next}
+      next++
+    }
+    p.PackAndSend()
+
+    for drained := false; !drained; {
+      select {
+        case packet := <-toClient:
+          peer.receive(packet)
+        default:
+          drained = true
+      }
+    }
+    up.Send(peer.ack())
+
+    for drained := false; !drained; {
+      select {
+        case packet := <-toSim:
+          if snet.Read_uint32(packet[0:4]) == helpers.GetProtocolId() {
+            p.Unpack(packet[4:])
+          }
+        default:
+          drained = true
+      }
+    }
+
+    time.Sleep(time.Millisecond)
+  }
+
+  for i, n := range peer.got {
+    if n != uint32(i) {
+      t.Fatalf("message %d is %d, every message should arrive once and in order", i, n)
+    }
+  }
+  if uint32(len(peer.got)) != count {
+    t.Fatalf("got %d messages, want %d", len(peer.got), count)
+  }
+  if p.txSeq != seq + uint16(count) {
+    t.Fatalf("txSeq is %d, want %d", p.txSeq, seq + uint16(count))
+  }
+
+  // make sure the network was as bad as asked
+  for _, n := range []*netsim.Network{downNet, upNet} {
+    s := n.Stats()
+    if (c.Loss > 0 && s.Dropped == 0) || (c.Duplicate > 0 && s.Duplicated == 0) || (c.Reorder > 0 && s.Reordered == 0) {
+      t.Fatalf("network went easy on us: %+v", s)
+    }
+  }
+}
+
+var badNetwork = netsim.Conditions{
+  Latency: time.Millisecond,
+  Jitter: 2 * time.Millisecond,
+  Loss: 0.2,
+  Duplicate: 0.1,
+  Reorder: 0.1,
+  ReorderDelay: 5 * time.Millisecond,
+}
+
+func TestDeliveryCleanNetwork(t *testing.T) {
+  checkDelivery(t, netsim.Conditions{}, 1, 0, 2000)
+}
+
+func TestDeliveryBadNetwork(t *testing.T) {
+  checkDelivery(t, badNetwork, 42, 0, 2000)
+}
+
+func TestDeliverySeqWraps(t *testing.T) {
+  checkDelivery(t, badNetwork, 7, 65535 - 700, 2000)
+}
+
+// Next packet within a moment, nil if none came.
+func nextPacket(packets chan []byte) []byte {
+  select {
+    case p := <-packets:
+      return p
+    case <-time.After(100 * time.Millisecond):
+      return nil
+  }
+}
+
+func controlPacket(cmd UDPCmd, value int64, size int) []byte {
+  packet := make([]byte, size)
+  binary.LittleEndian.PutUint32(packet[0:4], helpers.GetProtocolId())
+  packet[4] = byte(cmd)
+  binary.LittleEndian.PutUint64(packet[5:13], uint64(value))
+  return packet
+}
+
+// HELLO, CHALLENGE, WELCOME as pkg/client/SimConn.go expects them,
+// refusing anything unpadded or with the wrong answer along the way.
+func TestHandshake(t *testing.T) {
+  setTestConfig()
+  padded := helpers.GetConfig().MAX_MSG_SIZE
+  simEnd, clientEnd := transport.Pipe("sim", "client")
+  defer simEnd.Close()
+  toClient := recvAll(clientEnd)
+
+  p := NewPlayer(make(chan UDPMsg, 1), uuid.New(), nil, nil)
+  defer p.stopRepeating()
+  clientSalt := int64(0x0badc0ffee)
+
+  if p.AuthenticateConnection(controlPacket(HELLO, clientSalt, 13), simEnd) || p.GetState() != DISCONNECTED {
+    t.Fatalf("unpadded HELLO moved us to %d", p.GetState())
+  }
+  if packet := nextPacket(toClient); packet != nil {
+    t.Fatalf("answered an unpadded HELLO with %d bytes", len(packet))
+  }
+
+  if p.AuthenticateConnection(controlPacket(HELLO, clientSalt, padded), simEnd) || p.GetState() != CHALLENGED {
+    t.Fatalf("HELLO left us %d, want CHALLENGED", p.GetState())
+  }
+  challenge := nextPacket(toClient)
+  if len(challenge) != padded || UDPCmd(challenge[4]) != CHALLENGE {
+    t.Fatalf("want a padded CHALLENGE, got %v", challenge)
+  }
+  if snet.Read_int64(challenge[5:13]) != clientSalt {
+    t.Fatalf("CHALLENGE echoed salt %x, want %x", snet.Read_int64(challenge[5:13]), clientSalt)
+  }
+  serverSalt := snet.Read_int64(challenge[13:21])
+  answer := clientSalt ^ serverSalt
+
+  if p.AuthenticateConnection(controlPacket(CHALLENGE, answer + 1, padded), simEnd) || p.GetState() != CHALLENGED {
+    t.Fatalf("wrong answer moved us to %d", p.GetState())
+  }
+  if p.AuthenticateConnection(controlPacket(CHALLENGE, answer, 13), simEnd) || p.GetState() != CHALLENGED {
+    t.Fatalf("unpadded answer moved us to %d", p.GetState())
+  }
+
+  if !p.AuthenticateConnection(controlPacket(CHALLENGE, answer, padded), simEnd) {
+    t.Fatalf("right answer refused")
+  }
+  if p.GetState() != SPECTATING {
+    t.Fatalf("welcomed player is %d, want SPECTATING", p.GetState())
+  }
+
+  var welcome []byte
+  for welcome == nil {
+    packet := nextPacket(toClient)
+    if packet == nil {
+      t.Fatalf("no WELCOME")
+    }
+    if UDPCmd(packet[4]) == WELCOME {
+      welcome = packet
+    }
+  }
+  if len(welcome) != 13 || snet.Read_int64(welcome[5:13]) != answer {
+    t.Fatalf("bad WELCOME %v", welcome)
+  }
+}
@@ -4,10 +4,52 @@ type Config struct {
   TIMESTEP int64
   TIMESTEP_NANO int64
   WORLD_RATE int
+  SPECTATE_RATE int      // frames between body states sent to spectators
   NAME string
   VERSION string
   PROTOCOL_ID uint32
   MAX_MSG_SIZE int
+
+  // addresses
+  WORLD_HOST string      // where SIM finds WORLD
+  WORLD_PORT int         // WORLD tcp listen port
+  SIM_HOST string        // address WORLD gives clients for SIM, empty to detect
+  SIM_PORT int           // SIM udp listen port
+  LINK_PORT int          // WORLD tcp port for SIM only
+  LINK_SECRET string     // shared by WORLD and SIM to authenticate the link
+  SIM_REGION string      // cells this SIM owns as minX,minY,maxX,maxY, empty for the whole map
+
+  // admin api, WORLD only
+  ADMIN_ADDR string      // host:port or unix:/path
+  ADMIN_TOKEN string     // empty disables the admin api
+
+  // prometheus /metrics, empty disables
+  WORLD_METRICS_ADDR string
+  SIM_METRICS_ADDR string
+
+  // logging
+  LOG_LEVEL string       // debug, info, warn or error
+  LOG_LEVELS string      // per subsystem overrides, e.g. udp=debug,chunker=warn
+  LOG_FORMAT string      // text or json
+
+  // chat, WORLD only
+  CHAT_WORDS string      // file of words to mask, one per line, empty for none
+
+  // ships, WORLD only
+  SHIPS string           // file of ship definitions (json), empty for the built in ship
+
+  // map
+  MAP_PATH string
+  SAVE_RATE int          // seconds between map saves
+  EVICT_AGE int          // seconds before unused map files are unloaded
+
+  // limits
+  MAX_PLAYERS int        // 0 for no limit
+  CHAT_RATE int          // chat messages a player may send per minute
+  CHAT_BURST int         // chat messages a player may send at once
+  PING_RATE int          // seconds between PINGs to each player
+  PING_TIMEOUT int       // seconds without a PONG before a player is disconnected
+  SHUTDOWN_TIMEOUT int   // seconds to finish up after SIGINT/SIGTERM before exiting anyway
 }
 
 var configInstance *Config
@@ -18,3 +60,41 @@ func GetConfiguredTimestep()      int64   { return configInstance.TIMESTEP }
 func GetConfiguredTimestepNanos() int64   { return configInstance.TIMESTEP_NANO }
 func GetConfiguredWorldRate()     int     { return configInstance.WORLD_RATE }
 func GetProtocolId()              uint32  { return configInstance.PROTOCOL_ID }
+
+func DefaultConfig() Config {
+  var c Config
+  c.TIMESTEP = 33
+  c.TIMESTEP_NANO = 0
+  c.WORLD_RATE = 12
+  c.SPECTATE_RATE = 6
+  c.VERSION = "0.0.1"
+  c.PROTOCOL_ID = 3551548956
+  c.MAX_MSG_SIZE = 1024
+  c.WORLD_HOST = "127.0.0.1"
+  c.WORLD_PORT = 9494
+  c.SIM_HOST = ""
+  c.SIM_PORT = 9495
+  c.LINK_PORT = 9496
+  c.LINK_SECRET = ""
+  c.SIM_REGION = ""
+  c.ADMIN_ADDR = "127.0.0.1:9497"
+  c.ADMIN_TOKEN = ""
+  c.WORLD_METRICS_ADDR = ""
+  c.SIM_METRICS_ADDR = ""
+  c.LOG_LEVEL = "info"
+  c.LOG_LEVELS = ""
+  c.LOG_FORMAT = "text"
+  c.MAP_PATH = "assets/localMap"
+  c.SAVE_RATE = 60
+  c.EVICT_AGE = 300
+  c.MAX_PLAYERS = 0
+  c.CHAT_RATE = 30
+  c.CHAT_BURST = 5
+  c.CHAT_WORDS = ""
+  c.SHIPS = ""
+  c.PING_RATE = 5
+  c.PING_TIMEOUT = 30
+  c.SHUTDOWN_TIMEOUT = 10
+
+  return c
+}
@@ -0,0 +1,342 @@
+package helpers
+
+import(
+  "os"
+  "fmt"
+  "net"
+  "flag"
+  "bufio"
+  "errors"
+  "strconv"
+  "strings"
+  "unicode"
+  "path/filepath"
+
+  "go-space-serv/internal/space/snet"
+)
+
+// One configurable value.
+// key is used in config files and as the flag name,
+// the environment variable is SPACE_ followed by key in upper snake case.
+type configOption struct {
+  key     string
+  usage   string
+  get     func(c *Config) string
+  set     func(c *Config, val string) error
+}
+
+func intOption(key, usage string, field func(c *Config) *int) configOption {
+  return configOption{
+    key: key,
+    usage: usage,
+    get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+    set: func(c *Config, val string) error {
+      v, err := strconv.Atoi(val)
+      if err == nil {
+        *field(c) = v
+      }
+      return err
+    },
+  }
+}
+
+func int64Option(key, usage string, field func(c *Config) *int64) configOption {
+  return configOption{
+    key: key,
+    usage: usage,
+    get: func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+    set: func(c *Config, val string) error {
+      v, err := strconv.ParseInt(val, 10, 64)
+      if err == nil {
+        *field(c) = v
+      }
+      return err
+    },
+  }
+}
+
+func stringOption(key, usage string, field func(c *Config) *string) configOption {
+  return configOption{
+    key: key,
+    usage: usage,
+    get: func(c *Config) string { return *field(c) },
+    set: func(c *Config, val string) error {
+      *field(c) = val
+      return nil
+    },
+  }
+}
+
+var configOptions = []configOption{
+  int64Option("timestep", "physics timestep in milliseconds", func(c *Config) *int64 { return &c.TIMESTEP }),
+  int64Option("timestepNano", "physics timestep in nanoseconds, 0 to derive from timestep", func(c *Config) *int64 { return &c.TIMESTEP_NANO }),
+  intOption("worldRate", "physics frames passing before sending state update to world", func(c *Config) *int { return &c.WORLD_RATE }),
+  intOption("spectateRate", "physics frames between body states sent to spectators", func(c *Config) *int { return &c.SPECTATE_RATE }),
+  {
+    key: "protocolId",
+    usage: "value must match client",
+    get: func(c *Config) string { return strconv.FormatUint(uint64(c.PROTOCOL_ID), 10) },
+    set: func(c *Config, val string) error {
+      v, err := strconv.ParseUint(val, 10, 32)
+      if err == nil {
+        c.PROTOCOL_ID = uint32(v)
+      }
+      return err
+    },
+  },
+  intOption("maxMsgSize", "size of handshake packets and largest message", func(c *Config) *int { return &c.MAX_MSG_SIZE }),
+  stringOption("worldHost", "address SIM uses to reach WORLD", func(c *Config) *string { return &c.WORLD_HOST }),
+  intOption("worldPort", "WORLD tcp port", func(c *Config) *int { return &c.WORLD_PORT }),
+  stringOption("simHost", "address of SIM given to clients, empty to detect", func(c *Config) *string { return &c.SIM_HOST }),
+  intOption("simPort", "SIM udp port", func(c *Config) *int { return &c.SIM_PORT }),
+  intOption("linkPort", "WORLD tcp port for SIM only", func(c *Config) *int { return &c.LINK_PORT }),
+  stringOption("linkSecret", "shared by WORLD and SIM to authenticate the link, better kept in a config file or SPACE_LINK_SECRET", func(c *Config) *string { return &c.LINK_SECRET }),
+  stringOption("simRegion", "cells this SIM owns as minX,minY,maxX,maxY, empty for the whole map", func(c *Config) *string { return &c.SIM_REGION }),
+  stringOption("adminAddr", "WORLD admin api address, host:port or unix:/path", func(c *Config) *string { return &c.ADMIN_ADDR }),
+  stringOption("adminToken", "token for the WORLD admin api, empty disables it", func(c *Config) *string { return &c.ADMIN_TOKEN }),
+  stringOption("worldMetricsAddr", "host:port WORLD serves /metrics on, empty disables it", func(c *Config) *string { return &c.WORLD_METRICS_ADDR }),
+  stringOption("simMetricsAddr", "host:port SIM serves /metrics on, empty disables it", func(c *Config) *string { return &c.SIM_METRICS_ADDR }),
+  stringOption("logLevel", "debug, info, warn or error", func(c *Config) *string { return &c.LOG_LEVEL }),
+  stringOption("logLevels", "per subsystem log levels, e.g. udp=debug,chunker=warn", func(c *Config) *string { return &c.LOG_LEVELS }),
+  stringOption("logFormat", "text or json", func(c *Config) *string { return &c.LOG_FORMAT }),
+  stringOption("mapPath", "directory holding meta.chunks and the chunk files", func(c *Config) *string { return &c.MAP_PATH }),
+  intOption("saveRate", "seconds between writing modified chunks to disk", func(c *Config) *int { return &c.SAVE_RATE }),
+  intOption("evictAge", "seconds before an unused, unmodified chunk file is unloaded", func(c *Config) *int { return &c.EVICT_AGE }),
+  intOption("maxPlayers", "players allowed at once, 0 for no limit", func(c *Config) *int { return &c.MAX_PLAYERS }),
+  intOption("chatRate", "chat messages a player may send per minute", func(c *Config) *int { return &c.CHAT_RATE }),
+  intOption("chatBurst", "chat messages a player may send at once", func(c *Config) *int { return &c.CHAT_BURST }),
+  stringOption("chatWords", "file of words masked in chat, one per line, empty for none", func(c *Config) *string { return &c.CHAT_WORDS }),
+  stringOption("ships", "file of ship definitions (json), empty for the built in ship", func(c *Config) *string { return &c.SHIPS }),
+  intOption("pingRate", "seconds between PINGs to each player", func(c *Config) *int { return &c.PING_RATE }),
+  intOption("pingTimeout", "seconds without a PONG before a player is disconnected", func(c *Config) *int { return &c.PING_TIMEOUT }),
+  intOption("shutdownTimeout", "seconds to finish up after SIGINT/SIGTERM before exiting anyway", func(c *Config) *int { return &c.SHUTDOWN_TIMEOUT }),
+}
+
+// Records a flag only if it was passed so it can
+// be applied after the config file and environment.
+type configFlag struct {
+  opt     *configOption
+  def     string
+  val     string
+  isSet   bool
+}
+
+func (f *configFlag) String() string {
+  if f == nil {
+    return ""
+  }
+  if f.isSet {
+    return f.val
+  }
+  return f.def
+}
+
+func (f *configFlag) Set(val string) error {
+  f.val = val
+  f.isSet = true
+  return nil
+}
+
+// Registers every option on fs, parses args and builds the config.
+// Later sources override earlier ones:
+//   defaults < config file < environment (SPACE_*) < flags
+// The config file is taken from --config or SPACE_CONFIG.
+// A positional argument names a map under assets/ and overrides mapPath.
+func LoadConfig(name string, fs *flag.FlagSet, args []string) (*Config, error) {
+  config := DefaultConfig()
+  config.NAME = name
+
+  configFile := fs.String("config", os.Getenv("SPACE_CONFIG"), "config file of key = value lines")
+  flags := make([]*configFlag, len(configOptions))
+  for i := range configOptions {
+    opt := &configOptions[i]
+    flags[i] = &configFlag{opt: opt, def: opt.get(&config)}
+    fs.Var(flags[i], opt.key, opt.usage)
+  }
+
+  if err := fs.Parse(args); err != nil {
+    return nil, err
+  }
+
+  if *configFile != "" {
+    if err := loadConfigFile(&config, *configFile); err != nil {
+      return nil, err
+    }
+  }
+
+  for i := range configOptions {
+    opt := &configOptions[i]
+    if val, ok := os.LookupEnv(envName(opt.key)); ok {
+      if err := opt.set(&config, val); err != nil {
+        return nil, fmt.Errorf("%s: %s", envName(opt.key), err)
+      }
+    }
+  }
+
+  for _, f := range flags {
+    if f.isSet {
+      if err := f.opt.set(&config, f.val); err != nil {
+        return nil, fmt.Errorf("--%s: %s", f.opt.key, err)
+      }
+    }
+  }
+
+  if fs.Arg(0) != "" {
+    config.MAP_PATH = filepath.Join("assets", fs.Arg(0))
+  }
+
+  if config.TIMESTEP_NANO == 0 {
+    config.TIMESTEP_NANO = config.TIMESTEP * 1000000
+  }
+
+  if err := config.Validate(); err != nil {
+    return nil, err
+  }
+
+  return &config, nil
+}
+
+func loadConfigFile(config *Config, fileName string) error {
+  f, err := os.Open(fileName)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  scanner := bufio.NewScanner(f)
+  lineNum := 0
+  for scanner.Scan() {
+    lineNum++
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    parts := strings.SplitN(line, "=", 2)
+    if len(parts) != 2 {
+      return fmt.Errorf("%s:%d: expected key = value", fileName, lineNum)
+    }
+
+    key := strings.TrimSpace(parts[0])
+    val := strings.TrimSpace(parts[1])
+    opt := findConfigOption(key)
+    if opt == nil {
+      return fmt.Errorf("%s:%d: unknown key %q", fileName, lineNum, key)
+    }
+
+    if err = opt.set(config, val); err != nil {
+      return fmt.Errorf("%s:%d: %s", fileName, lineNum, err)
+    }
+  }
+
+  return scanner.Err()
+}
+
+func findConfigOption(key string) *configOption {
+  for i := range configOptions {
+    if configOptions[i].key == key {
+      return &configOptions[i]
+    }
+  }
+  return nil
+}
+
+// worldPort -> SPACE_WORLD_PORT
+func envName(key string) string {
+  var b strings.Builder
+  b.WriteString("SPACE_")
+  for _, r := range key {
+    if unicode.IsUpper(r) {
+      b.WriteRune('_')
+    }
+    b.WriteRune(unicode.ToUpper(r))
+  }
+  return b.String()
+}
+
+func (c *Config) Validate() error {
+  if c.TIMESTEP <= 0 {
+    return errors.New("timestep must be positive")
+  }
+  if c.TIMESTEP_NANO / 1000000 != c.TIMESTEP {
+    return fmt.Errorf("timestepNano %d does not match timestep %dms", c.TIMESTEP_NANO, c.TIMESTEP)
+  }
+  if c.WORLD_RATE <= 0 {
+    return errors.New("worldRate must be positive")
+  }
+  if c.SPECTATE_RATE <= 0 {
+    return errors.New("spectateRate must be positive")
+  }
+  if c.PROTOCOL_ID == 0 {
+    return errors.New("protocolId must not be 0")
+  }
+  // CHALLENGE is 21 bytes, a udp payload is at most 65507
+  if c.MAX_MSG_SIZE < 64 || c.MAX_MSG_SIZE > 65507 {
+    return errors.New("maxMsgSize must be between 64 and 65507")
+  }
+
+  for _, p := range []struct{ name string; port int }{
+    {"worldPort", c.WORLD_PORT},
+    {"simPort", c.SIM_PORT},
+    {"linkPort", c.LINK_PORT},
+  } {
+    if p.port <= 0 || p.port > 65535 {
+      return fmt.Errorf("%s %d is not a valid port", p.name, p.port)
+    }
+  }
+  if c.LINK_PORT == c.WORLD_PORT {
+    return errors.New("linkPort must differ from worldPort")
+  }
+  if c.LINK_SECRET == "" {
+    return errors.New("linkSecret must be set")
+  }
+
+  if c.ADMIN_TOKEN != "" && c.ADMIN_ADDR == "" {
+    return errors.New("adminAddr must be set when adminToken is")
+  }
+
+  if _, err := snet.ParseRegion(c.SIM_REGION); err != nil {
+    return fmt.Errorf("simRegion: %s", err)
+  }
+
+  if _, err := ParseLogLevels(c.LOG_LEVEL, c.LOG_LEVELS); err != nil {
+    return err
+  }
+  if c.LOG_FORMAT != "text" && c.LOG_FORMAT != "json" {
+    return fmt.Errorf("logFormat %q must be text or json", c.LOG_FORMAT)
+  }
+
+  if c.WORLD_HOST == "" {
+    return errors.New("worldHost must not be empty")
+  }
+  if c.SIM_HOST != "" && net.ParseIP(c.SIM_HOST) == nil {
+    return fmt.Errorf("simHost %q is not an ip address", c.SIM_HOST)
+  }
+
+  if _, err := os.Stat(filepath.Join(c.MAP_PATH, "meta.chunks")); err != nil {
+    return fmt.Errorf("mapPath: %s", err)
+  }
+  if c.SAVE_RATE <= 0 {
+    return errors.New("saveRate must be positive")
+  }
+  if c.EVICT_AGE <= 0 {
+    return errors.New("evictAge must be positive")
+  }
+  if c.MAX_PLAYERS < 0 {
+    return errors.New("maxPlayers must not be negative")
+  }
+  if c.CHAT_RATE <= 0 || c.CHAT_BURST <= 0 {
+    return errors.New("chatRate and chatBurst must be positive")
+  }
+  if c.PING_RATE <= 0 {
+    return errors.New("pingRate must be positive")
+  }
+  if c.PING_TIMEOUT <= c.PING_RATE {
+    return errors.New("pingTimeout must be longer than pingRate")
+  }
+  if c.SHUTDOWN_TIMEOUT <= 0 {
+    return errors.New("shutdownTimeout must be positive")
+  }
+
+  return nil
+}
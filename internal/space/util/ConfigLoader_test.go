@@ -0,0 +1,152 @@
+package helpers
+
+import(
+  "os"
+  "flag"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// A directory holding an empty map called name, and the map's path.
+func testMapDir(t *testing.T, name string) (root, mapPath string) {
+  root = t.TempDir()
+  mapPath = filepath.Join(root, "assets", name)
+  if err := os.MkdirAll(mapPath, 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(filepath.Join(mapPath, "meta.chunks"), nil, 0644); err != nil {
+    t.Fatal(err)
+  }
+  return
+}
+
+func writeConfigFile(t *testing.T, lines ...string) string {
+  fileName := filepath.Join(t.TempDir(), "space.conf")
+  if err := ioutil.WriteFile(fileName, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return fileName
+}
+
+func load(args ...string) (*Config, error) {
+  return LoadConfig("TEST", flag.NewFlagSet("test", flag.ContinueOnError), args)
+}
+
+// defaults < config file < environment < flags
+func TestConfigPrecedence(t *testing.T) {
+  _, mapPath := testMapDir(t, "localMap")
+  fileName := writeConfigFile(t,
+    "# comment",
+    "linkSecret = from-file",
+    "mapPath = " + mapPath,
+    "worldPort = 1001",
+    "simPort = 1002",
+    "linkPort = 1003",
+  )
+  t.Setenv("SPACE_SIM_PORT", "2002")
+  t.Setenv("SPACE_LINK_PORT", "2003")
+
+  config, err := load("--config=" + fileName, "--linkPort=3003")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  defaults := DefaultConfig()
+  if config.ADMIN_ADDR != defaults.ADMIN_ADDR {
+    t.Errorf("adminAddr %q, want default %q", config.ADMIN_ADDR, defaults.ADMIN_ADDR)
+  }
+  if config.WORLD_PORT != 1001 {
+    t.Errorf("worldPort %d, want 1001 from the file", config.WORLD_PORT)
+  }
+  if config.SIM_PORT != 2002 {
+    t.Errorf("simPort %d, want 2002 from the environment", config.SIM_PORT)
+  }
+  if config.LINK_PORT != 3003 {
+    t.Errorf("linkPort %d, want 3003 from the flag", config.LINK_PORT)
+  }
+  if config.LINK_SECRET != "from-file" || config.NAME != "TEST" {
+    t.Errorf("linkSecret %q name %q", config.LINK_SECRET, config.NAME)
+  }
+}
+
+// The config file can come from SPACE_CONFIG too.
+func TestConfigFileFromEnv(t *testing.T) {
+  _, mapPath := testMapDir(t, "localMap")
+  t.Setenv("SPACE_CONFIG", writeConfigFile(t, "linkSecret = s", "mapPath = " + mapPath, "maxPlayers = 9"))
+
+  config, err := load()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if config.MAX_PLAYERS != 9 {
+    t.Fatalf("maxPlayers %d, want 9", config.MAX_PLAYERS)
+  }
+}
+
+// A positional argument is a map under assets/.
+func TestConfigMapArg(t *testing.T) {
+  root, _ := testMapDir(t, "arena")
+  wd, err := os.Getwd()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err = os.Chdir(root); err != nil {
+    t.Fatal(err)
+  }
+  defer os.Chdir(wd)
+
+  config, err := load("--linkSecret=s", "--mapPath=elsewhere", "arena")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if config.MAP_PATH != filepath.Join("assets", "arena") {
+    t.Fatalf("mapPath %q, want assets/arena", config.MAP_PATH)
+  }
+}
+
+func TestConfigValidation(t *testing.T) {
+  _, mapPath := testMapDir(t, "localMap")
+  ok := []string{"--linkSecret=s", "--mapPath=" + mapPath}
+
+  cases := map[string][]string{
+    "linkSecret must be set": {"--linkSecret="},
+    "worldPort 0 is not a valid port": {"--worldPort=0"},
+    "linkPort must differ from worldPort": {"--worldPort=9000", "--linkPort=9000"},
+    "simRegion": {"--simRegion=1,2,3"},
+    "logFormat \"xml\" must be text or json": {"--logFormat=xml"},
+    "simHost \"localhost\" is not an ip address": {"--simHost=localhost"},
+    "mapPath": {"--mapPath=" + filepath.Join(mapPath, "missing")},
+    "maxPlayers must not be negative": {"--maxPlayers=-1"},
+    "pingTimeout must be longer than pingRate": {"--pingRate=10", "--pingTimeout=10"},
+    "adminAddr must be set when adminToken is": {"--adminToken=t", "--adminAddr="},
+    "--saveRate": {"--saveRate=soon"},
+  }
+  for want, args := range cases {
+    args = append(append([]string{}, ok...), args...)
+    _, err := load(args...)
+    if err == nil || !strings.HasPrefix(err.Error(), want) {
+      t.Errorf("%v: got %v, want %s", args, err, want)
+    }
+  }
+
+  if _, err := load(ok...); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestConfigFileErrors(t *testing.T) {
+  cases := map[string]string{
+    "no equals": ":1: expected key = value",
+    "nope = 1": ":1: unknown key \"nope\"",
+    "\nworldPort = many": ":2: strconv.Atoi",
+  }
+  for line, want := range cases {
+    fileName := writeConfigFile(t, line)
+    _, err := load("--config=" + fileName)
+    if err == nil || !strings.HasPrefix(err.Error(), fileName + want) {
+      t.Errorf("%q: got %v, want %s", line, err, fileName + want)
+    }
+  }
+}
@@ -0,0 +1,164 @@
+package helpers
+
+import(
+  "os"
+  "fmt"
+  "sync"
+  "strings"
+  "context"
+  "log/slog"
+)
+
+// Each subsystem logs through its own logger with its own level,
+// so e.g. udp can be turned up to debug without the rest following.
+// Loggers are made at package init, before the config is read,
+// so they look up the shared output on every record.
+var LOG_SUBSYSTEMS = []string{"world", "sim", "udp", "tcp", "link", "chunker", "admin", "metrics"}
+
+var logLevels = map[string]*slog.LevelVar{}
+var logOutput slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+var logLock sync.RWMutex
+
+func init() {
+  for _, sys := range LOG_SUBSYSTEMS {
+    logLevels[sys] = new(slog.LevelVar)
+  }
+}
+
+type subsystemHandler struct {
+  level *slog.LevelVar
+  attrs []slog.Attr
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+  return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+  r.AddAttrs(h.attrs...)
+
+  logLock.RLock()
+  out := logOutput
+  logLock.RUnlock()
+  return out.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+  var with subsystemHandler
+  with.level = h.level
+  with.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+  return &with
+}
+
+// Groups aren't used, attributes stay flat.
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+  return h
+}
+
+// Logger for one of LOG_SUBSYSTEMS, tagged with sys=name.
+func Logger(sys string) *slog.Logger {
+  level, ok := logLevels[sys]
+  if !ok {
+    panic(fmt.Sprintf("unknown log subsystem %s", sys))
+  }
+  return slog.New(&subsystemHandler{level: level, attrs: []slog.Attr{slog.String("sys", sys)}})
+}
+
+// Applies logFormat, logLevel and logLevels from the config.
+// The standard log package, used by gnet, goes to the same output.
+func InitLogging(c *Config) error {
+  levels, err := ParseLogLevels(c.LOG_LEVEL, c.LOG_LEVELS)
+  if err != nil {
+    return err
+  }
+
+  var out slog.Handler
+  opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+  if c.LOG_FORMAT == "json" {
+    out = slog.NewJSONHandler(os.Stderr, opts)
+  } else {
+    out = slog.NewTextHandler(os.Stderr, opts)
+  }
+
+  logLock.Lock()
+  logOutput = out
+  logLock.Unlock()
+
+  for sys, level := range levels {
+    logLevels[sys].Set(level)
+  }
+
+  slog.SetDefault(slog.New(out))
+  return nil
+}
+
+// Level of every subsystem from a default level and
+// overrides such as "udp=debug,chunker=warn".
+func ParseLogLevels(level, overrides string) (map[string]slog.Level, error) {
+  var def slog.Level
+  if err := def.UnmarshalText([]byte(level)); err != nil {
+    return nil, fmt.Errorf("bad log level %q", level)
+  }
+
+  levels := map[string]slog.Level{}
+  for _, sys := range LOG_SUBSYSTEMS {
+    levels[sys] = def
+  }
+
+  for _, override := range strings.Split(overrides, ",") {
+    override = strings.TrimSpace(override)
+    if override == "" {
+      continue
+    }
+
+    parts := strings.SplitN(override, "=", 2)
+    if len(parts) != 2 {
+      return nil, fmt.Errorf("bad log level %q, want subsystem=level", override)
+    }
+
+    sys := strings.TrimSpace(parts[0])
+    if _, ok := logLevels[sys]; !ok {
+      return nil, fmt.Errorf("unknown log subsystem %q, want one of %s", sys, strings.Join(LOG_SUBSYSTEMS, ", "))
+    }
+
+    var l slog.Level
+    if err := l.UnmarshalText([]byte(strings.TrimSpace(parts[1]))); err != nil {
+      return nil, fmt.Errorf("bad log level %q for %s", parts[1], sys)
+    }
+    levels[sys] = l
+  }
+
+  return levels, nil
+}
+
+// Change a level while running. An empty sys changes all of them.
+func SetLogLevel(sys, level string) error {
+  var l slog.Level
+  if err := l.UnmarshalText([]byte(level)); err != nil {
+    return fmt.Errorf("bad log level %q", level)
+  }
+
+  if sys == "" {
+    for _, v := range logLevels {
+      v.Set(l)
+    }
+    return nil
+  }
+
+  v, ok := logLevels[sys]
+  if !ok {
+    return fmt.Errorf("unknown log subsystem %q", sys)
+  }
+  v.Set(l)
+  return nil
+}
+
+// Current level of each subsystem, e.g. "udp" -> "DEBUG".
+func LogLevels() map[string]string {
+  levels := map[string]string{}
+  for sys, v := range logLevels {
+    levels[sys] = v.Level().String()
+  }
+  return levels
+}
+
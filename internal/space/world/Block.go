@@ -1,13 +1,48 @@
 package world
 
+import(
+  "fmt"
+  "strings"
+)
+
 type BlockType byte
 
 const (
   EMPTY BlockType = iota
   GRAY
+  BROWN
+  BLUE
+  WHITE
+  RED
 )
 
+var blockTypeNames = []string{
+  "EMPTY",
+  "GRAY",
+  "BROWN",
+  "BLUE",
+  "WHITE",
+  "RED",
+}
+
 type Block struct {
   Type BlockType
   X, Y int
 }
+
+func (t BlockType) String() string {
+  if int(t) < len(blockTypeNames) {
+    return blockTypeNames[t]
+  }
+  return fmt.Sprintf("BlockType(%d)", t)
+}
+
+// Case insensitive lookup by name, used by generator profiles.
+func ParseBlockType(name string) (BlockType, error) {
+  for i, n := range blockTypeNames {
+    if strings.EqualFold(n, name) {
+      return BlockType(i), nil
+    }
+  }
+  return EMPTY, fmt.Errorf("unknown block type %q", name)
+}
@@ -0,0 +1,188 @@
+package world
+
+import(
+  "time"
+  "errors"
+  "sync/atomic"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/util"
+)
+
+var ErrChatLength = errors.New("chat: text must be 1 to 256 bytes")
+var ErrChatText = errors.New("chat: text is not valid utf-8 or has control characters")
+var ErrChatRate = errors.New("chat: sending too fast")
+var ErrChatFiltered = errors.New("chat: text was filtered")
+var ErrChatScope = errors.New("chat: unknown scope")
+var ErrChatNoTarget = errors.New("chat: no such player")
+
+// Checks chat text before it goes out. Returns the text to send,
+// e.g. with words masked, or false to drop the message.
+type ChatFilter func(from *WorldPlayer, text string) (string, bool)
+
+// Masks whole words from words, ignoring case, with asterisks.
+func WordFilter(words []string) ChatFilter {
+  banned := make(map[string]bool)
+  for _, w := range words {
+    if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+      banned[w] = true
+    }
+  }
+
+  return func(from *WorldPlayer, text string) (string, bool) {
+    var b strings.Builder
+    word := []rune{}
+    flush := func() {
+      if banned[strings.ToLower(string(word))] {
+        b.WriteString(strings.Repeat("*", len(word)))
+      } else {
+        b.WriteString(string(word))
+      }
+      word = word[:0]
+    }
+
+    for _, r := range text {
+      if unicode.IsLetter(r) || unicode.IsNumber(r) {
+        word = append(word, r)
+      } else {
+        flush()
+        b.WriteRune(r)
+      }
+    }
+    flush()
+    return b.String(), true
+  }
+}
+
+// Token bucket, CHAT_BURST messages at once refilling at
+// CHAT_RATE per minute. Only used by the chat handler.
+type chatLimit struct {
+  tokens  float64
+  last    time.Time
+}
+
+func (l *chatLimit) allow(now time.Time) bool {
+  config := helpers.GetConfig()
+  burst := float64(config.CHAT_BURST)
+  if l.last.IsZero() {
+    l.tokens = burst
+  } else {
+    l.tokens += now.Sub(l.last).Minutes() * float64(config.CHAT_RATE)
+    if l.tokens > burst {
+      l.tokens = burst
+    }
+  }
+  l.last = now
+
+  if l.tokens < 1 {
+    return false
+  }
+  l.tokens--
+  return true
+}
+
+func (w *World) SetChatFilter(f ChatFilter) {
+  w.chatFilter = f
+}
+
+// Deliver a player's CHAT. Errors are told to the sender as
+// a system message and returned for logging.
+func (w *World) Chat(from uuid.UUID, m *msg.ChatMsg) error {
+  plr := w.players.GetPlayer(from)
+  if plr == nil {
+    return ErrChatNoTarget
+  }
+
+  err := w.chat(plr, m)
+  if err != nil {
+    var reply msg.ChatMsg
+    reply.Scope = msg.CHAT_SYSTEM
+    reply.Text = err.Error()
+    if !offer(plr, &reply) {
+      w.countChatDrops(1)
+    }
+  }
+  return err
+}
+
+func (w *World) chat(plr *WorldPlayer, m *msg.ChatMsg) error {
+  text := m.Text
+  if len(text) == 0 || len(text) > msg.MAX_CHAT_LEN {
+    return ErrChatLength
+  }
+  for _, r := range text {
+    if r == utf8.RuneError || unicode.IsControl(r) {
+      return ErrChatText
+    }
+  }
+  if !plr.chatLimit.allow(time.Now()) {
+    return ErrChatRate
+  }
+  if w.chatFilter != nil {
+    var ok bool
+    if text, ok = w.chatFilter(plr, text); !ok {
+      return ErrChatFiltered
+    }
+  }
+
+  var out msg.ChatMsg
+  out.Scope = m.Scope
+  out.PlayerId = plr.Tcp.Id
+  out.Text = text
+
+  switch m.Scope {
+    case msg.CHAT_GLOBAL:
+      w.countChatDrops(w.players.PushAllExcluding(plr.Tcp.Id, &out))
+    case msg.CHAT_TEAM:
+      w.countChatDrops(w.players.PushTeamExcluding(plr.Team, plr.Tcp.Id, &out))
+    case msg.CHAT_WHISPER:
+      to := w.players.GetPlayer(m.PlayerId)
+      if to == nil || to.Tcp.Id == plr.Tcp.Id {
+        return ErrChatNoTarget
+      }
+      if !w.players.Push(to.Tcp.Id, &out) {
+        w.countChatDrops(1)
+      }
+    default:
+      return ErrChatScope
+  }
+
+  logger.Debug("chat", "player", plr.Tcp.Id, "scope", m.Scope, "to", m.PlayerId, "len", len(text))
+  return nil
+}
+
+// System message to every player, or only to to if not nil.
+// Returns false if to isn't connected.
+func (w *World) SystemChat(to uuid.UUID, text string) bool {
+  var out msg.ChatMsg
+  out.Scope = msg.CHAT_SYSTEM
+  out.Text = text
+
+  if to == uuid.Nil {
+    w.countChatDrops(w.players.PushAll(&out))
+    return true
+  }
+  if w.players.GetPlayer(to) == nil {
+    return false
+  }
+  if !w.players.Push(to, &out) {
+    w.countChatDrops(1)
+  }
+  return true
+}
+
+func (w *World) countChatDrops(n int) {
+  if n > 0 {
+    atomic.AddUint64(&w.chatDrops, uint64(n))
+  }
+}
+
+// Chat messages dropped because a player's queue was full.
+func (w *World) ChatDropped() uint64 {
+  return atomic.LoadUint64(&w.chatDrops)
+}
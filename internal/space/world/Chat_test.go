@@ -0,0 +1,171 @@
+package world
+
+import(
+  "time"
+  "strings"
+  "testing"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/util"
+)
+
+// A world of connected players named names, for chat only.
+func chatWorld(t *testing.T, names ...string) (*World, []*WorldPlayer) {
+  config := helpers.DefaultConfig()
+  config.CHAT_BURST = 2
+  config.CHAT_RATE = 30
+  helpers.SetConfig(&config)
+
+  var p WorldPlayers
+  plrs := []*WorldPlayer{}
+  for _, name := range names {
+    plr, _ := addPlayer(t, &p, name)
+    plr.Tcp.Connected()
+    plrs = append(plrs, plr)
+  }
+  return &World{players: &p}, plrs
+}
+
+// Messages queued for plr, emptying the queue.
+func queued(plr *WorldPlayer) []tcp.TCPMsg {
+  msgs := []tcp.TCPMsg{}
+  for len(plr.Tcp.Outgoing) > 0 {
+    msgs = append(msgs, <-plr.Tcp.Outgoing)
+  }
+  return msgs
+}
+
+func TestChatRejectsText(t *testing.T) {
+  w, plrs := chatWorld(t, "Ace", "Bolt")
+  ace, bolt := plrs[0], plrs[1]
+
+  cases := map[string]error{
+    "": ErrChatLength,
+    strings.Repeat("a", msg.MAX_CHAT_LEN + 1): ErrChatLength,
+    "bad \xff byte": ErrChatText,
+    "two\nlines": ErrChatText,
+    "bell\a": ErrChatText,
+  }
+  for text, want := range cases {
+    err := w.Chat(ace.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: text})
+    if err != want {
+      t.Errorf("%q: got %v, want %v", text, err, want)
+    }
+    reply := queued(ace)
+    if len(reply) != 1 || reply[0].(*msg.ChatMsg).Scope != msg.CHAT_SYSTEM || reply[0].(*msg.ChatMsg).Text != want.Error() {
+      t.Errorf("%q: sender got %v, want a system message saying why", text, reply)
+    }
+  }
+  if got := queued(bolt); len(got) != 0 {
+    t.Fatalf("bolt got %v", got)
+  }
+
+  // the longest allowed, in multi byte runes
+  text := strings.Repeat("ë", msg.MAX_CHAT_LEN / 2)
+  if err := w.Chat(ace.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: text}); err != nil {
+    t.Fatal(err)
+  }
+  if got := queued(bolt); len(got) != 1 || got[0].(*msg.ChatMsg).Text != text {
+    t.Fatalf("bolt got %v", got)
+  }
+}
+
+// chatBurst at once, then chatRate a minute.
+func TestChatRateLimit(t *testing.T) {
+  w, plrs := chatWorld(t, "Ace", "Bolt")
+  ace, bolt := plrs[0], plrs[1]
+
+  for i := 0; i < 2; i++ {
+    if err := w.Chat(ace.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: "hi"}); err != nil {
+      t.Fatalf("message %d: %s", i, err)
+    }
+  }
+  if err := w.Chat(ace.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: "hi"}); err != ErrChatRate {
+    t.Fatalf("got %v, want %v", err, ErrChatRate)
+  }
+  if got := queued(bolt); len(got) != 2 {
+    t.Fatalf("bolt got %d messages, want 2", len(got))
+  }
+
+  // 30 a minute is one every 2 seconds
+  var l chatLimit
+  now := time.Now()
+  allowed := []bool{}
+  for _, at := range []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 2 * time.Second, time.Hour, time.Hour, time.Hour} {
+    allowed = append(allowed, l.allow(now.Add(at)))
+  }
+  want := []bool{true, true, false, false, true, false, true, true, false}
+  for i := range want {
+    if allowed[i] != want[i] {
+      t.Fatalf("got %v, want %v", allowed, want)
+    }
+  }
+}
+
+func TestWordFilter(t *testing.T) {
+  filter := WordFilter([]string{"Darn", " heck ", "", "zoë"})
+  cases := map[string]string{
+    "darn it": "**** it",
+    "DARN!heck,darn": "****!****,****",
+    "heckle and darned": "heckle and darned",
+    "Zoë says hi": "*** says hi",
+    "clean": "clean",
+  }
+  for text, want := range cases {
+    if got, ok := filter(nil, text); !ok || got != want {
+      t.Errorf("%q: got %q %v, want %q", text, got, ok, want)
+    }
+  }
+
+  // whatever the filter returns is what goes out
+  w, plrs := chatWorld(t, "Ace", "Bolt")
+  w.SetChatFilter(filter)
+  if err := w.Chat(plrs[0].Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: "oh darn"}); err != nil {
+    t.Fatal(err)
+  }
+  if got := queued(plrs[1]); len(got) != 1 || got[0].(*msg.ChatMsg).Text != "oh ****" {
+    t.Fatalf("bolt got %v", got)
+  }
+
+  w.SetChatFilter(func(from *WorldPlayer, text string) (string, bool) { return text, false })
+  if err := w.Chat(plrs[0].Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: "hi"}); err != ErrChatFiltered {
+    t.Fatalf("got %v, want %v", err, ErrChatFiltered)
+  }
+}
+
+// Chat to a player whose queue is full is dropped
+// and counted rather than waited on.
+func TestChatDropsForFullQueue(t *testing.T) {
+  w, plrs := chatWorld(t, "Ace", "Bolt", "Cat")
+  ace, bolt, cat := plrs[0], plrs[1], plrs[2]
+  for len(ace.Tcp.Outgoing) < cap(ace.Tcp.Outgoing) {
+    ace.Tcp.Outgoing <- &msg.ShutdownMsg{}
+  }
+
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    w.Chat(bolt.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_GLOBAL, Text: "hi all"})
+    w.Chat(bolt.Tcp.Id, &msg.ChatMsg{Scope: msg.CHAT_WHISPER, PlayerId: ace.Tcp.Id, Text: "hi ace"})
+    w.SystemChat(ace.Tcp.Id, "hello")
+    w.SystemChat(uuid.Nil, "everyone")
+  }()
+  select {
+    case <-done:
+    case <-time.After(time.Second):
+      t.Fatalf("chat waited on a full queue")
+  }
+
+  if w.ChatDropped() != 4 {
+    t.Fatalf("dropped %d, want 4", w.ChatDropped())
+  }
+  if got := queued(cat); len(got) != 2 {
+    t.Fatalf("cat got %d messages, want the global chat and the system one", len(got))
+  }
+  if got := queued(bolt); len(got) != 1 {
+    t.Fatalf("bolt got %d messages, want the system one", len(got))
+  }
+}
@@ -1,27 +1,47 @@
 package world
 
 import(
-  "log"
   "fmt"
   "os"
   "bytes"
+  "sync"
   "io/ioutil"
+  "path/filepath"
   "compress/zlib"
 
   "go-space-serv/internal/space/util"
+  "go-space-serv/internal/space/metrics"
 )
 
+var chunkerLog = helpers.Logger("chunker")
+
 type Chunker struct {
   info WorldInfo
   files map[uint16][]byte
+  dirty map[uint16]uint64     // file -> changes since it was last written
   access []int64
   writer *zlib.Writer
+  lock sync.Mutex
+  stats ChunkerStats
+}
+
+// Counters since startup, for the admin api.
+type ChunkerStats struct {
+  Files       uint32  `json:"files"`       // files in the map
+  Loaded      int     `json:"loaded"`      // files in memory
+  Dirty       int     `json:"dirty"`       // files with unsaved changes
+  Hits        uint64  `json:"hits"`        // lookups of a file already in memory
+  Misses      uint64  `json:"misses"`      // lookups that loaded the file from disk
+  Evictions   uint64  `json:"evictions"`
+  Saves       uint64  `json:"saves"`       // files written
+  SaveErrors  uint64  `json:"saveErrors"`
 }
 
 func NewChunker(info WorldInfo) *Chunker {
   var c Chunker
   c.access = make([]int64, info.NumFiles)
   c.files = make(map[uint16][]byte)
+  c.dirty = make(map[uint16]uint64)
   c.info = info
   c.writer = zlib.NewWriter(nil)
 
@@ -29,12 +49,10 @@ func NewChunker(info WorldInfo) *Chunker {
 }
 
 func (c *Chunker) GetChunk(chunkId, fileId uint16) []byte {
-  file := c.files[fileId]
-  if file == nil {
-    file = c.loadFile(fileId)
-  }
+  c.lock.Lock()
+  defer c.lock.Unlock()
 
-  c.access[fileId] = helpers.NowMillis()
+  file := c.getFile(fileId)
 
   chunkStart := (uint32(chunkId) - (uint32(fileId) * c.info.ChunksPerFile)) * c.info.BlocksPerChunk
   chunkEnd := chunkStart + c.info.BlocksPerChunk
@@ -48,24 +66,219 @@ func (c *Chunker) GetChunk(chunkId, fileId uint16) []byte {
   return buf.Bytes()
 }
 
+// Block coordinates are in world space.
+func (c *Chunker) GetBlock(x, y uint32) BlockType {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+
+  fileId, idx := c.locate(x, y)
+  return BlockType(c.getFile(fileId)[idx])
+}
+
+// Modifies a block in memory and marks its file dirty.
+// Dirty files are written back to disk by Save.
+func (c *Chunker) SetBlock(x, y uint32, t BlockType) {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+
+  fileId, idx := c.locate(x, y)
+  file := c.getFile(fileId)
+  if file[idx] != byte(t) {
+    file[idx] = byte(t)
+    c.dirty[fileId]++
+  }
+}
+
+// Writes every dirty file back to disk. A file stays dirty
+// until its write succeeds, and after that if it changed
+// while being written.
+// Each file is written to a temporary file and renamed
+// over the original so a crash never leaves a partial file.
+func (c *Chunker) Save() error {
+  c.lock.Lock()
+  pending := make(map[uint16][]byte, len(c.dirty))
+  changes := make(map[uint16]uint64, len(c.dirty))
+  for fileId, n := range c.dirty {
+    pending[fileId] = append([]byte{}, c.files[fileId]...)
+    changes[fileId] = n
+  }
+  c.lock.Unlock()
+
+  var firstErr error
+  for fileId, data := range pending {
+    err := writeFileAtomic(c.fileName(fileId), data)
+    if err != nil {
+      chunkerLog.Error("failed to save file", "map", c.info.Name, "file", fileId, "err", err)
+
+      // still dirty, tried again next time
+      c.lock.Lock()
+      c.stats.SaveErrors++
+      c.lock.Unlock()
+
+      if firstErr == nil {
+        firstErr = err
+      }
+      continue
+    }
+    chunkerLog.Debug("saved file", "map", c.info.Name, "file", fileId)
+    c.lock.Lock()
+    c.stats.Saves++
+    if c.dirty[fileId] == changes[fileId] {
+      delete(c.dirty, fileId)
+    }
+    c.lock.Unlock()
+  }
+
+  return firstErr
+}
+
+// Drops files from memory that have not been accessed since
+// the given time. Files with unsaved modifications are kept.
+func (c *Chunker) Evict(before int64) {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+
+  for fileId := range c.files {
+    if c.dirty[fileId] == 0 && c.access[fileId] < before {
+      delete(c.files, fileId)
+      c.stats.Evictions++
+      chunkerLog.Debug("evicted file", "map", c.info.Name, "file", fileId)
+    }
+  }
+}
+
+func (c *Chunker) Stats() ChunkerStats {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+
+  stats := c.stats
+  stats.Files = c.info.NumFiles
+  stats.Loaded = len(c.files)
+  stats.Dirty = len(c.dirty)
+  return stats
+}
+
+// Exposes Stats, read on each scrape.
+func (c *Chunker) RegisterMetrics(r *metrics.Registry) {
+  r.GaugeFunc("space_map_files_loaded", "Map files in memory.", func() float64 { return float64(c.Stats().Loaded) })
+  r.GaugeFunc("space_map_files_dirty", "Map files with unsaved changes.", func() float64 { return float64(c.Stats().Dirty) })
+  r.CounterFunc("space_map_hits_total", "Lookups of a map file already in memory.", func() uint64 { return c.Stats().Hits })
+  r.CounterFunc("space_map_misses_total", "Lookups that loaded a map file from disk.", func() uint64 { return c.Stats().Misses })
+  r.CounterFunc("space_map_evictions_total", "Map files dropped from memory.", func() uint64 { return c.Stats().Evictions })
+  r.CounterFunc("space_map_saves_total", "Map files written.", func() uint64 { return c.Stats().Saves })
+  r.CounterFunc("space_map_save_errors_total", "Map files that failed to write.", func() uint64 { return c.Stats().SaveErrors })
+}
+
+func (c *Chunker) IsDirty() bool {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+  return len(c.dirty) > 0
+}
+
+// Translates a block coordinate in world space
+// to a file id and an index into that file.
+func (c *Chunker) locate(x, y uint32) (fileId uint16, idx uint32) {
+  chunkId := (y / c.info.ChunkSize) * c.info.Size + (x / c.info.ChunkSize)
+  fileId = uint16(chunkId / c.info.ChunksPerFile)
+
+  blockX := x % c.info.ChunkSize
+  blockY := y % c.info.ChunkSize
+  idx = (chunkId % c.info.ChunksPerFile) * c.info.BlocksPerChunk
+  idx += blockY * c.info.ChunkSize + blockX
+  return
+}
+
+// Must be called with the lock held.
+func (c *Chunker) getFile(fileId uint16) []byte {
+  file := c.files[fileId]
+  if file == nil {
+    c.stats.Misses++
+    file = c.loadFile(fileId)
+  } else {
+    c.stats.Hits++
+  }
+
+  c.access[fileId] = helpers.NowMillis()
+
+  return file
+}
+
+func (c *Chunker) fileName(fileId uint16) string {
+  return filepath.Join(c.info.Dir, fmt.Sprintf("%03d.chunks", fileId))
+}
+
 func (c *Chunker) loadFile(fileId uint16) []byte {
-  log.Printf("Loading file %s/%03d", c.info.Name, fileId)
-  fileName := fmt.Sprintf("assets/%s/%03d.chunks", c.info.Name, fileId)
-  file, err := os.Open(fileName)
+  chunkerLog.Debug("loading file", "map", c.info.Name, "file", fileId)
+  var err error
+  c.files[fileId], err = ReadChunkFile(c.fileName(fileId))
   if err != nil {
     panic(err)
   }
+
+  return c.files[fileId]
+}
+
+// Reads and decompresses a NNN.chunks file.
+func ReadChunkFile(fileName string) ([]byte, error) {
+  file, err := os.Open(fileName)
+  if err != nil {
+    return nil, err
+  }
   defer file.Close()
 
-  zr, errz := zlib.NewReader(file)
-  if errz != nil {
-    panic(err)
+  zr, err := zlib.NewReader(file)
+  if err != nil {
+    return nil, err
+  }
+  defer zr.Close()
+
+  return ioutil.ReadAll(zr)
+}
+
+// Temp files are created 0600, so the result takes the mode
+// of the file it replaces, or 0644 for a new one.
+func writeFileAtomic(fileName string, data []byte) error {
+  mode := os.FileMode(0644)
+  if stat, err := os.Stat(fileName); err == nil {
+    mode = stat.Mode().Perm()
   }
 
-  c.files[fileId], err = ioutil.ReadAll(zr)
+  dir := filepath.Dir(fileName)
+  tmp, err := ioutil.TempFile(dir, filepath.Base(fileName) + ".tmp")
   if err != nil {
-    panic(err)
+    return err
   }
+  tmpName := tmp.Name()
 
-  return c.files[fileId]
+  zw := zlib.NewWriter(tmp)
+  _, err = zw.Write(data)
+  if err == nil {
+    err = zw.Close()
+  }
+  if err == nil {
+    err = tmp.Chmod(mode)
+  }
+  if err == nil {
+    err = tmp.Sync()
+  }
+  if errClose := tmp.Close(); err == nil {
+    err = errClose
+  }
+  if err != nil {
+    os.Remove(tmpName)
+    return err
+  }
+
+  if err = os.Rename(tmpName, fileName); err != nil {
+    os.Remove(tmpName)
+    return err
+  }
+
+  // make the rename itself durable
+  d, err := os.Open(dir)
+  if err != nil {
+    return err
+  }
+  defer d.Close()
+  return d.Sync()
 }
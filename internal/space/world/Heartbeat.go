@@ -0,0 +1,63 @@
+package world
+
+import(
+  "sync/atomic"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/util"
+)
+
+// When a player last answered a PING and how long it took,
+// both in milliseconds. Written by Pong, read by Ping and admin.
+type heartbeat struct {
+  lastPong  int64
+  rtt       int64
+}
+
+// Round trip of the last answered PING in milliseconds, 0 until
+// there is one. PINGs skip the queue, so this is the connection's.
+func (p *WorldPlayer) GetRtt() int64 {
+  return atomic.LoadInt64(&p.heartbeat.rtt)
+}
+
+// PING every connected player and return those who haven't
+// answered one in PING_TIMEOUT seconds. PINGs go out ahead
+// of queued messages so the rtt doesn't count the queue.
+func (w *World) Ping(now int64) []uuid.UUID {
+  timeout := int64(helpers.GetConfig().PING_TIMEOUT) * 1000
+  ping := &msg.PingMsg{Time: now}
+
+  late := []uuid.UUID{}
+  for _, plr := range w.players.List() {
+    if now - atomic.LoadInt64(&plr.heartbeat.lastPong) > timeout {
+      late = append(late, plr.Tcp.Id)
+      continue
+    }
+
+    if plr.Tcp.GetState() < tcp.CONNECTED {
+      continue
+    }
+    if err := plr.Tcp.SendNow(ping); err != nil {
+      logger.Debug("ping failed", "player", plr.Tcp.Id, "err", err)
+    }
+  }
+  return late
+}
+
+// Record a player's PONG. Any PONG shows they're there, only
+// one echoing a PING we could have sent updates their rtt.
+func (w *World) Pong(id uuid.UUID, m *msg.PongMsg) {
+  plr := w.players.GetPlayer(id)
+  if plr == nil {
+    return
+  }
+
+  now := helpers.NowMillis()
+  atomic.StoreInt64(&plr.heartbeat.lastPong, now)
+  if rtt := now - m.Time; rtt >= 0 && rtt <= int64(helpers.GetConfig().PING_TIMEOUT) * 1000 {
+    atomic.StoreInt64(&plr.heartbeat.rtt, rtt)
+  }
+}
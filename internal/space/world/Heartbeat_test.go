@@ -0,0 +1,52 @@
+package world
+
+import(
+  "testing"
+
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/util"
+)
+
+// Players without a PONG for PING_TIMEOUT seconds come back
+// from Ping, everyone else gets a PING ahead of their queue.
+func TestPingTimeout(t *testing.T) {
+  config := helpers.DefaultConfig()
+  config.PING_TIMEOUT = 30
+  helpers.SetConfig(&config)
+
+  var p WorldPlayers
+  w := &World{players: &p}
+  quiet, _ := addPlayer(t, &p, "Quiet")
+  live, liveEnd := addPlayer(t, &p, "Live")
+  quiet.Tcp.Connected()
+  live.Tcp.Connected()
+
+  now := helpers.NowMillis()
+  quiet.heartbeat.lastPong = now - 31000
+  live.heartbeat.lastPong = now - 29000
+
+  late := w.Ping(now)
+  if len(late) != 1 || late[0] != quiet.Tcp.Id {
+    t.Fatalf("late %v, want only %s", late, quiet.Tcp.Id)
+  }
+
+  frame := recvMsg(t, liveEnd)
+  if tcp.TCPCmd(frame[0]) != tcp.PING {
+    t.Fatalf("got cmd %d, want PING", frame[0])
+  }
+  var ping msg.PingMsg
+  ping.Deserialize(frame, 0)
+  if ping.Time != now {
+    t.Fatalf("PING time %d, want %d", ping.Time, now)
+  }
+
+  // answering counts, and the rtt comes from the echoed time
+  w.Pong(quiet.Tcp.Id, &msg.PongMsg{Time: helpers.NowMillis() - 40})
+  if late = w.Ping(helpers.NowMillis()); len(late) != 0 {
+    t.Fatalf("late %v after answering", late)
+  }
+  if rtt := quiet.GetRtt(); rtt < 40 || rtt > 1000 {
+    t.Fatalf("rtt %d, want about 40", rtt)
+  }
+}
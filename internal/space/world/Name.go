@@ -0,0 +1,77 @@
+package world
+
+import(
+  "errors"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/world/msg"
+)
+
+// Display names are 3 to 16 letters, digits, spaces and -_.
+// without spaces at either end or two in a row, and unique
+// among online players ignoring case. DEFAULT_NAME_PREFIX is
+// kept for players who didn't pick one.
+const MIN_NAME_LEN int = 3
+const MAX_NAME_LEN int = 16
+const DEFAULT_NAME_PREFIX string = "pilot-"
+
+var ErrNameLength = errors.New("name: must be 3 to 16 characters")
+var ErrNameChars = errors.New("name: only letters, digits, single spaces and -_. allowed")
+var ErrNameTaken = errors.New("name: taken by another player")
+var ErrNameReserved = errors.New("name: pilot- names are for players without one")
+
+func ValidateName(name string) error {
+  n := utf8.RuneCountInString(name)
+  if n < MIN_NAME_LEN || n > MAX_NAME_LEN || len(name) > msg.MAX_NAME_BYTES {
+    return ErrNameLength
+  }
+  if strings.HasPrefix(name, " ") || strings.HasSuffix(name, " ") || strings.Contains(name, "  ") {
+    return ErrNameChars
+  }
+  if strings.HasPrefix(strings.ToLower(name), DEFAULT_NAME_PREFIX) {
+    return ErrNameReserved
+  }
+  for _, r := range name {
+    if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -_.", r) {
+      return ErrNameChars
+    }
+  }
+  return nil
+}
+
+// What a player may be called until they pick a name, shortest
+// first. Only these start with the prefix so only they can collide,
+// and the whole id can't.
+func defaultNames(id uuid.UUID) []string {
+  hex := strings.ReplaceAll(id.String(), "-", "")
+  return []string{DEFAULT_NAME_PREFIX + hex[:8], DEFAULT_NAME_PREFIX + hex[:16], DEFAULT_NAME_PREFIX + hex}
+}
+
+// Change a player's name from their PLAYER_UPDATE and tell everyone.
+// Errors are told to the player as a system chat message.
+func (w *World) Rename(id uuid.UUID, name string) error {
+  plr := w.players.GetPlayer(id)
+  if plr == nil {
+    return ErrChatNoTarget
+  }
+
+  err := ValidateName(name)
+  if err == nil {
+    err = w.players.Rename(plr, name)
+  }
+  if err != nil {
+    w.SystemChat(id, err.Error())
+    return err
+  }
+
+  var updateMsg msg.PlayerUpdateMsg
+  updateMsg.Id = id
+  updateMsg.Name = name
+  w.players.PushAll(&updateMsg)
+  logger.Info("renamed", "player", id, "name", name)
+  return nil
+}
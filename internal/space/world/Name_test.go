@@ -0,0 +1,206 @@
+package world
+
+import(
+  "time"
+  "testing"
+  "strings"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/snet/transport"
+  "go-space-serv/internal/space/world/msg"
+)
+
+// A player added as name, with the client's end of their connection.
+func addPlayer(t *testing.T, p *WorldPlayers, name string) (*WorldPlayer, *transport.PipeEnd) {
+  worldEnd, clientEnd := transport.Pipe("world", "client")
+  t.Cleanup(func() { clientEnd.Close() })
+
+  plr, err := p.Add(tcp.NewPlayer(nil, worldEnd, uuid.New(), nil, nil), 0, name)
+  if err != nil {
+    t.Fatalf("add %q: %s", name, err)
+  }
+  return plr, clientEnd
+}
+
+func TestValidateName(t *testing.T) {
+  cases := map[string]error{
+    "Ace": nil,
+    "red leader-1.b_": nil,
+    "Zoë": nil,
+    "pilot me": nil,
+    "ab": ErrNameLength,
+    "seventeen chars!!": ErrNameLength,
+    " ace": ErrNameChars,
+    "ace ": ErrNameChars,
+    "a  ce": ErrNameChars,
+    "ace!": ErrNameChars,
+    "pilot-0b5e5a53": ErrNameReserved,
+    "PILOT-me": ErrNameReserved,
+  }
+  for name, want := range cases {
+    if err := ValidateName(name); err != want {
+      t.Errorf("%q: got %v, want %v", name, err, want)
+    }
+  }
+}
+
+// A name from LOGIN that can't be had leaves the player a default one.
+func TestAddClaimsLoginName(t *testing.T) {
+  var p WorldPlayers
+  ace, _ := addPlayer(t, &p, "Ace")
+  if ace.GetName() != "Ace" {
+    t.Fatalf("got %q, want Ace", ace.GetName())
+  }
+
+  cases := map[string]error{
+    "": nil,
+    "ACE": ErrNameTaken,
+    "pilot-1": ErrNameReserved,
+    "!!": ErrNameLength,
+  }
+  for name, want := range cases {
+    plr, err := p.Add(tcp.NewPlayer(nil, nil, uuid.New(), nil, nil), 0, name)
+    if err != want {
+      t.Errorf("%q: got %v, want %v", name, err, want)
+    }
+    if got := plr.GetName(); !strings.HasPrefix(got, DEFAULT_NAME_PREFIX) {
+      t.Errorf("%q: joined as %q, want a default name", name, got)
+    }
+  }
+
+  if p.Count() != 5 {
+    t.Fatalf("count %d, want 5", p.Count())
+  }
+}
+
+// Ids starting alike get longer default names instead of taking each other's.
+func TestDefaultNamesDontCollide(t *testing.T) {
+  var p WorldPlayers
+  a := uuid.MustParse("0b5e5a53-1c7e-4c0e-9d55-6f1a2b3c4d5e")
+  b := uuid.MustParse("0b5e5a53-1c7e-4c0e-8d55-6f1a2b3c4d5e")
+  c := uuid.MustParse("0b5e5a53-1c7e-4c0e-7d55-6f1a2b3c4d5e")
+
+  names := map[string]bool{}
+  for _, id := range []uuid.UUID{a, b, c} {
+    name, err := p.claimName(id, "")
+    if err != nil {
+      t.Fatal(err)
+    }
+    if names[name] {
+      t.Fatalf("%s got %s twice", id, name)
+    }
+    names[name] = true
+    if p.names[name] != id {
+      t.Fatalf("%s not claimed by %s", name, id)
+    }
+  }
+  if !names["pilot-0b5e5a53"] || !names["pilot-0b5e5a531c7e4c0e"] || !names["pilot-0b5e5a531c7e4c0e7d556f1a2b3c4d5e"] {
+    t.Fatalf("unexpected names %v", names)
+  }
+}
+
+func TestRename(t *testing.T) {
+  var p WorldPlayers
+  ace, _ := addPlayer(t, &p, "Ace")
+  other, _ := addPlayer(t, &p, "")
+  defaultName := other.GetName()
+
+  if err := p.Rename(other, "aCE"); err != ErrNameTaken {
+    t.Fatalf("took a name in use: %v", err)
+  }
+  if other.GetName() != defaultName {
+    t.Fatalf("renamed to %q after being refused", other.GetName())
+  }
+
+  // changing case of your own name is fine
+  if err := p.Rename(ace, "ACE"); err != nil {
+    t.Fatal(err)
+  }
+  if err := p.Rename(ace, "Bolt"); err != nil {
+    t.Fatal(err)
+  }
+
+  // the old names are free again
+  if err := p.Rename(other, "ace"); err != nil {
+    t.Fatalf("old name not freed: %v", err)
+  }
+  if _, held := p.names[defaultName]; held {
+    t.Fatalf("%s still held after renaming", defaultName)
+  }
+
+  // leaving frees only what the player holds
+  p.Remove(ace.Tcp.Id)
+  if p.names["ace"] != other.Tcp.Id {
+    t.Fatalf("leaving took another player's name")
+  }
+  if _, held := p.names["bolt"]; held {
+    t.Fatalf("bolt still held after leaving")
+  }
+}
+
+// The first message after framing, or a failure after a second.
+func recvMsg(t *testing.T, end *transport.PipeEnd) []byte {
+  got := make(chan []byte, 1)
+  go func() {
+    frame, err := end.Recv()
+    if err == nil {
+      got <- frame
+    }
+  }()
+
+  select {
+    case frame := <-got:
+      return frame[2:]
+    case <-time.After(time.Second):
+      t.Fatalf("nothing sent")
+      return nil
+  }
+}
+
+// Everyone connected hears of a new player and the new player
+// of them, without waiting on a full queue.
+func TestAnnounce(t *testing.T) {
+  var p WorldPlayers
+  ace, aceEnd := addPlayer(t, &p, "Ace")
+  ace.Tcp.Connected()
+
+  // not connected yet, and too slow to take anything
+  newbie, _ := addPlayer(t, &p, "Newbie")
+  for len(newbie.Tcp.Outgoing) < cap(newbie.Tcp.Outgoing) {
+    newbie.Tcp.Outgoing <- &msg.ShutdownMsg{}
+  }
+
+  done := make(chan struct{})
+  go func() {
+    p.Announce(newbie)
+    close(done)
+  }()
+  select {
+    case <-done:
+    case <-time.After(time.Second):
+      t.Fatalf("announce waited on a full queue")
+  }
+
+  frame := recvMsg(t, aceEnd)
+  if tcp.TCPCmd(frame[0]) != tcp.JOIN {
+    t.Fatalf("got cmd %d, want JOIN", frame[0])
+  }
+  var join msg.PlayerJoinMsg
+  join.Deserialize(frame, 0)
+  if join.Id != newbie.Tcp.Id || join.Name != "Newbie" {
+    t.Fatalf("joined %s %q, want %s Newbie", join.Id, join.Name, newbie.Tcp.Id)
+  }
+
+  // with room, the new player hears of everyone connected
+  late, _ := addPlayer(t, &p, "Late")
+  p.Announce(late)
+  if len(late.Tcp.Outgoing) != 1 {
+    t.Fatalf("late got %d messages, want a JOIN for Ace only", len(late.Tcp.Outgoing))
+  }
+  exist := (<-late.Tcp.Outgoing).(*msg.PlayerJoinMsg)
+  if exist.Id != ace.Tcp.Id || exist.Name != "Ace" {
+    t.Fatalf("late heard of %s %q, want Ace", exist.Id, exist.Name)
+  }
+}
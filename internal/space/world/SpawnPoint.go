@@ -0,0 +1,29 @@
+package world
+
+import(
+  "encoding/binary"
+)
+
+// A cell known to be clear of blocks,
+// found by gen and stored in meta.chunks.
+type SpawnPoint struct {
+  Team  byte
+  X     uint32
+  Y     uint32
+}
+
+const spawnPointSize int = 9
+
+func serializeSpawnPoint(sp SpawnPoint, data []byte) {
+  data[0] = sp.Team
+  binary.LittleEndian.PutUint32(data[1:5], sp.X)
+  binary.LittleEndian.PutUint32(data[5:9], sp.Y)
+}
+
+func deserializeSpawnPoint(data []byte) SpawnPoint {
+  var sp SpawnPoint
+  sp.Team = data[0]
+  sp.X = binary.LittleEndian.Uint32(data[1:5])
+  sp.Y = binary.LittleEndian.Uint32(data[5:9])
+  return sp
+}
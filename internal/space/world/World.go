@@ -1,30 +1,44 @@
 package world
 
 import(
-  "log"
+  "fmt"
   "net"
+  "sync"
 
   "github.com/google/uuid"
 
   "go-space-serv/internal/space/world/msg"
-  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/link"
+  "go-space-serv/internal/space/metrics"
+  "go-space-serv/internal/space/util"
 )
 
+var logger = helpers.Logger("world")
+
 type World struct {
+  chatDrops uint64    // atomic, chat messages players' full queues refused
   worldMap *WorldMap
   players  *WorldPlayers
-  bodyToPlayer map[uint16]uuid.UUID
+  bodyToPlayer map[bodyKey]uuid.UUID
+  bodyLock sync.Mutex
+  chatFilter ChatFilter
+}
+
+// Body ids are only unique within one SIM.
+type bodyKey struct {
+  sim uint16
+  body uint16
 }
 
-func NewWorld(wp *WorldPlayers, mapName string) (*World, error) {
+func NewWorld(wp *WorldPlayers, mapPath string) (*World, error) {
   var wld World
   wld.players = wp
-  wm, err := NewWorldMap(mapName)
+  wm, err := NewWorldMap(mapPath)
   if err != nil {
     return nil, err
   }
   wld.worldMap = wm
-  wld.bodyToPlayer = make(map[uint16]uuid.UUID)
+  wld.bodyToPlayer = make(map[bodyKey]uuid.UUID)
   return &wld, nil
 }
 
@@ -33,6 +47,7 @@ func (w *World) PlayerJoin(plr *WorldPlayer, physIp net.IP, physPort uint32) {
   var playerInfoMsg msg.PlayerInfoMsg
   playerInfoMsg.Id = plr.Tcp.Id
   playerInfoMsg.Stats = plr.Stats
+  playerInfoMsg.Name = plr.GetName()
   plr.Tcp.Outgoing <- &playerInfoMsg
 
   // Tell this client about the world
@@ -44,6 +59,27 @@ func (w *World) PlayerJoin(plr *WorldPlayer, physIp net.IP, physPort uint32) {
   simInfoMsg.Ip = physIp
   simInfoMsg.Port = physPort
   plr.Tcp.Outgoing <- &simInfoMsg
+
+  w.players.Announce(plr)
+}
+
+// Team for a new player: the one with spawn points and the
+// fewest players online, the first of those on a tie.
+func (w *World) PickTeam() byte {
+  counts := make(map[byte]int)
+  w.players.playerMap.Range(func(key, value interface{}) bool {
+    counts[value.(*WorldPlayer).Team]++
+    return true
+  })
+
+  teams := w.worldMap.Teams()
+  best := teams[0]
+  for _, team := range teams[1:] {
+    if counts[team] < counts[best] {
+      best = team
+    }
+  }
+  return best
 }
 
 func (w *World) PlayerLeave(id uuid.UUID) {
@@ -55,37 +91,149 @@ func (w *World) PlayerLeave(id uuid.UUID) {
   w.players.PushAll(&leaveMsg)
 }
 
-func (w *World) InterpretPhysics(bytes []byte) {
-  if bytes[0] == byte(snet.ISpawn) {
-    bodyId := snet.Read_uint16(bytes[1:3])
-    playerId, err := uuid.FromBytes(bytes[3:19])
-    if err == nil {
-      w.bodyToPlayer[bodyId] = playerId
-      log.Printf("%v spawned", playerId)
-    }
-  } else if bytes[0] == byte(snet.ISpec) {
-    bodyId := snet.Read_uint16(bytes[1:3])
-    log.Printf("%v specced", w.bodyToPlayer[bodyId])
-    delete(w.bodyToPlayer, bodyId)
-  } else if bytes[0] == byte(snet.IState) {
-    head := 1
-    l := len(bytes)
-    for head < l {
-      bodyId, x, y := deserializeState(bytes[head:head+6])
-      head += 6
-
-      plr := w.players.GetPlayer(w.bodyToPlayer[bodyId])
-      if plr != nil {
-        // TODO: update position and do polygon boolean stuff
-        plr.Update(x, y, w.worldMap)
+// Tell these clients their simulation went away.
+func (w *World) PhysicsLost(ids []uuid.UUID) {
+  var lostMsg msg.SimLostMsg
+  for _, id := range ids {
+    w.players.Push(id, &lostMsg)
+  }
+}
+
+// Tell these clients where their simulation is now.
+func (w *World) PhysicsMoved(ids []uuid.UUID, physIp net.IP, physPort uint32) {
+  var simInfoMsg msg.SimInfoMsg
+  simInfoMsg.Ip = physIp
+  simInfoMsg.Port = physPort
+  for _, id := range ids {
+    w.players.Push(id, &simInfoMsg)
+  }
+}
+
+// Tell every client WORLD is going away.
+func (w *World) Shutdown() {
+  var shutdownMsg msg.ShutdownMsg
+  w.players.PushAll(&shutdownMsg)
+}
+
+// Server message shown to every client.
+func (w *World) Broadcast(text string) {
+  var broadcastMsg msg.BroadcastMsg
+  broadcastMsg.Text = text
+  w.players.PushAll(&broadcastMsg)
+}
+
+func (w *World) MapStats() ChunkerStats {
+  return w.worldMap.ChunkerStats()
+}
+
+func (w *World) RegisterMetrics(r *metrics.Registry) {
+  r.GaugeFunc("space_world_players", "Players connected to WORLD.", func() float64 { return float64(w.players.Count()) })
+  r.GaugeFunc("space_tcp_outgoing_queue", "TCP messages queued for all players.", func() float64 { return float64(w.players.Pending()) })
+  r.CounterFunc("space_world_chat_dropped_total", "Chat messages dropped because a player's queue was full.", func() uint64 { return w.ChatDropped() })
+  w.worldMap.chunker.RegisterMetrics(r)
+}
+
+// Cell new players of team are expected to appear in.
+func (w *World) SpawnCell(team byte) (x, y int) {
+  return w.worldMap.DefaultSpawnCell(team)
+}
+
+func (w *World) CellFromPosition(x, y float32) (int, int) {
+  return w.worldMap.GetCellFromPosition(x, y)
+}
+
+// Persist modified terrain.
+func (w *World) Save() error {
+  return w.worldMap.Save()
+}
+
+// Unload map files nobody has looked at since before (unix millis).
+func (w *World) Evict(before int64) {
+  w.worldMap.Evict(before)
+}
+
+func (w *World) InterpretPhysics(sim uint16, m link.LinkMsg) {
+  switch t := m.(type) {
+    case *link.SpawnMsg:
+      w.bodyLock.Lock()
+      w.bodyToPlayer[bodyKey{sim, t.BodyId}] = t.PlayerId
+      w.bodyLock.Unlock()
+      logger.Info("spawned", "player", t.PlayerId, "body", t.BodyId, "sim", sim)
+    case *link.SpecMsg:
+      w.bodyLock.Lock()
+      logger.Info("specced", "player", w.bodyToPlayer[bodyKey{sim, t.BodyId}], "body", t.BodyId, "sim", sim)
+      delete(w.bodyToPlayer, bodyKey{sim, t.BodyId})
+      w.bodyLock.Unlock()
+    case *link.StateMsg:
+      for _, b := range t.Bodies {
+        w.bodyLock.Lock()
+        playerId := w.bodyToPlayer[bodyKey{sim, b.Id}]
+        w.bodyLock.Unlock()
+
+        plr := w.players.GetPlayer(playerId)
+        if plr != nil {
+          // TODO: update position and do polygon boolean stuff
+          plr.Update(b.X, b.Y, w.worldMap)
+        }
       }
+    case *link.CameraMsg:
+      // spectators get chunks around what they watch
+      for _, c := range t.Cameras {
+        plr := w.players.GetPlayer(c.PlayerId)
+        if plr != nil {
+          plr.Update(c.X, c.Y, w.worldMap)
+        }
+      }
+    default:
+      logger.Warn("unexpected msg from physics", "type", fmt.Sprintf("%T", m), "sim", sim)
+  }
+}
+
+// Replace what we know about one SIM's bodies with what it
+// reports after its link comes back, or add to it for a
+// continued sync. Returns players it has that are no longer
+// connected here.
+func (w *World) Resync(sim uint16, m *link.SyncMsg) []uuid.UUID {
+  w.bodyLock.Lock()
+  if !m.Continued {
+    for key := range w.bodyToPlayer {
+      if key.sim == sim {
+        delete(w.bodyToPlayer, key)
+      }
+    }
+  }
+  for _, b := range m.Bodies {
+    w.bodyToPlayer[bodyKey{sim, b.BodyId}] = b.PlayerId
+  }
+  w.bodyLock.Unlock()
+
+  gone := []uuid.UUID{}
+  for _, id := range m.Players {
+    if w.players.GetPlayer(id) == nil {
+      gone = append(gone, id)
     }
   }
+  return gone
 }
 
-func deserializeState(bytes []byte) (id, x, y uint16) {
-  id = snet.Read_uint16(bytes[:2])
-  x = snet.Read_uint16(bytes[2:4])
-  y = snet.Read_uint16(bytes[4:6])
-  return
+// Drop every body on a sim that is gone for good.
+func (w *World) ForgetSim(sim uint16) {
+  w.bodyLock.Lock()
+  for key := range w.bodyToPlayer {
+    if key.sim == sim {
+      delete(w.bodyToPlayer, key)
+    }
+  }
+  w.bodyLock.Unlock()
+}
+
+// Drop the player's bodies on sim after it was handed off.
+func (w *World) ForgetBodies(sim uint16, playerId uuid.UUID) {
+  w.bodyLock.Lock()
+  for key, id := range w.bodyToPlayer {
+    if key.sim == sim && id == playerId {
+      delete(w.bodyToPlayer, key)
+    }
+  }
+  w.bodyLock.Unlock()
 }
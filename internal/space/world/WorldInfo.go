@@ -1,8 +1,10 @@
 package world
 
 import(
+  "os"
   "fmt"
   "math"
+  "errors"
   "encoding/binary"
 )
 
@@ -16,13 +18,23 @@ type WorldInfo struct {
   NumFiles        uint32
   Seed            uint64
   Threshold       float64
+  SpawnPoints     []SpawnPoint
 
   // Not serialized
   Name            string
+  Dir             string
+}
+
+type MapIdentity struct {
+  Name        string
+  Dir         string
+  Seed        uint64
+  Size        uint32
+  Fingerprint uint64
 }
 
 func SerializeWorldInfo(info WorldInfo) []byte {
-  result := make([]byte, 40)
+  result := make([]byte, 42 + len(info.SpawnPoints) * spawnPointSize)
 
   binary.LittleEndian.PutUint32(result[:4], info.ChunksPerFile)
   binary.LittleEndian.PutUint32(result[4:8], info.ChunkSize)
@@ -32,6 +44,13 @@ func SerializeWorldInfo(info WorldInfo) []byte {
   binary.LittleEndian.PutUint32(result[20:24], info.NumFiles)
   binary.LittleEndian.PutUint64(result[24:32], info.Seed)
   binary.LittleEndian.PutUint64(result[32:40], math.Float64bits(info.Threshold))
+  binary.LittleEndian.PutUint16(result[40:42], uint16(len(info.SpawnPoints)))
+
+  head := 42
+  for _, sp := range info.SpawnPoints {
+    serializeSpawnPoint(sp, result[head:head+spawnPointSize])
+    head += spawnPointSize
+  }
 
   return result
 }
@@ -48,9 +67,48 @@ func DeserializeWorldInfo(data []byte) WorldInfo {
   result.Seed = binary.LittleEndian.Uint64(data[24:32])
   result.Threshold = math.Float64frombits(binary.LittleEndian.Uint64(data[32:40]))
 
+  // maps generated before spawn points existed stop here.
+  if len(data) >= 42 {
+    count := int(binary.LittleEndian.Uint16(data[40:42]))
+    head := 42
+    for i := 0; i < count && head + spawnPointSize <= len(data); i++ {
+      result.SpawnPoints = append(result.SpawnPoints, deserializeSpawnPoint(data[head:head+spawnPointSize]))
+      head += spawnPointSize
+    }
+  }
+
   return result
 }
 
+// Reads and deserializes a meta.chunks file.
+func ReadWorldInfo(fileName string) (WorldInfo, error) {
+  var info WorldInfo
+
+  metaFile, err := os.Open(fileName)
+  if err != nil {
+    return info, err
+  }
+  defer metaFile.Close()
+
+  stat, err := metaFile.Stat()
+  if err != nil {
+    return info, err
+  }
+  metaFileSize := stat.Size()
+  bytes := make([]byte, metaFileSize)
+  bytesRead, err := metaFile.Read(bytes)
+  if err != nil {
+    return info, err
+  }
+
+  if int64(bytesRead) != metaFileSize || bytesRead < 40 {
+    return info, errors.New(fmt.Sprintf("failed to read meta file %d/%d", bytesRead, metaFileSize))
+  }
+
+  info = DeserializeWorldInfo(bytes)
+  return info, nil
+}
+
 func (info WorldInfo) String() string {
   var result string
 
@@ -62,6 +120,7 @@ func (info WorldInfo) String() string {
   result = fmt.Sprintf("%s%d\t\tFiles\n", result, info.NumFiles)
   result = fmt.Sprintf("%s%d\tSeed\n", result, info.Seed)
   result = fmt.Sprintf("%s%f\tThreshold\n", result, info.Threshold)
+  result = fmt.Sprintf("%s%d\t\tSpawn Points\n", result, len(info.SpawnPoints))
 
   return result
 }
@@ -1,15 +1,15 @@
 package world
 
 import (
-  "log"
-  "fmt"
   "math"
-  "os"
-  "errors"
+  "hash/fnv"
+  "math/rand"
+  "path/filepath"
 
   "github.com/akavel/polyclip-go"
 
   "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/snet"
 )
 
 // TODO: move to worldinfo
@@ -25,30 +25,17 @@ type WorldMap struct {
   Poly polyclip.Polygon
 }
 
-func NewWorldMap(name string) (*WorldMap, error) {
-  metaFile, err := os.Open(fmt.Sprintf("assets/%s/meta.chunks", name))
+// dir holds meta.chunks and the chunk files.
+func NewWorldMap(dir string) (*WorldMap, error) {
+  info, err := ReadWorldInfo(filepath.Join(dir, "meta.chunks"))
   if err != nil {
     return nil, err
   }
 
-  stat, err2 := metaFile.Stat()
-  if err != nil {
-    return nil, err2
-  }
-  metaFileSize := stat.Size()
-  bytes := make([]byte, metaFileSize)
-  bytesRead, err3 := metaFile.Read(bytes)
-  if err3 != nil {
-    return nil, err3
-  }
-
-  if int64(bytesRead) != metaFileSize {
-    return nil, errors.New(fmt.Sprintf("failed to read meta file %d/%d", bytesRead, metaFileSize))
-  }
-
   var wm WorldMap
-  wm.info = DeserializeWorldInfo(bytes)
-  wm.info.Name = name
+  wm.info = info
+  wm.info.Name = filepath.Base(dir)
+  wm.info.Dir = dir
   wm.sizeInBlocks = float64(wm.info.Size * wm.info.ChunkSize)
 
   sizeInBlocks := float64(wm.info.Size * wm.info.ChunkSize)
@@ -61,7 +48,7 @@ func NewWorldMap(name string) (*WorldMap, error) {
 
   wm.chunker = NewChunker(wm.info)
 
-  log.Printf("Loaded map %s\n%v\n", name, wm.info)
+  logger.Info("loaded map", "dir", dir, "name", wm.info.Name, "size", wm.info.Size, "files", wm.info.NumFiles)
 
   return &wm, nil
 }
@@ -95,7 +82,7 @@ func (wm *WorldMap) serializeChunk(x, y int, id uint16) msg.BlocksMsg {
 func (wm *WorldMap) Explore(bb polyclip.Rectangle) []msg.BlocksMsg {
   msgs := []msg.BlocksMsg{}
 
-  log.Printf("exploring: %v", bb)
+  logger.Debug("exploring", "rect", bb)
   pY := bb.Min.Y;
   pX := bb.Min.X;
   chunkId := wm.chunkIdFromPoint(polyclip.Point{pX, pY})
@@ -144,7 +131,7 @@ func (wm *WorldMap) ClampToChunks(rect polyclip.Rectangle) polyclip.Rectangle {
     } else if rect.Max.X == wm.sizeInBlocks {
       rect.Min.X -= 128
     } else {
-      log.Printf("Unable to correct x of rectangle %v", rect)
+      logger.Warn("unable to correct x of rectangle", "rect", rect)
     }
   }
 
@@ -158,7 +145,7 @@ func (wm *WorldMap) ClampToChunks(rect polyclip.Rectangle) polyclip.Rectangle {
     } else if rect.Max.Y == wm.sizeInBlocks {
       rect.Min.Y -= 128
     } else {
-      log.Printf("Unable to correct y of rectangle %v", rect)
+      logger.Warn("unable to correct y of rectangle", "rect", rect)
     }
   }
 
@@ -182,6 +169,147 @@ func (wm *WorldMap) GetWorldInfoMsg() msg.WorldInfoMsg {
   return worldInfoMsg
 }
 
-func (wm *WorldMap) GetSpawnPoint() (x, y float32) {
-  return wm.GetCellCenter(int(SPAWNX), int(SPAWNY))
+// Which map this is, to check a recording is replayed on the
+// map it was made on. Fingerprint hashes meta.chunks.
+func (wm *WorldMap) Identity() MapIdentity {
+  var id MapIdentity
+  id.Name = wm.info.Name
+  id.Dir = wm.info.Dir
+  id.Seed = wm.info.Seed
+  id.Size = wm.info.Size
+  hash := fnv.New64a()
+  hash.Write(SerializeWorldInfo(wm.info))
+  id.Fingerprint = hash.Sum64()
+  return id
+}
+
+func (wm *WorldMap) GetBlock(x, y int) BlockType {
+  if !wm.inBounds(x, y) {
+    return EMPTY
+  }
+  return wm.chunker.GetBlock(uint32(x), uint32(y))
+}
+
+func (wm *WorldMap) SetBlock(x, y int, t BlockType) {
+  if !wm.inBounds(x, y) {
+    logger.Warn("set block outside of map", "x", x, "y", y)
+    return
+  }
+  wm.chunker.SetBlock(uint32(x), uint32(y), t)
+}
+
+// Write modified chunks back to disk.
+func (wm *WorldMap) Save() error {
+  return wm.chunker.Save()
+}
+
+// Unload unmodified files that haven't been used since before.
+func (wm *WorldMap) Evict(before int64) {
+  wm.chunker.Evict(before)
+}
+
+func (wm *WorldMap) ChunkerStats() ChunkerStats {
+  return wm.chunker.Stats()
+}
+
+// Whether cell x, y is on the map.
+func (wm *WorldMap) InBounds(x, y int) bool {
+  return wm.inBounds(x, y)
+}
+
+func (wm *WorldMap) inBounds(x, y int) bool {
+  return x >= 0 && y >= 0 && float64(x) < wm.sizeInBlocks && float64(y) < wm.sizeInBlocks
+}
+
+// Teams with spawn points, team 0 alone on maps without any.
+func (wm *WorldMap) Teams() []byte {
+  seen := make(map[byte]bool)
+  teams := []byte{}
+  for _, sp := range wm.info.SpawnPoints {
+    if !seen[sp.Team] {
+      seen[sp.Team] = true
+      teams = append(teams, sp.Team)
+    }
+  }
+  if len(teams) == 0 {
+    teams = append(teams, 0)
+  }
+  return teams
+}
+
+// Picks the team's spawn cell farthest from every occupied cell,
+// preferring cells inside region. Ties go to whichever rng reaches first.
+// Maps without spawn points fall back to SPAWNX/SPAWNY.
+func (wm *WorldMap) PickSpawnPoint(team byte, occupied [][2]int, region snet.Region, rng *rand.Rand) (x, y int) {
+  inRegion := []SpawnPoint{}
+  for _, sp := range wm.info.SpawnPoints {
+    if region.Contains(int(sp.X), int(sp.Y)) {
+      inRegion = append(inRegion, sp)
+    }
+  }
+
+  // nothing here, spawn elsewhere and let the body be handed off.
+  if len(inRegion) == 0 {
+    inRegion = wm.info.SpawnPoints
+  }
+
+  candidates := []SpawnPoint{}
+  for _, sp := range inRegion {
+    if sp.Team == team {
+      candidates = append(candidates, sp)
+    }
+  }
+
+  // no zone for this team, share everyone else's.
+  if len(candidates) == 0 {
+    candidates = inRegion
+  }
+
+  if len(candidates) == 0 {
+    return int(SPAWNX), int(SPAWNY)
+  }
+
+  // start somewhere random so an empty map doesn't
+  // always put the first player in the same place.
+  offset := rng.Intn(len(candidates))
+  best := candidates[offset]
+  bestDist := -1
+
+  for i := range candidates {
+    sp := candidates[(i + offset) % len(candidates)]
+    nearest := math.MaxInt32
+    for _, o := range occupied {
+      dx := int(sp.X) - o[0]
+      dy := int(sp.Y) - o[1]
+      if dist := dx*dx + dy*dy; dist < nearest {
+        nearest = dist
+      }
+    }
+
+    if nearest > bestDist {
+      best = sp
+      bestDist = nearest
+    }
+  }
+
+  return int(best.X), int(best.Y)
+}
+
+func (wm *WorldMap) GetSpawnPoint(team byte, occupied [][2]int, region snet.Region, rng *rand.Rand) (x, y float32) {
+  cellX, cellY := wm.PickSpawnPoint(team, occupied, region, rng)
+  return wm.GetCellCenter(cellX, cellY)
+}
+
+// Where new players of team are most likely to appear,
+// used to choose which SIM they start on.
+func (wm *WorldMap) DefaultSpawnCell(team byte) (x, y int) {
+  for _, sp := range wm.info.SpawnPoints {
+    if sp.Team == team {
+      return int(sp.X), int(sp.Y)
+    }
+  }
+  if len(wm.info.SpawnPoints) > 0 {
+    return int(wm.info.SpawnPoints[0].X), int(wm.info.SpawnPoints[0].Y)
+  }
+  return int(SPAWNX), int(SPAWNY)
 }
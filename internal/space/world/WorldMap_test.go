@@ -0,0 +1,165 @@
+package world
+
+import(
+  "os"
+  "fmt"
+  "testing"
+  "math/rand"
+  "io/ioutil"
+  "path/filepath"
+
+  "go-space-serv/internal/space/snet"
+)
+
+// A 16x16 block map in 4 files of 4 chunks, striped so
+// every block starts out set, written with mode 0640.
+func testMap(t *testing.T) string {
+  dir := t.TempDir()
+
+  var info WorldInfo
+  info.ChunksPerFile = 4
+  info.ChunkSize = 4
+  info.Size = 4
+  info.BlocksPerChunk = info.ChunkSize * info.ChunkSize
+  info.BlocksPerFile = info.BlocksPerChunk * info.ChunksPerFile
+  info.NumFiles = (info.Size * info.Size) / info.ChunksPerFile
+
+  if err := ioutil.WriteFile(filepath.Join(dir, "meta.chunks"), SerializeWorldInfo(info), 0644); err != nil {
+    t.Fatal(err)
+  }
+  for fileId := uint32(0); fileId < info.NumFiles; fileId++ {
+    data := make([]byte, info.BlocksPerFile)
+    for i := range data {
+      data[i] = byte(1 + (i + int(fileId)) % 5)
+    }
+    fileName := filepath.Join(dir, fmt.Sprintf("%03d.chunks", fileId))
+    if err := ioutil.WriteFile(fileName, nil, 0640); err != nil {
+      t.Fatal(err)
+    }
+    if err := writeFileAtomic(fileName, data); err != nil {
+      t.Fatal(err)
+    }
+  }
+  return dir
+}
+
+func mapBlocks(wm *WorldMap) []BlockType {
+  size := int(wm.sizeInBlocks)
+  blocks := make([]BlockType, 0, size * size)
+  for y := 0; y < size; y++ {
+    for x := 0; x < size; x++ {
+      blocks = append(blocks, wm.GetBlock(x, y))
+    }
+  }
+  return blocks
+}
+
+// A saved map loads back exactly as it was left.
+func TestSaveAndReload(t *testing.T) {
+  dir := testMap(t)
+
+  wm, err := NewWorldMap(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  wm.SetBlock(0, 0, EMPTY)
+  wm.SetBlock(5, 9, RED)
+  wm.SetBlock(15, 15, EMPTY)
+  want := mapBlocks(wm)
+
+  if !wm.chunker.IsDirty() {
+    t.Fatalf("nothing dirty after setting blocks")
+  }
+  if err = wm.Save(); err != nil {
+    t.Fatal(err)
+  }
+  if wm.chunker.IsDirty() {
+    t.Fatalf("still dirty after saving")
+  }
+
+  reloaded, err := NewWorldMap(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  got := mapBlocks(reloaded)
+  for i := range want {
+    if got[i] != want[i] {
+      t.Fatalf("block %d,%d: got %s, want %s", i % 16, i / 16, got[i], want[i])
+    }
+  }
+  if got[0] != EMPTY || got[9 * 16 + 5] != RED {
+    t.Fatalf("changes not saved")
+  }
+}
+
+// Saving neither leaves temp files behind nor changes
+// the mode of the files it replaces.
+func TestSaveKeepsFileMode(t *testing.T) {
+  dir := testMap(t)
+
+  wm, err := NewWorldMap(dir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for fileId := uint32(0); fileId < 4; fileId++ {
+    wm.SetBlock(0, int(fileId) * 4, EMPTY)
+  }
+  if err = wm.Save(); err != nil {
+    t.Fatal(err)
+  }
+
+  files, _ := filepath.Glob(filepath.Join(dir, "*"))
+  if len(files) != 5 {
+    t.Fatalf("got files %v, want meta.chunks and 4 chunk files", files)
+  }
+  for fileId := 0; fileId < 4; fileId++ {
+    stat, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%03d.chunks", fileId)))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if stat.Mode().Perm() != 0640 {
+      t.Errorf("file %d has mode %o, want 640", fileId, stat.Mode().Perm())
+    }
+  }
+
+  fileName := filepath.Join(dir, "new.chunks")
+  if err = writeFileAtomic(fileName, []byte{1}); err != nil {
+    t.Fatal(err)
+  }
+  if stat, _ := os.Stat(fileName); stat.Mode().Perm() != 0644 {
+    t.Fatalf("new file has mode %o, want 644", stat.Mode().Perm())
+  }
+}
+
+// The same seed picks the same cells, and a cell
+// next to someone is never picked over an empty one.
+func TestPickSpawnPoint(t *testing.T) {
+  var wm WorldMap
+  for i := uint32(0); i < 8; i++ {
+    wm.info.SpawnPoints = append(wm.info.SpawnPoints, SpawnPoint{Team: 0, X: i * 10, Y: 0})
+  }
+
+  pick := func(seed int64, occupied [][2]int) [][2]int {
+    rng := rand.New(rand.NewSource(seed))
+    picks := [][2]int{}
+    for i := 0; i < 20; i++ {
+      x, y := wm.PickSpawnPoint(0, occupied, snet.WholeMap(), rng)
+      picks = append(picks, [2]int{x, y})
+    }
+    return picks
+  }
+
+  a, b := pick(7, nil), pick(7, nil)
+  for i := range a {
+    if a[i] != b[i] {
+      t.Fatalf("pick %d: %v then %v with the same seed", i, a[i], b[i])
+    }
+  }
+
+  occupied := [][2]int{{0, 0}}
+  for _, p := range pick(7, occupied) {
+    if p != [2]int{70, 0} {
+      t.Fatalf("picked %v, want 70,0 farthest from 0,0", p)
+    }
+  }
+}
@@ -2,7 +2,7 @@ package world
 
 import(
   "github.com/google/uuid"
-  //"go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/world/msg"
   "go-space-serv/internal/space/snet/tcp"
 )
 
@@ -11,6 +11,28 @@ type WorldMsgFactory struct {}
 
 // Create msg, deserialize it, publish it, return new head
 func (mf *WorldMsgFactory) CreateAndPublishMsg(packet []byte, head int, target chan tcp.TCPMsg, playerId uuid.UUID) int {
-  //cmd := tcp.TCPCmd(packet[head])
+  cmd := tcp.TCPCmd(packet[head])
+  if cmd == tcp.CHAT {
+    m := &msg.ChatMsg{}
+    head = m.Deserialize(packet, head)
+    m.SetPlayerId(playerId)
+    target <- m
+  } else if cmd == tcp.PLAYER_UPDATE {
+    m := &msg.PlayerUpdateMsg{}
+    head = m.Deserialize(packet, head)
+    m.SetPlayerId(playerId)
+    target <- m
+  } else if cmd == tcp.LOGIN {
+    m := &msg.LoginMsg{}
+    head = m.Deserialize(packet, head)
+    m.SetPlayerId(playerId)
+    target <- m
+  } else if cmd == tcp.PONG {
+    m := &msg.PongMsg{}
+    head = m.Deserialize(packet, head)
+    m.SetPlayerId(playerId)
+    target <- m
+  }
+
   return head
 }
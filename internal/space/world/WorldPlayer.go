@@ -1,6 +1,7 @@
 package world
 
 import (
+  "sync"
   //"log"
   "github.com/akavel/polyclip-go"
   "github.com/google/uuid"
@@ -12,17 +13,44 @@ type WorldPlayer struct {
   Tcp       *tcp.TCPPlayer
   Stats     player.PlayerStats
   Id        uuid.UUID
-  X         uint16
-  Y         uint16
+  Team      byte      // picked on join, see World.PickTeam
+
+  chatLimit chatLimit
+  heartbeat heartbeat
+  name      string
+  nameLock  sync.Mutex
+  x, y      uint16    // cell, see Position
+  posLock   sync.Mutex
 
   explored  polyclip.Polygon
   view      polyclip.Polygon
 }
 
+func (p *WorldPlayer) GetName() string {
+  p.nameLock.Lock()
+  defer p.nameLock.Unlock()
+  return p.name
+}
+
+func (p *WorldPlayer) setName(name string) {
+  p.nameLock.Lock()
+  p.name = name
+  p.nameLock.Unlock()
+}
+
+// Cell the player was last reported in.
+func (p *WorldPlayer) Position() (x, y uint16) {
+  p.posLock.Lock()
+  defer p.posLock.Unlock()
+  return p.x, p.y
+}
+
 // TODO: make sure the previous update finished first!
 func (p *WorldPlayer) Update(x, y uint16, worldMap *WorldMap) {
-  p.X = x
-  p.Y = y
+  p.posLock.Lock()
+  p.x = x
+  p.y = y
+  p.posLock.Unlock()
 
   doubleX := float64(x)
   doubleY := float64(y)
@@ -2,57 +2,106 @@ package world
 
 import (
   "sync"
-  "log"
+  "strings"
+  "sync/atomic"
 
   "github.com/google/uuid"
 
   "go-space-serv/internal/space/snet/tcp"
   "go-space-serv/internal/space/world/msg"
   "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/util"
 )
 
 type WorldPlayers struct {
-  Count int
+  count int32                   // atomic, see Count
   playerMap sync.Map
+
+  names map[string]uuid.UUID    // lower case name -> player
+  nameLock sync.Mutex
+
+  ships player.Ships            // nil for the built in ship
+  shipLock sync.Mutex
+}
+
+// Ships players joining from now on fly.
+func (p *WorldPlayers) SetShips(ships player.Ships) {
+  p.shipLock.Lock()
+  p.ships = ships
+  p.shipLock.Unlock()
+}
+
+func (p *WorldPlayers) defaultShip() player.PlayerStats {
+  p.shipLock.Lock()
+  defer p.shipLock.Unlock()
+  if stats, ok := p.ships["default"]; ok {
+    return stats
+  }
+  return player.DefaultPlayerStats()
 }
 
-func (p *WorldPlayers) Add(tcpPlr *tcp.TCPPlayer) *WorldPlayer{
+// Adds a player called name, from their LOGIN. An empty name, or one
+// they can't have, gets them a default name, the error says why.
+// Nobody hears of them until Announce.
+func (p *WorldPlayers) Add(tcpPlr *tcp.TCPPlayer, team byte, name string) (*WorldPlayer, error) {
   var plr WorldPlayer
   plr.Tcp = tcpPlr
-  plr.Stats = player.DefaultPlayerStats()
+  plr.Team = team
+  plr.Stats = p.defaultShip()
+  plr.heartbeat.lastPong = helpers.NowMillis()
+
+  var err error
+  plr.name, err = p.claimName(plr.Tcp.Id, name)
 
   _, exists := p.playerMap.LoadOrStore(plr.Tcp.Id, &plr)
   if !exists {
-    p.Count += 1
-
-    var joinMsg msg.PlayerJoinMsg
-    joinMsg.Id = plr.Tcp.Id
-    joinMsg.Stats = plr.Stats
-
-    p.playerMap.Range(func(key, value interface{}) bool {
-      otherPlr := value.(*WorldPlayer)
-      if otherPlr.Tcp.GetState() >= tcp.CONNECTED {
-        if otherPlr.Tcp.Id != plr.Tcp.Id {
-          otherPlr.Tcp.Outgoing <- &joinMsg;
-        } else {
-          var existMsg msg.PlayerJoinMsg
-          existMsg.Id = otherPlr.Tcp.Id
-          existMsg.Stats = otherPlr.Stats
-          plr.Tcp.Outgoing <- &existMsg
-        }
-      }
-      return true
-    })
+    atomic.AddInt32(&p.count, 1)
   }
 
-  return &plr
+  return &plr, err
+}
+
+// Tell everyone about plr and plr about everyone. Players whose
+// queue is full miss the JOIN rather than hold up the caller.
+func (p *WorldPlayers) Announce(plr *WorldPlayer) {
+  var joinMsg msg.PlayerJoinMsg
+  joinMsg.Id = plr.Tcp.Id
+  joinMsg.Stats = plr.Stats
+  joinMsg.Name = plr.GetName()
+
+  p.playerMap.Range(func(key, value interface{}) bool {
+    otherPlr := value.(*WorldPlayer)
+    if otherPlr.Tcp.GetState() >= tcp.CONNECTED && otherPlr.Tcp.Id != plr.Tcp.Id {
+      offer(otherPlr, &joinMsg)
+
+      var existMsg msg.PlayerJoinMsg
+      existMsg.Id = otherPlr.Tcp.Id
+      existMsg.Stats = otherPlr.Stats
+      existMsg.Name = otherPlr.GetName()
+      offer(plr, &existMsg)
+    }
+    return true
+  })
 }
 
 func (p *WorldPlayers) Remove(id uuid.UUID) {
+  if plr := p.GetPlayer(id); plr != nil {
+    p.nameLock.Lock()
+    key := strings.ToLower(plr.GetName())
+    if p.names[key] == id {
+      delete(p.names, key)
+    }
+    p.nameLock.Unlock()
+  }
   p.playerMap.Delete(id)
-  p.Count--
+  atomic.AddInt32(&p.count, -1)
 
-  log.Printf("%s left the world", id)
+  logger.Info("left the world", "player", id)
+}
+
+// Players added and not yet removed.
+func (p *WorldPlayers) Count() int {
+  return int(atomic.LoadInt32(&p.count))
 }
 
 func (p *WorldPlayers) GetPlayer(id uuid.UUID) *WorldPlayer {
@@ -64,31 +113,118 @@ func (p *WorldPlayers) GetPlayer(id uuid.UUID) *WorldPlayer {
   return nil
 }
 
-func (p *WorldPlayers) Push(playerId uuid.UUID, msg tcp.TCPMsg) {
+// The Push methods never wait on a slow client, players whose
+// queue is full miss the message. They say how many did.
+
+// False if the player isn't connected or their queue is full.
+func (p *WorldPlayers) Push(playerId uuid.UUID, msg tcp.TCPMsg) bool {
   plr := p.GetPlayer(playerId)
-  if plr != nil && plr.Tcp.GetState() >= tcp.CONNECTED {
-    plr.Tcp.Outgoing <- msg
-  } else {
-    log.Printf("Tried to push msg to player %s who doesnt exist", playerId)
+  if plr == nil || plr.Tcp.GetState() < tcp.CONNECTED {
+    logger.Debug("dropped msg for missing player", "player", playerId)
+    return false
   }
+  return offer(plr, msg)
+}
+
+func (p *WorldPlayers) PushAll(msg tcp.TCPMsg) int {
+  return p.pushWhere(msg, func(plr *WorldPlayer) bool { return true })
+}
+
+func (p *WorldPlayers) PushAllExcluding(playerId uuid.UUID, msg tcp.TCPMsg) int {
+  return p.pushWhere(msg, func(plr *WorldPlayer) bool { return plr.Tcp.Id != playerId })
+}
+
+func (p *WorldPlayers) PushTeamExcluding(team byte, playerId uuid.UUID, msg tcp.TCPMsg) int {
+  return p.pushWhere(msg, func(plr *WorldPlayer) bool { return plr.Team == team && plr.Tcp.Id != playerId })
 }
 
-func (p *WorldPlayers) PushAll(msg tcp.TCPMsg) {
+func (p *WorldPlayers) pushWhere(msg tcp.TCPMsg, to func(plr *WorldPlayer) bool) int {
+  dropped := 0
   p.playerMap.Range(func(key, value interface{}) bool {
     plr := value.(*WorldPlayer)
-    if plr.Tcp.GetState() >= tcp.CONNECTED {
-      plr.Tcp.Outgoing <- msg
+    if plr.Tcp.GetState() >= tcp.CONNECTED && to(plr) && !offer(plr, msg) {
+      dropped++
     }
     return true
   })
+  return dropped
 }
 
-func (p *WorldPlayers) PushAllExcluding(playerId uuid.UUID, msg tcp.TCPMsg) {
-  p.playerMap.Range(func(key, value interface{}) bool {
-    plr := value.(*WorldPlayer)
-    if plr.Tcp.GetState() >= tcp.CONNECTED && plr.Tcp.Id != playerId {
-      plr.Tcp.Outgoing <- msg
+// Give plr name if no one else online has it, ignoring case.
+func (p *WorldPlayers) Rename(plr *WorldPlayer, name string) error {
+  p.nameLock.Lock()
+  defer p.nameLock.Unlock()
+
+  key := strings.ToLower(name)
+  if owner, taken := p.names[key]; taken && owner != plr.Tcp.Id {
+    return ErrNameTaken
+  }
+  if old := strings.ToLower(plr.GetName()); p.names[old] == plr.Tcp.Id {
+    delete(p.names, old)
+  }
+  p.names[key] = plr.Tcp.Id
+  plr.setName(name)
+  return nil
+}
+
+// Claim name for id if it's valid and no one else online has it,
+// otherwise the first of id's default names that's free.
+func (p *WorldPlayers) claimName(id uuid.UUID, name string) (string, error) {
+  p.nameLock.Lock()
+  defer p.nameLock.Unlock()
+  if p.names == nil {
+    p.names = make(map[string]uuid.UUID)
+  }
+
+  var err error
+  if name != "" {
+    err = ValidateName(name)
+    if owner, taken := p.names[strings.ToLower(name)]; err == nil && taken && owner != id {
+      err = ErrNameTaken
+    }
+    if err == nil {
+      p.names[strings.ToLower(name)] = id
+      return name, nil
+    }
+  }
+
+  names := defaultNames(id)
+  for _, name := range names {
+    if _, taken := p.names[name]; !taken {
+      p.names[name] = id
+      return name, err
     }
+  }
+  // only a player re-added with the same id gets here
+  return names[len(names) - 1], err
+}
+
+// Queue m for plr unless their queue is full, never waits on a slow client.
+func offer(plr *WorldPlayer, m tcp.TCPMsg) bool {
+  select {
+    case plr.Tcp.Outgoing <- m:
+      return true
+    default:
+      logger.Debug("dropped msg for full queue", "player", plr.Tcp.Id, "cmd", m.GetCmd())
+      return false
+  }
+}
+
+// Messages queued for every player but not yet written.
+func (p *WorldPlayers) Pending() int {
+  pending := 0
+  p.playerMap.Range(func(key, value interface{}) bool {
+    pending += value.(*WorldPlayer).Tcp.Pending()
+    return true
+  })
+  return pending
+}
+
+func (p *WorldPlayers) List() []*WorldPlayer {
+  plrs := []*WorldPlayer{}
+  p.playerMap.Range(func(key, value interface{}) bool {
+    plrs = append(plrs, value.(*WorldPlayer))
     return true
   })
+  return plrs
 }
@@ -24,6 +24,15 @@ func (msg *BlocksMsg) Serialize(packet []byte, head int) int {
   head += dataLen
   return head
 }
-func (msg *BlocksMsg) Deserialize(packet []byte, head int) int { return 0 }
+func (msg *BlocksMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.Id = binary.LittleEndian.Uint16(packet[head:head+2])
+  head += 2
+  dataLen := int(binary.LittleEndian.Uint16(packet[head:head+2]))
+  head += 2
+  msg.Data = append([]byte{}, packet[head:head+dataLen]...)
+  head += dataLen
+  return head
+}
 
 
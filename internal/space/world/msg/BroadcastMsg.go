@@ -0,0 +1,38 @@
+package msg
+
+import(
+  "encoding/binary"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// Longest text in bytes, leaves room in a tcp packet.
+const MAX_BROADCAST_LEN int = 512
+
+// Server message for every client, e.g. from an operator.
+type BroadcastMsg struct {
+  Text string
+}
+
+func (msg *BroadcastMsg) GetCmd() tcp.TCPCmd { return tcp.BROADCAST }
+func (msg *BroadcastMsg) Serialize(packet []byte, head int) int {
+  text := []byte(msg.Text)
+  if len(text) > MAX_BROADCAST_LEN {
+    text = text[:MAX_BROADCAST_LEN]
+  }
+
+  packet[head] = byte(tcp.BROADCAST)
+  head++
+  binary.LittleEndian.PutUint16(packet[head:head+2], uint16(len(text)))
+  head += 2
+  copy(packet[head:head+len(text)], text)
+  head += len(text)
+  return head
+}
+func (msg *BroadcastMsg) Deserialize(packet []byte, head int) int {
+  head++
+  textLen := int(binary.LittleEndian.Uint16(packet[head:head+2]))
+  head += 2
+  msg.Text = string(packet[head:head+textLen])
+  head += textLen
+  return head
+}
@@ -0,0 +1,68 @@
+package msg
+
+import(
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// Longest chat text in bytes.
+const MAX_CHAT_LEN int = 256
+
+// Who a chat message is for.
+const(
+  CHAT_GLOBAL   byte = iota   // every player
+  CHAT_TEAM                   // the sender's team
+  CHAT_WHISPER                // one player
+  CHAT_SYSTEM                 // from the server, never sent by clients
+)
+
+// client -> WORLD: PlayerId is who a whisper is for.
+// WORLD -> client: PlayerId is who said it, nil for CHAT_SYSTEM.
+type ChatMsg struct {
+  // local
+  playerId uuid.UUID
+
+  // common
+  Scope     byte
+  PlayerId  uuid.UUID
+  Text      string
+}
+
+func (msg *ChatMsg) GetCmd() tcp.TCPCmd { return tcp.CHAT }
+func (msg *ChatMsg) Serialize(packet []byte, head int) int {
+  text := []byte(msg.Text)
+  if len(text) > MAX_CHAT_LEN {
+    text = text[:MAX_CHAT_LEN]
+  }
+
+  packet[head] = byte(tcp.CHAT)
+  head++
+  packet[head] = msg.Scope
+  head++
+  copy(packet[head:head+16], msg.PlayerId[0:])
+  head += 16
+  binary.LittleEndian.PutUint16(packet[head:head+2], uint16(len(text)))
+  head += 2
+  copy(packet[head:head+len(text)], text)
+  head += len(text)
+  return head
+}
+
+// Bytes that aren't utf-8 come out as utf8.RuneError.
+func (msg *ChatMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.Scope = packet[head]
+  head++
+  copy(msg.PlayerId[0:], packet[head:head+16])
+  head += 16
+  textLen := int(binary.LittleEndian.Uint16(packet[head:head+2]))
+  head += 2
+  msg.Text = snet.Read_utf8(packet[head:head+textLen])
+  head += textLen
+  return head
+}
+
+func (msg *ChatMsg) SetPlayerId(id uuid.UUID) { msg.playerId = id }
+func (msg *ChatMsg) GetPlayerId() uuid.UUID   { return msg.playerId }
@@ -0,0 +1,31 @@
+package msg
+
+import(
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// client -> WORLD, first thing after connecting: the display
+// name to join under, empty for a default one.
+type LoginMsg struct {
+  // local
+  playerId uuid.UUID
+
+  // common
+  Name  string
+}
+
+func (msg *LoginMsg) GetCmd() tcp.TCPCmd { return tcp.LOGIN }
+func (msg *LoginMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.LOGIN)
+  head++
+  return writeName(packet, head, msg.Name)
+}
+func (msg *LoginMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.Name, head = readName(packet, head)
+  return head
+}
+
+func (msg *LoginMsg) SetPlayerId(id uuid.UUID) { msg.playerId = id }
+func (msg *LoginMsg) GetPlayerId() uuid.UUID   { return msg.playerId }
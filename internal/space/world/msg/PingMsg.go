@@ -0,0 +1,27 @@
+package msg
+
+import(
+  "encoding/binary"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// WORLD -> client: are you still there? Answer with
+// a PongMsg carrying the same Time.
+type PingMsg struct {
+  Time  int64     // WORLD clock in milliseconds
+}
+
+func (msg *PingMsg) GetCmd() tcp.TCPCmd { return tcp.PING }
+func (msg *PingMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.PING)
+  head++
+  binary.LittleEndian.PutUint64(packet[head:head+8], uint64(msg.Time))
+  head += 8
+  return head
+}
+func (msg *PingMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.Time = int64(binary.LittleEndian.Uint64(packet[head:head+8]))
+  head += 8
+  return head
+}
@@ -12,7 +12,7 @@ import(
 type PlayerInfoMsg struct {
   Id uuid.UUID
   Stats player.PlayerStats
-
+  Name string
 }
 
 func (msg *PlayerInfoMsg) GetCmd() tcp.TCPCmd { return tcp.PLAYER_INFO }
@@ -27,8 +27,19 @@ func (msg *PlayerInfoMsg) Serialize(packet []byte, head int) int {
   head += 4
   binary.LittleEndian.PutUint32(packet[head:head+4], math.Float32bits(msg.Stats.Rotation))
   head += 4
+  head = writeName(packet, head, msg.Name)
+  return head
+}
+func (msg *PlayerInfoMsg) Deserialize(packet []byte, head int) int {
+  head++
+  copy(msg.Id[0:], packet[head:head+16])
+  head += 16
+  msg.Stats.Thrust = math.Float32frombits(binary.LittleEndian.Uint32(packet[head:head+4]))
+  head += 4
+  msg.Stats.MaxSpeed = math.Float32frombits(binary.LittleEndian.Uint32(packet[head:head+4]))
+  head += 4
+  msg.Stats.Rotation = math.Float32frombits(binary.LittleEndian.Uint32(packet[head:head+4]))
+  head += 4
+  msg.Name, head = readName(packet, head)
   return head
 }
-func (msg *PlayerInfoMsg) Deserialize(packet []byte, head int) int { return 0 }
-
-
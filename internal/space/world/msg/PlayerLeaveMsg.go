@@ -18,6 +18,11 @@ func (msg *PlayerLeaveMsg) Serialize(packet []byte, head int) int {
   head += 16
   return head
 }
-func (msg *PlayerLeaveMsg) Deserialize(packet []byte, head int) int { return 0 }
+func (msg *PlayerLeaveMsg) Deserialize(packet []byte, head int) int {
+  head++
+  copy(msg.Id[0:], packet[head:head+16])
+  head += 16
+  return head
+}
 
 
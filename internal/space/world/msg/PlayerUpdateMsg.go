@@ -0,0 +1,59 @@
+package msg
+
+import(
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// Longest display name in bytes on the wire.
+const MAX_NAME_BYTES int = 64
+
+// client -> WORLD: change my name, Id is ignored.
+// WORLD -> client: player Id is called Name now, also
+// sent to the player who asked once it's accepted.
+type PlayerUpdateMsg struct {
+  // local
+  playerId uuid.UUID
+
+  // common
+  Id    uuid.UUID
+  Name  string
+}
+
+func (msg *PlayerUpdateMsg) GetCmd() tcp.TCPCmd { return tcp.PLAYER_UPDATE }
+func (msg *PlayerUpdateMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.PLAYER_UPDATE)
+  head++
+  copy(packet[head:head+16], msg.Id[0:])
+  head += 16
+  return writeName(packet, head, msg.Name)
+}
+func (msg *PlayerUpdateMsg) Deserialize(packet []byte, head int) int {
+  head++
+  copy(msg.Id[0:], packet[head:head+16])
+  head += 16
+  msg.Name, head = readName(packet, head)
+  return head
+}
+
+func (msg *PlayerUpdateMsg) SetPlayerId(id uuid.UUID) { msg.playerId = id }
+func (msg *PlayerUpdateMsg) GetPlayerId() uuid.UUID   { return msg.playerId }
+
+// name: length(1) utf-8(length)
+func writeName(packet []byte, head int, name string) int {
+  b := []byte(name)
+  if len(b) > MAX_NAME_BYTES {
+    b = b[:MAX_NAME_BYTES]
+  }
+  packet[head] = byte(len(b))
+  head++
+  copy(packet[head:head+len(b)], b)
+  return head + len(b)
+}
+
+func readName(packet []byte, head int) (string, int) {
+  n := int(packet[head])
+  head++
+  return snet.Read_utf8(packet[head:head+n]), head + n
+}
@@ -0,0 +1,34 @@
+package msg
+
+import(
+  "encoding/binary"
+  "github.com/google/uuid"
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// client -> WORLD: answer to a PingMsg, Time copied from it.
+type PongMsg struct {
+  // local
+  playerId uuid.UUID
+
+  // common
+  Time  int64
+}
+
+func (msg *PongMsg) GetCmd() tcp.TCPCmd { return tcp.PONG }
+func (msg *PongMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.PONG)
+  head++
+  binary.LittleEndian.PutUint64(packet[head:head+8], uint64(msg.Time))
+  head += 8
+  return head
+}
+func (msg *PongMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.Time = int64(binary.LittleEndian.Uint64(packet[head:head+8]))
+  head += 8
+  return head
+}
+
+func (msg *PongMsg) SetPlayerId(id uuid.UUID) { msg.playerId = id }
+func (msg *PongMsg) GetPlayerId() uuid.UUID   { return msg.playerId }
@@ -0,0 +1,17 @@
+package msg
+
+import(
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// Tell the client WORLD is shutting down.
+// The connection closes once queued messages are written.
+type ShutdownMsg struct {}
+
+func (msg *ShutdownMsg) GetCmd() tcp.TCPCmd { return tcp.SHUTDOWN }
+func (msg *ShutdownMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.SHUTDOWN)
+  head++
+  return head
+}
+func (msg *ShutdownMsg) Deserialize(packet []byte, head int) int { return head + 1 }
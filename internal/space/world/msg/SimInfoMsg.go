@@ -25,6 +25,15 @@ func (msg *SimInfoMsg) Serialize(packet []byte, head int) int {
   head += 4
   return head
 }
-func (msg *SimInfoMsg) Deserialize(packet []byte, head int) int { return 0 }
+func (msg *SimInfoMsg) Deserialize(packet []byte, head int) int {
+  head++
+  ipLen := int(packet[head])
+  head++
+  msg.Ip = append(net.IP{}, packet[head:head+ipLen]...)
+  head += ipLen
+  msg.Port = binary.LittleEndian.Uint32(packet[head:head+4])
+  head += 4
+  return head
+}
 
 
@@ -0,0 +1,17 @@
+package msg
+
+import(
+  "go-space-serv/internal/space/snet/tcp"
+)
+
+// Tell the client the simulation is gone.
+// A SIM_INFO follows once one is back.
+type SimLostMsg struct {}
+
+func (msg *SimLostMsg) GetCmd() tcp.TCPCmd { return tcp.SIM_LOST }
+func (msg *SimLostMsg) Serialize(packet []byte, head int) int {
+  packet[head] = byte(tcp.SIM_LOST)
+  head++
+  return head
+}
+func (msg *SimLostMsg) Deserialize(packet []byte, head int) int { return head + 1 }
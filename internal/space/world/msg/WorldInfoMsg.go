@@ -30,4 +30,17 @@ func (msg *WorldInfoMsg) Serialize(packet []byte, head int) int {
   head += 8
   return head
 }
-func (msg *WorldInfoMsg) Deserialize(packet []byte, head int) int { return 0 }
+func (msg *WorldInfoMsg) Deserialize(packet []byte, head int) int {
+  head++
+  msg.ChunksPerFile = binary.LittleEndian.Uint32(packet[head:head+4])
+  head += 4
+  msg.ChunkSize = binary.LittleEndian.Uint32(packet[head:head+4])
+  head += 4
+  msg.Size = binary.LittleEndian.Uint32(packet[head:head+4])
+  head += 4
+  msg.Seed = binary.LittleEndian.Uint64(packet[head:head+8])
+  head += 8
+  msg.Threshold = math.Float64frombits(binary.LittleEndian.Uint64(packet[head:head+8]))
+  head += 8
+  return head
+}
@@ -0,0 +1,255 @@
+package client
+
+import(
+  "io"
+  "net"
+  "sync"
+  "errors"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/sim/msg"
+  worldmsg "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/snet/udp"
+)
+
+// A player talking to WORLD over tcp and to its SIM over udp.
+// Everything the servers send arrives on Events, which is closed
+// after a final ClosedEvent. Read it until then or the client stalls.
+//
+//   c, err := client.Dial("127.0.0.1:9494", client.DefaultOptions())
+//   for e := range c.Events() {
+//     switch t := e.(type) {
+//       case client.WelcomeEvent:
+//         c.Enter()
+//       case client.EnterEvent:
+//         ...
+//     }
+//   }
+type Client struct {
+  opts      Options
+  world     io.ReadWriteCloser
+  dialSim   simDialer
+  worldLock sync.Mutex
+  events    chan Event
+  done      chan struct{}
+  routines  sync.WaitGroup
+
+  closeOnce sync.Once
+  closeErr  error
+
+  lock      sync.Mutex
+  id        uuid.UUID
+  sim       *simConn
+
+  stats     stats
+}
+
+var ErrClosed = errors.New("client: closed")
+var ErrNoSim = errors.New("client: not connected to a simulation")
+var ErrQueueFull = errors.New("client: too many commands queued")
+
+// Connects to WORLD. The SIM handshake starts by itself
+// once WORLD says where the simulation is.
+func Dial(worldAddr string, opts Options) (*Client, error) {
+  conn, err := net.Dial("tcp", worldAddr)
+  if err != nil {
+    return nil, err
+  }
+  return start(conn, dialUDP, opts)
+}
+
+// Logs in over world, reaching SIMs through dialSim.
+func start(world io.ReadWriteCloser, dialSim simDialer, opts Options) (*Client, error) {
+  c := &Client{
+    opts: opts,
+    world: world,
+    dialSim: dialSim,
+    events: make(chan Event, 256),
+    done: make(chan struct{}),
+  }
+
+  c.routines.Add(1)
+  go c.worldRx()
+
+  // WORLD holds us until it knows what to call us
+  if err := c.worldSend(&worldmsg.LoginMsg{Name: opts.Name}); err != nil {
+    c.shutdown(err)
+    return nil, err
+  }
+  return c, nil
+}
+
+func (c *Client) Events() <-chan Event {
+  return c.events
+}
+
+// Known once PlayerInfoEvent arrived.
+func (c *Client) Id() uuid.UUID {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+  return c.id
+}
+
+// Spawn a body, the SIM answers with an EnterEvent for it.
+func (c *Client) Enter() error {
+  return c.queue([]byte{byte(udp.ENTER)})
+}
+
+// Give up the body and go back to spectating.
+func (c *Client) Exit() error {
+  return c.queue([]byte{byte(udp.EXIT)})
+}
+
+// Ask the SIM for its frame and time, answered with a SyncEvent.
+func (c *Client) Sync() error {
+  return c.queue([]byte{byte(udp.SYNC)})
+}
+
+// Watch body, SIM then sends StateEvents around it.
+// Only while spectating, after Exit or before Enter.
+func (c *Client) Spectate(bodyId uint16) error {
+  return c.spectate(msg.CAMERA_FOLLOW, bodyId, 0, 0)
+}
+
+// Watch cell x, y without following anything.
+func (c *Client) FreeCamera(x, y uint32) error {
+  return c.spectate(msg.CAMERA_FREE, 0, x, y)
+}
+
+// Stop the StateEvents.
+func (c *Client) StopSpectating() error {
+  return c.spectate(msg.CAMERA_NONE, 0, 0, 0)
+}
+
+func (c *Client) spectate(mode byte, bodyId uint16, x, y uint32) error {
+  m := msg.SpectateMsg{Mode: mode, BodyId: bodyId, X: x, Y: y}
+  cmd := make([]byte, m.GetSize())
+  m.Serialize(cmd)
+  return c.queue(cmd)
+}
+
+// Bits of MoveShoot.
+const(
+  LEFT      byte = 1 << 0
+  RIGHT     byte = 1 << 1
+  FORWARD   byte = 1 << 2
+  BACKWARD  byte = 1 << 3
+)
+
+// Input for simulation frame tick, moveShoot is LEFT, RIGHT, FORWARD and BACKWARD or'ed.
+func (c *Client) MoveShoot(tick uint16, moveShoot byte) error {
+  return c.queue([]byte{byte(udp.MOVESHOOT), byte(tick), byte(tick >> 8), moveShoot})
+}
+
+// Ask WORLD to call us name. Everyone, us included, gets a
+// PlayerUpdateEvent once it's accepted, a CHAT_SYSTEM ChatEvent says why not.
+func (c *Client) SetName(name string) error {
+  select {
+    case <-c.done:
+      return ErrClosed
+    default:
+  }
+  return c.worldSend(&worldmsg.PlayerUpdateMsg{Name: name})
+}
+
+// Chat to every player. WORLD doesn't send it back to us,
+// refusals arrive as a CHAT_SYSTEM ChatEvent.
+func (c *Client) Chat(text string) error {
+  return c.chat(worldmsg.CHAT_GLOBAL, uuid.Nil, text)
+}
+
+// Chat to players on our team.
+func (c *Client) TeamChat(text string) error {
+  return c.chat(worldmsg.CHAT_TEAM, uuid.Nil, text)
+}
+
+// Chat to one player.
+func (c *Client) Whisper(to uuid.UUID, text string) error {
+  return c.chat(worldmsg.CHAT_WHISPER, to, text)
+}
+
+func (c *Client) chat(scope byte, to uuid.UUID, text string) error {
+  select {
+    case <-c.done:
+      return ErrClosed
+    default:
+  }
+  return c.worldSend(&worldmsg.ChatMsg{Scope: scope, PlayerId: to, Text: text})
+}
+
+func (c *Client) Close() error {
+  c.shutdown(nil)
+  return nil
+}
+
+func (c *Client) queue(cmd []byte) error {
+  select {
+    case <-c.done:
+      return ErrClosed
+    default:
+  }
+
+  c.lock.Lock()
+  sc := c.sim
+  c.lock.Unlock()
+  if sc == nil {
+    return ErrNoSim
+  }
+  return sc.queue(cmd)
+}
+
+// Hands e to the reader, false once the client is closing.
+func (c *Client) emit(e Event) bool {
+  select {
+    case c.events <- e:
+      return true
+    case <-c.done:
+      return false
+  }
+}
+
+// Stops everything, the first err is reported in the ClosedEvent.
+func (c *Client) shutdown(err error) {
+  c.closeOnce.Do(func() {
+    c.closeErr = err
+    close(c.done)
+    c.world.Close()
+
+    c.lock.Lock()
+    if c.sim != nil {
+      c.sim.close()
+    }
+    c.lock.Unlock()
+
+    go func() {
+      c.routines.Wait()
+      c.events <- ClosedEvent{Err: c.closeErr}
+      close(c.events)
+    }()
+  })
+}
+
+// Start talking to the SIM at ip:port, dropping the previous one.
+// The same address again keeps the session, the SIM still knows us.
+func (c *Client) connectSim(ip net.IP, port uint32) {
+  c.lock.Lock()
+  defer c.lock.Unlock()
+
+  select {
+    case <-c.done:
+      return
+    default:
+  }
+
+  if c.sim != nil {
+    if c.sim.ip.Equal(ip) && c.sim.port == port && c.sim.isLive() {
+      return
+    }
+    c.sim.close()
+  }
+
+  c.sim = newSimConn(c, ip, port)
+  c.routines.Add(1)
+  go c.sim.run()
+}
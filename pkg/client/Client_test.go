@@ -0,0 +1,390 @@
+package client
+
+import(
+  "io"
+  "os"
+  "net"
+  "sync"
+  "time"
+  "reflect"
+  "testing"
+  "encoding/binary"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/sim/msg"
+  worldmsg "go-space-serv/internal/space/world/msg"
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/snet/transport"
+)
+
+// WORLD's tcp connection over a Pipe, one packet per Write.
+type pipeStream struct {
+  end   *transport.PipeEnd
+  rest  []byte
+}
+
+func (s *pipeStream) Read(b []byte) (int, error) {
+  if len(s.rest) == 0 {
+    p, err := s.end.Recv()
+    if err != nil {
+      return 0, io.EOF
+    }
+    s.rest = p
+  }
+  n := copy(b, s.rest)
+  s.rest = s.rest[n:]
+  return n, nil
+}
+
+func (s *pipeStream) Write(b []byte) (int, error) {
+  if err := s.end.Send(b); err != nil {
+    return 0, err
+  }
+  return len(b), nil
+}
+
+func (s *pipeStream) Close() error {
+  return s.end.Close()
+}
+
+// A SIM's udp socket over a Pipe.
+type pipeSocket struct {
+  end       *transport.PipeEnd
+  packets   chan []byte
+  lock      sync.Mutex
+  deadline  time.Time
+}
+
+func newPipeSocket(end *transport.PipeEnd) *pipeSocket {
+  s := &pipeSocket{end: end, packets: make(chan []byte, 256)}
+  go func() {
+    defer close(s.packets)
+    for {
+      p, err := end.Recv()
+      if err != nil {
+        return
+      }
+      s.packets <- p
+    }
+  }()
+  return s
+}
+
+func (s *pipeSocket) Read(b []byte) (int, error) {
+  s.lock.Lock()
+  deadline := s.deadline
+  s.lock.Unlock()
+
+  var timeout <-chan time.Time
+  if !deadline.IsZero() {
+    timer := time.NewTimer(time.Until(deadline))
+    defer timer.Stop()
+    timeout = timer.C
+  }
+  select {
+    case p, ok := <-s.packets:
+      if !ok {
+        return 0, transport.ErrPipeClosed
+      }
+      return copy(b, p), nil
+    case <-timeout:
+      return 0, os.ErrDeadlineExceeded
+  }
+}
+
+func (s *pipeSocket) Write(b []byte) (int, error) {
+  if err := s.end.Send(b); err != nil {
+    return 0, err
+  }
+  return len(b), nil
+}
+
+func (s *pipeSocket) SetReadDeadline(t time.Time) error {
+  s.lock.Lock()
+  s.deadline = t
+  s.lock.Unlock()
+  return nil
+}
+
+func (s *pipeSocket) Close() error {
+  return s.end.Close()
+}
+
+func testOptions() Options {
+  opts := DefaultOptions()
+  opts.Name = "tester"
+  opts.Tick = 5 * time.Millisecond
+  opts.ResendInterval = 20 * time.Millisecond
+  opts.HandshakeTimeout = 2 * time.Second
+  return opts
+}
+
+// One frame holding msgs, as WORLD sends them.
+func worldFrame(msgs ...tcp.TCPMsg) []byte {
+  frame := make([]byte, tcp.PacketSize)
+  head := 2
+  for _, m := range msgs {
+    head = m.Serialize(frame, head)
+  }
+  binary.LittleEndian.PutUint16(frame[0:2], uint16(head - 2))
+  return frame[:head]
+}
+
+func nextEvent(t *testing.T, c *Client) Event {
+  t.Helper()
+  select {
+    case e := <-c.Events():
+      return e
+    case <-time.After(2 * time.Second):
+      t.Fatalf("no event")
+  }
+  return nil
+}
+
+// Next packet from the client with cmd, skipping resent ones.
+func nextPacket(t *testing.T, end *transport.PipeEnd, cmd udp.UDPCmd) []byte {
+  t.Helper()
+  for {
+    p, err := end.Recv()
+    if err != nil {
+      t.Fatal(err)
+    }
+    if len(p) >= controlSize && udp.UDPCmd(p[4]) == cmd {
+      return p
+    }
+  }
+}
+
+// The client logs in, connects to the SIM WORLD names, answers the
+// SIM handshake and PINGs, and reports what both servers send.
+func TestHandshake(t *testing.T) {
+  opts := testOptions()
+  worldEnd, clientWorld := transport.Pipe("world", "client")
+  simEnd, clientSim := transport.Pipe("sim", "client")
+  defer worldEnd.Close()
+  defer simEnd.Close()
+
+  simIp := net.IPv4(10, 0, 0, 2).To4()
+  dial := func(ip net.IP, port uint32) (simSocket, error) {
+    if !ip.Equal(simIp) || port != 9495 {
+      t.Errorf("dialed %s:%d, want %s:9495", ip, port, simIp)
+    }
+    return newPipeSocket(clientSim), nil
+  }
+  c, err := start(&pipeStream{end: clientWorld}, dial, opts)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // LOGIN comes first
+  frame, err := worldEnd.Recv()
+  if err != nil {
+    t.Fatal(err)
+  }
+  var login worldmsg.LoginMsg
+  if int(binary.LittleEndian.Uint16(frame[0:2])) != len(frame) - 2 || tcp.TCPCmd(frame[2]) != tcp.LOGIN {
+    t.Fatalf("first frame %v is not a LOGIN", frame)
+  }
+  login.Deserialize(frame, 2)
+  if login.Name != "tester" {
+    t.Fatalf("logged in as %q", login.Name)
+  }
+
+  id := uuid.New()
+  info := &worldmsg.PlayerInfoMsg{Id: id, Stats: player.DefaultPlayerStats(), Name: "tester"}
+  worldEnd.Send(worldFrame(info, &worldmsg.SimInfoMsg{Ip: simIp, Port: 9495}))
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, PlayerInfoEvent{id, info.Stats, "tester"}) {
+    t.Fatalf("got %#v, want PlayerInfoEvent", e)
+  }
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, SimInfoEvent{simIp, 9495}) {
+    t.Fatalf("got %#v, want SimInfoEvent", e)
+  }
+
+  hello := nextPacket(t, simEnd, udp.HELLO)
+  if len(hello) != opts.MaxMsgSize || snet.Read_uint32(hello[0:4]) != opts.ProtocolId {
+    t.Fatalf("HELLO of %d bytes", len(hello))
+  }
+  if uuid.UUID(hello[13:29]) != id {
+    t.Fatalf("HELLO names %x, want %s", hello[13:29], id)
+  }
+  clientSalt := snet.Read_int64(hello[5:13])
+  serverSalt := int64(0x1234567890)
+  salt := clientSalt ^ serverSalt
+
+  challenge := make([]byte, 21)
+  binary.LittleEndian.PutUint32(challenge[0:4], opts.ProtocolId)
+  challenge[4] = byte(udp.CHALLENGE)
+  binary.LittleEndian.PutUint64(challenge[5:13], uint64(clientSalt))
+  binary.LittleEndian.PutUint64(challenge[13:21], uint64(serverSalt))
+  simEnd.Send(challenge)
+
+  answer := nextPacket(t, simEnd, udp.CHALLENGE)
+  if len(answer) != opts.MaxMsgSize || snet.Read_int64(answer[5:13]) != salt {
+    t.Fatalf("CHALLENGE answer of %d bytes with salt %x, want %x", len(answer), snet.Read_int64(answer[5:13]), salt)
+  }
+
+  welcome := make([]byte, controlSize)
+  binary.LittleEndian.PutUint32(welcome[0:4], opts.ProtocolId)
+  welcome[4] = byte(udp.WELCOME)
+  binary.LittleEndian.PutUint64(welcome[5:13], uint64(salt))
+  simEnd.Send(welcome)
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, WelcomeEvent{simIp, 9495}) {
+    t.Fatalf("got %#v, want WelcomeEvent", e)
+  }
+
+  // newest first, the client hands them out oldest first
+  enter := msg.EnterMsg{PlayerId: id, BodyId: 3, X: 10, Y: 20}
+  syncMsg := msg.SyncMsg{Seq: 40, Time: 123456}
+  packet := make([]byte, udp.HEADER_SIZE + enter.GetSize() + syncMsg.GetSize())
+  udp.UDPHeader{ProtocolId: opts.ProtocolId, Salt: salt, Seq: 2}.Serialize(packet)
+  enter.Serialize(packet[udp.HEADER_SIZE:])
+  syncMsg.Serialize(packet[udp.HEADER_SIZE + enter.GetSize():])
+  simEnd.Send(packet)
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, SyncEvent{40, 123456}) {
+    t.Fatalf("got %#v, want SyncEvent", e)
+  }
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, EnterEvent{id, 3, 10, 20}) {
+    t.Fatalf("got %#v, want EnterEvent", e)
+  }
+
+  worldEnd.Send(worldFrame(&worldmsg.PingMsg{Time: 99}, &worldmsg.BroadcastMsg{Text: "hi"}))
+  if e := nextEvent(t, c); !reflect.DeepEqual(e, BroadcastEvent{"hi"}) {
+    t.Fatalf("got %#v, want BroadcastEvent after the PING", e)
+  }
+  frame, err = worldEnd.Recv()
+  if err != nil {
+    t.Fatal(err)
+  }
+  var pong worldmsg.PongMsg
+  if tcp.TCPCmd(frame[2]) != tcp.PONG {
+    t.Fatalf("got cmd %d, want PONG", frame[2])
+  }
+  pong.Deserialize(frame, 2)
+  if pong.Time != 99 {
+    t.Fatalf("PONG time %d, want 99", pong.Time)
+  }
+
+  c.Close()
+  for e := range c.Events() {
+    if closed, ok := e.(ClosedEvent); ok && closed.Err != nil {
+      t.Fatalf("closed with %s", closed.Err)
+    }
+  }
+}
+
+// Every WORLD message decodes, and a frame cut anywhere
+// decodes up to the cut and then reports it.
+func TestDecodeWorldMsgs(t *testing.T) {
+  id := uuid.New()
+  stats := player.DefaultPlayerStats()
+  msgs := []tcp.TCPMsg{
+    &worldmsg.PingMsg{Time: 5},
+    &worldmsg.PlayerInfoMsg{Id: id, Stats: stats, Name: "tester"},
+    &worldmsg.WorldInfoMsg{ChunksPerFile: 4, ChunkSize: 16, Size: 8, Seed: 9, Threshold: 0.5},
+    &worldmsg.SimInfoMsg{Ip: net.ParseIP("2001:db8::1"), Port: 9495},
+    &worldmsg.PlayerJoinMsg{Id: id, Stats: stats, Name: "other"},
+    &worldmsg.PlayerLeaveMsg{Id: id},
+    &worldmsg.BlocksMsg{Id: 7, Data: []byte{1, 2, 3}},
+    &worldmsg.SimLostMsg{},
+    &worldmsg.ShutdownMsg{},
+    &worldmsg.BroadcastMsg{Text: "restarting"},
+    &worldmsg.PlayerUpdateMsg{Id: id, Name: "renamed"},
+    &worldmsg.ChatMsg{Scope: worldmsg.CHAT_WHISPER, PlayerId: id, Text: "hello"},
+  }
+  want := []Event{
+    pingEvent{time: 5},
+    PlayerInfoEvent{id, stats, "tester"},
+    WorldInfoEvent{4, 16, 8, 9, 0.5},
+    SimInfoEvent{net.ParseIP("2001:db8::1"), 9495},
+    JoinEvent{id, stats, "other"},
+    LeaveEvent{id},
+    BlocksEvent{7, []byte{1, 2, 3}},
+    SimLostEvent{},
+    ShutdownEvent{},
+    BroadcastEvent{"restarting"},
+    PlayerUpdateEvent{id, "renamed"},
+    ChatEvent{worldmsg.CHAT_WHISPER, id, "hello"},
+  }
+
+  frame := make([]byte, tcp.PacketSize)
+  ends := []int{}
+  head := 0
+  for _, m := range msgs {
+    head = m.Serialize(frame, head)
+    ends = append(ends, head)
+  }
+  frame = frame[:head]
+
+  for cut := 0; cut <= len(frame); cut++ {
+    got := []Event{}
+    var err error
+    for head := 0; head < cut; {
+      var e Event
+      e, head, err = decodeWorldMsg(frame[:cut], head)
+      if err != nil {
+        break
+      }
+      got = append(got, e)
+    }
+
+    complete := 0
+    for complete < len(ends) && ends[complete] <= cut {
+      complete++
+    }
+    if !reflect.DeepEqual(got, want[:complete]) {
+      t.Fatalf("cut at %d: got %#v, want %#v", cut, got, want[:complete])
+    }
+    atEnd := complete > 0 && ends[complete-1] == cut
+    if (err == errShortMsg) == (atEnd || cut == 0) {
+      t.Fatalf("cut at %d: err %v", cut, err)
+    }
+  }
+
+  if e, next, err := decodeWorldMsg([]byte{255, 1, 2}, 0); e != nil || next != 0 || err != nil {
+    t.Fatalf("unknown command: %v %d %v", e, next, err)
+  }
+}
+
+// Every SIM message decodes, and a packet cut anywhere
+// decodes the messages before the cut.
+func TestDecodeSimMsgs(t *testing.T) {
+  id := uuid.New()
+  enter := &msg.EnterMsg{PlayerId: id, BodyId: 3, X: 10, Y: 20}
+  exit := &msg.ExitMsg{BodyId: 3}
+  syncMsg := &msg.SyncMsg{Seq: 40, Time: 123456}
+  state := &msg.StateMsg{Seq: 41, X: 1, Y: 2, Bodies: []msg.BodyState{{Id: 3, X: 1.5, Y: 2.5}, {Id: 4, Angle: 90}}}
+
+  packet := make([]byte, udp.HEADER_SIZE, 256)
+  ends := []int{}
+  for _, m := range []interface{ GetSize() int; Serialize([]byte) }{enter, exit, syncMsg, state} {
+    packet = append(packet, make([]byte, m.GetSize())...)
+    m.Serialize(packet[len(packet) - m.GetSize():])
+    ends = append(ends, len(packet))
+  }
+  packet = append(packet, byte(udp.MOVESHOOT), 3, 0, 7, 0, LEFT | FORWARD)
+  ends = append(ends, len(packet))
+  packet = append(packet, byte(udp.SHUTUP), byte(udp.ENTER))
+
+  want := []Event{
+    EnterEvent{id, 3, 10, 20},
+    ExitEvent{BodyId: 3},
+    SyncEvent{40, 123456},
+    StateEvent{41, 1, 2, state.Bodies},
+    MoveShootEvent{BodyId: 3, Tick: 7, MoveShoot: LEFT | FORWARD},
+  }
+
+  for cut := udp.HEADER_SIZE; cut <= len(packet); cut++ {
+    complete := 0
+    for complete < len(ends) && ends[complete] <= cut {
+      complete++
+    }
+    got := decodeSimMsgs(packet[:cut], udp.HEADER_SIZE)
+    if len(got) != complete || (complete > 0 && !reflect.DeepEqual(got, want[:complete])) {
+      t.Fatalf("cut at %d: got %#v, want %#v", cut, got, want[:complete])
+    }
+  }
+}
@@ -0,0 +1,141 @@
+package client
+
+import(
+  "net"
+
+  "github.com/google/uuid"
+
+  "go-space-serv/internal/space/player"
+  "go-space-serv/internal/space/sim/msg"
+)
+
+// Everything the servers tell the client arrives as one of these.
+type Event interface {
+  isEvent()
+}
+
+// WORLD
+
+type PlayerInfoEvent struct {
+  Id    uuid.UUID
+  Stats player.PlayerStats
+  Name  string
+}
+
+type WorldInfoEvent struct {
+  ChunksPerFile uint32
+  ChunkSize     uint32
+  Size          uint32
+  Seed          uint64
+  Threshold     float64
+}
+
+// Where to find the simulation, the client connects to it on its own.
+type SimInfoEvent struct {
+  Ip    net.IP
+  Port  uint32
+}
+
+type JoinEvent struct {
+  Id    uuid.UUID
+  Stats player.PlayerStats
+  Name  string
+}
+
+// Player Id changed their name.
+type PlayerUpdateEvent struct {
+  Id    uuid.UUID
+  Name  string
+}
+
+type LeaveEvent struct {
+  Id    uuid.UUID
+}
+
+type BlocksEvent struct {
+  Id    uint16
+  Data  []byte
+}
+
+type SimLostEvent struct {}
+type ShutdownEvent struct {}
+
+type BroadcastEvent struct {
+  Text  string
+}
+
+// Someone said something. Scope is a CHAT_ constant from
+// internal/space/world/msg, From is nil for CHAT_SYSTEM.
+type ChatEvent struct {
+  Scope byte
+  From  uuid.UUID
+  Text  string
+}
+
+// SIM
+
+// The handshake with SIM finished, commands can be sent.
+type WelcomeEvent struct {
+  Ip    net.IP
+  Port  uint32
+}
+
+type SyncEvent struct {
+  Seq   uint16
+  Time  uint64  // unix millis of the last simulation frame
+}
+
+type EnterEvent struct {
+  PlayerId  uuid.UUID
+  BodyId    uint16
+  X         uint32
+  Y         uint32
+}
+
+type ExitEvent struct {
+  BodyId  uint16
+}
+
+// Another player's input.
+type MoveShootEvent struct {
+  BodyId    uint16
+  Tick      uint16
+  MoveShoot byte
+}
+
+// Bodies nearest a spectator's camera after frame Seq,
+// every spectateRate frames while spectating.
+type StateEvent struct {
+  Seq     uint16
+  X       uint32    // camera cell
+  Y       uint32
+  Bodies  []msg.BodyState
+}
+
+// SIM said goodbye, e.g. it is shutting down.
+type DisconnectEvent struct {}
+
+// The client is done, Err is nil after Close.
+type ClosedEvent struct {
+  Err error
+}
+
+func (PlayerInfoEvent) isEvent()   {}
+func (WorldInfoEvent) isEvent()    {}
+func (SimInfoEvent) isEvent()      {}
+func (JoinEvent) isEvent()         {}
+func (PlayerUpdateEvent) isEvent() {}
+func (LeaveEvent) isEvent()        {}
+func (BlocksEvent) isEvent()       {}
+func (SimLostEvent) isEvent()      {}
+func (ShutdownEvent) isEvent()     {}
+func (BroadcastEvent) isEvent()    {}
+func (ChatEvent) isEvent()         {}
+func (WelcomeEvent) isEvent()      {}
+func (SyncEvent) isEvent()         {}
+func (EnterEvent) isEvent()        {}
+func (ExitEvent) isEvent()         {}
+func (MoveShootEvent) isEvent()    {}
+func (StateEvent) isEvent()        {}
+func (DisconnectEvent) isEvent()   {}
+func (ClosedEvent) isEvent()       {}
@@ -0,0 +1,25 @@
+package client
+
+import(
+  "time"
+)
+
+// Must match the servers' config.
+type Options struct {
+  ProtocolId        uint32
+  MaxMsgSize        int             // size of padded handshake packets
+  Tick              time.Duration   // how often packets go to SIM
+  ResendInterval    time.Duration   // handshake packets are resent this often until answered
+  HandshakeTimeout  time.Duration   // give up on a SIM after this long
+  Name              string          // display name sent in LOGIN, empty for WORLD's default
+}
+
+func DefaultOptions() Options {
+  var o Options
+  o.ProtocolId = 3551548956
+  o.MaxMsgSize = 1024
+  o.Tick = 33 * time.Millisecond
+  o.ResendInterval = 250 * time.Millisecond
+  o.HandshakeTimeout = 5 * time.Second
+  return o
+}
@@ -0,0 +1,414 @@
+package client
+
+import(
+  "net"
+  "sync"
+  "time"
+  "errors"
+  "math/rand"
+  "sync/atomic"
+  "encoding/binary"
+
+  "go-space-serv/internal/space/snet"
+  "go-space-serv/internal/space/snet/udp"
+  "go-space-serv/internal/space/sim/msg"
+)
+
+// client <-> SIM over udp, see UDPPlayer.AuthenticateConnection.
+//
+// handshake, padded to MaxMsgSize:
+//   -> protocolId(4) HELLO clientSalt(8) playerId(16)
+//   <- protocolId(4) CHALLENGE clientSalt(8) serverSalt(8)
+//   -> protocolId(4) CHALLENGE clientSalt^serverSalt(8)
+//   <- protocolId(4) WELCOME clientSalt^serverSalt(8)
+//
+// then both sides send UDPHeader followed by messages.
+// SIM packs its newest message first, followed by every older one
+// not acked yet. Its header seq is the seq of the newest. SIM ends with
+//   <- protocolId(4) DISCONNECT clientSalt^serverSalt(8)
+
+const controlSize int = 13
+const maxQueued int = 256
+
+var errHandshakeTimeout = errors.New("client: simulation didn't answer the handshake")
+
+// What simConn needs of its udp socket.
+type simSocket interface {
+  Read(b []byte) (int, error)
+  Write(b []byte) (int, error)
+  SetReadDeadline(t time.Time) error
+  Close() error
+}
+
+type simDialer func(ip net.IP, port uint32) (simSocket, error)
+
+func dialUDP(ip net.IP, port uint32) (simSocket, error) {
+  conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: int(port)})
+  if err != nil {
+    return nil, err
+  }
+  return conn, nil
+}
+
+type simConn struct {
+  client      *Client
+  ip          net.IP
+  port        uint32
+  conn        simSocket
+  done        chan struct{}
+  closeOnce   sync.Once
+
+  clientSalt  int64
+  serverSalt  int64
+
+  lock        sync.Mutex
+  live        bool
+  txSeq       uint16
+  rxSeq       uint16
+  queued      []byte
+}
+
+func newSimConn(c *Client, ip net.IP, port uint32) *simConn {
+  var sc simConn
+  sc.client = c
+  sc.ip = ip
+  sc.port = port
+  sc.done = make(chan struct{})
+  sc.clientSalt = rand.Int63()
+  return &sc
+}
+
+func (sc *simConn) salt() int64 {
+  return sc.clientSalt ^ sc.serverSalt
+}
+
+func (sc *simConn) isLive() bool {
+  sc.lock.Lock()
+  defer sc.lock.Unlock()
+  return sc.live
+}
+
+func (sc *simConn) close() {
+  sc.closeOnce.Do(func() {
+    close(sc.done)
+    if sc.conn != nil {
+      sc.conn.Close()
+    }
+  })
+}
+
+func (sc *simConn) closed() bool {
+  select {
+    case <-sc.done:
+      return true
+    default:
+      return false
+  }
+}
+
+func (sc *simConn) queue(cmd []byte) error {
+  sc.lock.Lock()
+  defer sc.lock.Unlock()
+
+  if !sc.live {
+    return ErrNoSim
+  }
+  if len(sc.queued) + len(cmd) > maxQueued {
+    return ErrQueueFull
+  }
+  sc.queued = append(sc.queued, cmd...)
+  return nil
+}
+
+func (sc *simConn) run() {
+  defer sc.client.routines.Done()
+
+  conn, err := sc.client.dialSim(sc.ip, sc.port)
+  if err != nil {
+    sc.client.shutdown(err)
+    return
+  }
+
+  sc.client.lock.Lock()
+  sc.conn = conn
+  sc.client.lock.Unlock()
+  if sc.closed() {
+    conn.Close()
+    return
+  }
+
+  first, err := sc.handshake()
+  if err != nil {
+    if !sc.closed() {
+      sc.client.shutdown(err)
+    }
+    return
+  }
+
+  sc.lock.Lock()
+  sc.live = true
+  sc.lock.Unlock()
+
+  if !sc.client.emit(WelcomeEvent{Ip: sc.ip, Port: sc.port}) {
+    return
+  }
+  if first != nil && !sc.handlePacket(first) {
+    return
+  }
+
+  go sc.tx()
+  sc.rx()
+}
+
+// Returns a data packet if one overtook the WELCOME.
+func (sc *simConn) handshake() ([]byte, error) {
+  opts := sc.client.opts
+
+  hello := make([]byte, opts.MaxMsgSize)
+  binary.LittleEndian.PutUint32(hello[0:4], opts.ProtocolId)
+  hello[4] = byte(udp.HELLO)
+  binary.LittleEndian.PutUint64(hello[5:13], uint64(sc.clientSalt))
+  // lets SIM tell us apart from other players on our ip
+  id := sc.client.Id()
+  copy(hello[13:29], id[:])
+
+  out := hello
+  challenged := false
+  buf := make([]byte, 65535)
+  deadline := time.Now().Add(opts.HandshakeTimeout)
+  for time.Now().Before(deadline) {
+    if sc.closed() {
+      return nil, ErrClosed
+    }
+
+    // errors here are e.g. the SIM not listening yet, keep trying
+    sc.write(out)
+    sc.conn.SetReadDeadline(time.Now().Add(opts.ResendInterval))
+    n, err := sc.conn.Read(buf)
+    if err != nil {
+      time.Sleep(opts.ResendInterval / 4)
+      continue
+    }
+
+    sc.received(n)
+    packet := buf[:n]
+    if n < controlSize || snet.Read_uint32(packet[0:4]) != opts.ProtocolId {
+      continue
+    }
+
+    if !challenged && n >= 21 && udp.UDPCmd(packet[4]) == udp.CHALLENGE {
+      if snet.Read_int64(packet[5:13]) != sc.clientSalt {
+        continue
+      }
+      sc.serverSalt = snet.Read_int64(packet[13:21])
+      challenged = true
+
+      out = make([]byte, opts.MaxMsgSize)
+      binary.LittleEndian.PutUint32(out[0:4], opts.ProtocolId)
+      out[4] = byte(udp.CHALLENGE)
+      binary.LittleEndian.PutUint64(out[5:13], uint64(sc.salt()))
+    } else if challenged && n == controlSize && udp.UDPCmd(packet[4]) == udp.WELCOME {
+      if snet.Read_int64(packet[5:13]) == sc.salt() {
+        sc.conn.SetReadDeadline(time.Time{})
+        return nil, nil
+      }
+    } else if challenged && n > udp.HEADER_SIZE && snet.Read_int64(packet[4:12]) == sc.salt() {
+      // the WELCOME was lost, SIM already treats us as connected
+      sc.conn.SetReadDeadline(time.Time{})
+      return append([]byte{}, packet...), nil
+    }
+  }
+
+  return nil, errHandshakeTimeout
+}
+
+func (sc *simConn) rx() {
+  buf := make([]byte, 65535)
+  for {
+    n, err := sc.conn.Read(buf)
+    if err != nil {
+      if sc.closed() {
+        return
+      }
+      // e.g. connection refused while the SIM restarts
+      time.Sleep(sc.client.opts.Tick)
+      continue
+    }
+    sc.received(n)
+    if !sc.handlePacket(buf[:n]) {
+      return
+    }
+  }
+}
+
+// False once the session is over.
+func (sc *simConn) handlePacket(packet []byte) bool {
+  opts := sc.client.opts
+  if len(packet) < controlSize || snet.Read_uint32(packet[0:4]) != opts.ProtocolId {
+    return true
+  }
+
+  if len(packet) == controlSize {
+    if udp.UDPCmd(packet[4]) == udp.DISCONNECT && snet.Read_int64(packet[5:13]) == sc.salt() {
+      sc.lock.Lock()
+      sc.live = false
+      sc.lock.Unlock()
+      sc.close()
+      sc.client.emit(DisconnectEvent{})
+      return false
+    }
+    // a late WELCOME
+    return true
+  }
+
+  if len(packet) < udp.HEADER_SIZE || snet.Read_int64(packet[4:12]) != sc.salt() {
+    return true
+  }
+
+  seq := snet.Read_uint16(packet[12:14])
+  sc.lock.Lock()
+  fresh := seqGreaterThan(seq, sc.rxSeq)
+  gap := seq - sc.rxSeq
+  if fresh {
+    sc.rxSeq = seq
+  }
+  sc.lock.Unlock()
+  if !fresh {
+    return true
+  }
+
+  // SIM bumps seq once per message and repeats what we haven't
+  // acked behind the new ones, so the first gap are new and the
+  // rest were seen before. Fewer than gap means some never made it.
+  events := decodeSimMsgs(packet, udp.HEADER_SIZE)
+  if int(gap) < len(events) {
+    events = events[:gap]
+  } else if int(gap) > len(events) {
+    atomic.AddUint64(&sc.client.stats.simMsgsLost, uint64(int(gap) - len(events)))
+  }
+  atomic.AddUint64(&sc.client.stats.simMsgsIn, uint64(len(events)))
+  for i := len(events) - 1; i >= 0; i-- {
+    if !sc.client.emit(events[i]) {
+      return false
+    }
+  }
+  return true
+}
+
+// Every tick sends queued commands, or SHUTUP when there are none,
+// which also acks what SIM sent.
+func (sc *simConn) tx() {
+  opts := sc.client.opts
+  ticker := time.NewTicker(opts.Tick)
+  defer ticker.Stop()
+
+  packet := make([]byte, udp.HEADER_SIZE + maxQueued + 1)
+  for {
+    select {
+      case <-sc.done:
+        return
+      case <-ticker.C:
+    }
+
+    var header udp.UDPHeader
+    header.ProtocolId = opts.ProtocolId
+    header.Salt = sc.salt()
+
+    sc.lock.Lock()
+    size := udp.HEADER_SIZE
+    if len(sc.queued) > 0 {
+      sc.txSeq++
+      size += copy(packet[size:], sc.queued)
+      sc.queued = sc.queued[:0]
+    } else {
+      packet[size] = byte(udp.SHUTUP)
+      size++
+    }
+    header.Seq = sc.txSeq
+    header.Ack = sc.rxSeq
+    sc.lock.Unlock()
+
+    header.Serialize(packet)
+    sc.write(packet[:size])
+  }
+}
+
+func (sc *simConn) write(packet []byte) {
+  if _, err := sc.conn.Write(packet); err == nil {
+    atomic.AddUint64(&sc.client.stats.udpPacketsOut, 1)
+    atomic.AddUint64(&sc.client.stats.udpBytesOut, uint64(len(packet)))
+  }
+}
+
+func (sc *simConn) received(n int) {
+  atomic.AddUint64(&sc.client.stats.udpPacketsIn, 1)
+  atomic.AddUint64(&sc.client.stats.udpBytesIn, uint64(n))
+}
+
+// Bytes the message at packet[head] takes, 0 for SHUTUP or
+// anything unknown. More than is left when it was cut short.
+func simMsgSize(packet []byte, head int) int {
+  switch udp.UDPCmd(packet[head]) {
+    case udp.SYNC:
+      return (&msg.SyncMsg{}).GetSize()
+    case udp.ENTER:
+      return (&msg.EnterMsg{}).GetSize()
+    case udp.EXIT:
+      return (&msg.ExitMsg{}).GetSize()
+    case udp.MOVESHOOT:
+      return 6
+    case udp.STATE:
+      // the body count is the last byte before the bodies
+      var m msg.StateMsg
+      if head + m.GetSize() > len(packet) {
+        return m.GetSize()
+      }
+      m.Bodies = make([]msg.BodyState, packet[head + m.GetSize() - 1])
+      return m.GetSize()
+  }
+  return 0
+}
+
+// Events for the messages after head, in the order SIM packed them.
+// Stops at SHUTUP, anything it doesn't know or a message cut short.
+func decodeSimMsgs(packet []byte, head int) (events []Event) {
+  for head < len(packet) {
+    size := simMsgSize(packet, head)
+    if size == 0 || head + size > len(packet) {
+      return
+    }
+
+    switch udp.UDPCmd(packet[head]) {
+      case udp.SYNC:
+        var m msg.SyncMsg
+        head = m.Deserialize(packet, head)
+        events = append(events, SyncEvent{Seq: m.Seq, Time: m.Time})
+      case udp.ENTER:
+        var m msg.EnterMsg
+        head = m.Deserialize(packet, head)
+        events = append(events, EnterEvent{m.PlayerId, m.BodyId, m.X, m.Y})
+      case udp.EXIT:
+        var m msg.ExitMsg
+        head = m.Deserialize(packet, head)
+        events = append(events, ExitEvent{BodyId: m.BodyId})
+      case udp.MOVESHOOT:
+        // SIM relays input with the body it moves, unlike what clients send
+        var e MoveShootEvent
+        e.BodyId = snet.Read_uint16(packet[head+1:head+3])
+        e.Tick = snet.Read_uint16(packet[head+3:head+5])
+        e.MoveShoot = packet[head+5]
+        head += 6
+        events = append(events, e)
+      case udp.STATE:
+        var m msg.StateMsg
+        head = m.Deserialize(packet, head)
+        events = append(events, StateEvent{m.Seq, m.X, m.Y, m.Bodies})
+    }
+  }
+  return
+}
+
+// Same as in UDPPlayer.
+func seqGreaterThan(s1 uint16, s2 uint16) bool {
+  return ((s1 > s2) && (s1-s2 <= 32768)) || ((s1 < s2) && (s2-s1 > 32768))
+}
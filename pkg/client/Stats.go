@@ -0,0 +1,38 @@
+package client
+
+import(
+  "sync/atomic"
+)
+
+// Traffic counters since Dial.
+type Stats struct {
+  WorldBytesIn  uint64
+  UDPPacketsIn  uint64
+  UDPBytesIn    uint64
+  UDPPacketsOut uint64
+  UDPBytesOut   uint64
+  SimMsgsIn     uint64
+  SimMsgsLost   uint64  // messages SIM sent that never arrived, from seq gaps
+}
+
+type stats struct {
+  worldBytesIn  uint64
+  udpPacketsIn  uint64
+  udpBytesIn    uint64
+  udpPacketsOut uint64
+  udpBytesOut   uint64
+  simMsgsIn     uint64
+  simMsgsLost   uint64
+}
+
+func (c *Client) Stats() Stats {
+  var s Stats
+  s.WorldBytesIn = atomic.LoadUint64(&c.stats.worldBytesIn)
+  s.UDPPacketsIn = atomic.LoadUint64(&c.stats.udpPacketsIn)
+  s.UDPBytesIn = atomic.LoadUint64(&c.stats.udpBytesIn)
+  s.UDPPacketsOut = atomic.LoadUint64(&c.stats.udpPacketsOut)
+  s.UDPBytesOut = atomic.LoadUint64(&c.stats.udpBytesOut)
+  s.SimMsgsIn = atomic.LoadUint64(&c.stats.simMsgsIn)
+  s.SimMsgsLost = atomic.LoadUint64(&c.stats.simMsgsLost)
+  return s
+}
@@ -0,0 +1,203 @@
+package client
+
+import(
+  "io"
+  "bufio"
+  "errors"
+  "sync/atomic"
+  "encoding/binary"
+
+  "go-space-serv/internal/space/snet/tcp"
+  "go-space-serv/internal/space/world/msg"
+)
+
+// WORLD -> client over tcp
+//
+// frame: length(2) msg(length)
+// msg: cmd(1) body
+//
+// and the same the other way, LOGIN first and then CHAT, PLAYER_UPDATE and PONG.
+// PINGs are answered here and never reach Events.
+
+var errShortMsg = errors.New("client: message shorter than its command needs")
+
+// WORLD checking we're still there, answered by worldRx.
+type pingEvent struct {
+  time  int64
+}
+
+func (pingEvent) isEvent() {}
+
+func (c *Client) worldRx() {
+  defer c.routines.Done()
+
+  reader := bufio.NewReader(c.world)
+  header := make([]byte, 2)
+  for {
+    if _, err := io.ReadFull(reader, header); err != nil {
+      c.worldLost(err)
+      return
+    }
+
+    frame := make([]byte, binary.LittleEndian.Uint16(header))
+    if _, err := io.ReadFull(reader, frame); err != nil {
+      c.worldLost(err)
+      return
+    }
+    atomic.AddUint64(&c.stats.worldBytesIn, uint64(len(header) + len(frame)))
+
+    head := 0
+    for head < len(frame) {
+      e, next, err := decodeWorldMsg(frame, head)
+      if err != nil || e == nil {
+        // unknown or cut short, the rest of the frame can't be found
+        break
+      }
+      head = next
+
+      if p, ok := e.(pingEvent); ok {
+        c.worldSend(&msg.PongMsg{Time: p.time})
+        continue
+      }
+      if !c.emit(e) {
+        return
+      }
+      c.handleWorldEvent(e)
+    }
+  }
+}
+
+// Writes one message to WORLD in its own frame.
+func (c *Client) worldSend(m tcp.TCPMsg) error {
+  frame := make([]byte, tcp.PacketSize)
+  head := m.Serialize(frame, 2)
+  binary.LittleEndian.PutUint16(frame[0:2], uint16(head - 2))
+
+  c.worldLock.Lock()
+  defer c.worldLock.Unlock()
+  if _, err := c.world.Write(frame[:head]); err != nil {
+    return err
+  }
+  return nil
+}
+
+func (c *Client) worldLost(err error) {
+  if err == io.EOF {
+    err = nil
+  }
+  c.shutdown(err)
+}
+
+func (c *Client) handleWorldEvent(e Event) {
+  switch t := e.(type) {
+    case PlayerInfoEvent:
+      c.lock.Lock()
+      c.id = t.Id
+      c.lock.Unlock()
+    case SimInfoEvent:
+      c.connectSim(t.Ip, t.Port)
+  }
+}
+
+// Bytes the message at frame[head] takes, 0 if the command is
+// unknown. More than is left when it was cut short.
+func worldMsgSize(frame []byte, head int) int {
+  // fixed part, and the length field inside it, if any
+  var fixed, lenAt, lenSize int
+  switch tcp.TCPCmd(frame[head]) {
+    case tcp.PING:
+      fixed = 9
+    case tcp.PLAYER_INFO, tcp.JOIN:
+      fixed, lenAt, lenSize = 30, 29, 1
+    case tcp.WORLD_INFO:
+      fixed = 29
+    case tcp.SIM_INFO:
+      fixed, lenAt, lenSize = 6, 1, 1
+    case tcp.LEAVE:
+      fixed = 17
+    case tcp.BLOCKS:
+      fixed, lenAt, lenSize = 5, 3, 2
+    case tcp.SIM_LOST, tcp.SHUTDOWN:
+      fixed = 1
+    case tcp.BROADCAST:
+      fixed, lenAt, lenSize = 3, 1, 2
+    case tcp.PLAYER_UPDATE:
+      fixed, lenAt, lenSize = 18, 17, 1
+    case tcp.CHAT:
+      fixed, lenAt, lenSize = 20, 18, 2
+    default:
+      return 0
+  }
+
+  if lenSize == 0 || head + fixed > len(frame) {
+    return fixed
+  }
+  if lenSize == 1 {
+    return fixed + int(frame[head+lenAt])
+  }
+  return fixed + int(binary.LittleEndian.Uint16(frame[head+lenAt:head+lenAt+2]))
+}
+
+// Event for the message at frame[head], and where the next one starts.
+// A nil event means the command is unknown.
+func decodeWorldMsg(frame []byte, head int) (e Event, next int, err error) {
+  size := worldMsgSize(frame, head)
+  if size == 0 {
+    return nil, head, nil
+  }
+  if head + size > len(frame) {
+    return nil, head, errShortMsg
+  }
+
+  switch tcp.TCPCmd(frame[head]) {
+    case tcp.PING:
+      var m msg.PingMsg
+      next = m.Deserialize(frame, head)
+      e = pingEvent{time: m.Time}
+    case tcp.PLAYER_INFO:
+      var m msg.PlayerInfoMsg
+      next = m.Deserialize(frame, head)
+      e = PlayerInfoEvent{Id: m.Id, Stats: m.Stats, Name: m.Name}
+    case tcp.WORLD_INFO:
+      var m msg.WorldInfoMsg
+      next = m.Deserialize(frame, head)
+      e = WorldInfoEvent{m.ChunksPerFile, m.ChunkSize, m.Size, m.Seed, m.Threshold}
+    case tcp.SIM_INFO:
+      var m msg.SimInfoMsg
+      next = m.Deserialize(frame, head)
+      e = SimInfoEvent{Ip: m.Ip, Port: m.Port}
+    case tcp.JOIN:
+      var m msg.PlayerJoinMsg
+      next = m.Deserialize(frame, head)
+      e = JoinEvent{Id: m.Id, Stats: m.Stats, Name: m.Name}
+    case tcp.LEAVE:
+      var m msg.PlayerLeaveMsg
+      next = m.Deserialize(frame, head)
+      e = LeaveEvent{Id: m.Id}
+    case tcp.BLOCKS:
+      var m msg.BlocksMsg
+      next = m.Deserialize(frame, head)
+      e = BlocksEvent{Id: m.Id, Data: m.Data}
+    case tcp.SIM_LOST:
+      var m msg.SimLostMsg
+      next = m.Deserialize(frame, head)
+      e = SimLostEvent{}
+    case tcp.SHUTDOWN:
+      var m msg.ShutdownMsg
+      next = m.Deserialize(frame, head)
+      e = ShutdownEvent{}
+    case tcp.BROADCAST:
+      var m msg.BroadcastMsg
+      next = m.Deserialize(frame, head)
+      e = BroadcastEvent{Text: m.Text}
+    case tcp.PLAYER_UPDATE:
+      var m msg.PlayerUpdateMsg
+      next = m.Deserialize(frame, head)
+      e = PlayerUpdateEvent{Id: m.Id, Name: m.Name}
+    case tcp.CHAT:
+      var m msg.ChatMsg
+      next = m.Deserialize(frame, head)
+      e = ChatEvent{m.Scope, m.PlayerId, m.Text}
+  }
+  return
+}
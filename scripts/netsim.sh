@@ -0,0 +1,70 @@
+#!/bin/sh
+# Local check that SIM delivers what it sends over a bad network.
+# Runs WORLD and a SIM that drops, delays, duplicates and reorders the udp
+# packets it sends, then a few bots, and checks that
+#   1) every bot gets through the handshake,
+#   2) no message SIM sent was lost for good.
+# Only packets from SIM to clients go through the bad network.
+#
+# usage: scripts/netsim.sh   (from the repository root, after make world sim gen loadtest)
+
+set -eu
+
+BIN=./bin
+WORK=$(mktemp -d)
+MAP=$WORK/map
+BOTS=${BOTS:-5}
+
+export SPACE_LINK_SECRET=netsim
+export SPACE_WORLD_PORT=19494
+export SPACE_SIM_PORT=19495
+export SPACE_LINK_PORT=19496
+export SPACE_MAP_PATH=$MAP
+
+PIDS=""
+cleanup() {
+  for pid in $PIDS; do
+    kill "$pid" 2>/dev/null || true
+  done
+  echo "logs in $WORK"
+}
+trap cleanup EXIT
+
+# wait_for file pattern count
+wait_for() {
+  i=0
+  while [ "$(grep -c "$2" "$1" 2>/dev/null || true)" -lt "$3" ]; do
+    i=$((i + 1))
+    if [ $i -gt 100 ]; then
+      echo "FAIL: timed out waiting for '$2' x$3 in $1"
+      exit 1
+    fi
+    sleep 0.1
+  done
+}
+
+$BIN/gen --size=16 --csize=128 --cpf=64 "$MAP" > "$WORK/gen.log" 2>&1
+
+$BIN/world > "$WORK/world.log" 2>&1 &
+PIDS="$PIDS $!"
+wait_for "$WORK/world.log" "awaiting simulation" 1
+
+$BIN/sim --netLatency=40ms --netJitter=20ms --netLoss=0.2 --netDuplicate=0.05 --netReorder=0.05 --netSeed=7 > "$WORK/sim.log" 2>&1 &
+PIDS="$PIDS $!"
+wait_for "$WORK/world.log" 'physics ready"' 1
+
+$BIN/loadtest --world=127.0.0.1:19494 --bots="$BOTS" --rampUp=2s --duration=10s --syncRate=100ms > "$WORK/loadtest.log" 2>&1
+
+if ! grep -q "^connect   $BOTS ok, 0 failed" "$WORK/loadtest.log"; then
+  echo "FAIL: not every bot connected"
+  grep "^connect" "$WORK/loadtest.log"
+  exit 1
+fi
+echo "ok: $BOTS bots through the handshake"
+
+if ! grep -q "^loss      0.00%" "$WORK/loadtest.log"; then
+  echo "FAIL: messages lost"
+  grep "^loss" "$WORK/loadtest.log"
+  exit 1
+fi
+echo "ok: no messages lost"
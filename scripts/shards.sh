@@ -0,0 +1,97 @@
+#!/bin/sh
+# Local multi-process check for sharding.
+# Runs WORLD and two SIMs splitting a small map in half on this machine and checks that
+#   1) both regions come up,
+#   2) a SIM claiming an overlapping region is turned away,
+#   3) a SIM that restarts gets its region back,
+#   4) a bot flying across x=1024 is handed to the other SIM.
+# The map is empty, with team 0 spawning just right of the boundary.
+#
+# usage: scripts/shards.sh   (from the repository root, after make world sim gen loadtest)
+
+set -eu
+
+BIN=./bin
+WORK=$(mktemp -d)
+MAP=$WORK/map
+SECRET=shards
+LEFT=0,0,1024,2048
+RIGHT=1024,0,2048,2048
+
+export SPACE_LINK_SECRET=$SECRET
+export SPACE_WORLD_PORT=19494
+export SPACE_LINK_PORT=19496
+export SPACE_MAP_PATH=$MAP
+
+PIDS=""
+cleanup() {
+  for pid in $PIDS; do
+    kill "$pid" 2>/dev/null || true
+  done
+  echo "logs in $WORK"
+}
+trap cleanup EXIT
+
+# wait_for file pattern count
+wait_for() {
+  i=0
+  while [ "$(grep -c "$2" "$1" 2>/dev/null || true)" -lt "$3" ]; do
+    i=$((i + 1))
+    if [ $i -gt 100 ]; then
+      echo "FAIL: timed out waiting for '$2' x$3 in $1"
+      exit 1
+    fi
+    sleep 0.1
+  done
+}
+
+# start_sim name region port
+start_sim() {
+  SPACE_SIM_REGION=$2 SPACE_SIM_PORT=$3 $BIN/sim > "$WORK/$1.log" 2>&1 &
+  PIDS="$PIDS $!"
+  LAST=$!
+}
+
+# no blocks anywhere, spawn points only at x=1028
+cat > "$WORK/profile.json" <<EOF
+{
+  "terrain": { "scale": 0.05, "octaves": 1 },
+  "biomes": [ { "name": "open", "max": 1, "block": "GRAY", "threshold": 2 } ],
+  "spawnZones": [ { "team": 0, "minX": 1024, "minY": 960, "maxX": 1033, "maxY": 1088 } ]
+}
+EOF
+
+# ships spawn facing +y, so turning left circles out past x=1024 and back
+echo "1000 forward+left" > "$WORK/circle.txt"
+
+$BIN/gen --size=16 --csize=128 --cpf=64 --profile="$WORK/profile.json" "$MAP" > "$WORK/gen.log" 2>&1
+
+$BIN/world > "$WORK/world.log" 2>&1 &
+PIDS="$PIDS $!"
+wait_for "$WORK/world.log" "awaiting simulation" 1
+
+start_sim left $LEFT 19501
+start_sim right $RIGHT 19502
+RIGHT_PID=$LAST
+wait_for "$WORK/world.log" 'physics ready" region=0,0-1024,2048' 1
+wait_for "$WORK/world.log" 'physics ready" region=1024,0-2048,2048' 1
+echo "ok: two regions up"
+
+start_sim overlap 512,0,1536,2048 19503
+OVERLAP_PID=$LAST
+wait_for "$WORK/world.log" "region overlaps another simulation" 1
+kill "$OVERLAP_PID"
+echo "ok: overlapping region refused"
+
+kill "$RIGHT_PID"
+wait_for "$WORK/world.log" 'physics lost.* region=1024,0-2048,2048' 1
+start_sim right2 $RIGHT 19502
+wait_for "$WORK/world.log" 'physics ready" region=1024,0-2048,2048' 2
+echo "ok: restarted region reattached"
+
+$BIN/loadtest --world=127.0.0.1:19494 --bots=1 --rampUp=100ms --duration=10s --pattern=script --script="$WORK/circle.txt" > "$WORK/loadtest.log" 2>&1 &
+PIDS="$PIDS $!"
+wait_for "$WORK/right2.log" 'msg=spawning' 1
+wait_for "$WORK/world.log" 'handed off.* from=1024,0-2048,2048 to=0,0-1024,2048' 1
+wait_for "$WORK/left.log" 'msg=spawning' 1
+echo "ok: body handed off across x=1024"